@@ -71,20 +71,157 @@ type ValsSecretSpec struct {
 	Databases []Database            `json:"databases,omitempty"`
 	Template  map[string]string     `json:"template,omitempty"`
 	Rollout   []RolloutTarget       `json:"rollout,omitempty"`
+	// RolloutMode auto also restarts the Deployments,
+	// StatefulSets and DaemonSets of the namespace that use the secret
+	// +kubebuilder:validation:Enum=auto
+	// +optional
+	RolloutMode string `json:"rolloutMode,omitempty"`
+	// RolloutPolicy staggers the restarts
+	// +optional
+	RolloutPolicy *RolloutPolicy `json:"rolloutPolicy,omitempty"`
+	// RolloutStrategy restart, the default, replaces the pods of the
+	// workloads. reload leaves them running and annotates them so that kubelet
+	// refreshes the mounted secret sooner, for applications reloading files on
+	// their own
+	// +kubebuilder:validation:Enum=restart;reload
+	// +optional
+	RolloutStrategy string `json:"rolloutStrategy,omitempty"`
+	// Reload is an HTTP endpoint called on each pod after it is annotated
+	// when RolloutStrategy is reload
+	// +optional
+	Reload *ReloadEndpoint `json:"reload,omitempty"`
+	// MaintenanceWindows hold changes to the secret, and the restarts that
+	// follow, until one of them opens. Defaults to the operator-wide window
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// ServiceAccountName is used to log in to Vault/OpenBao when the operator
+	// runs with per-namespace identity. Defaults to the default ServiceAccount
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// StoreRef resolves the ref+vault:// and ref+openbao:// references with a
+	// SecretStore or ClusterSecretStore instead of the operator configuration
+	StoreRef *SecretStoreRef `json:"storeRef,omitempty"`
 }
 
-// RolloutTarget sets up what deployment or sts to restart
+// SecretStoreRef points a secret at a SecretStore or ClusterSecretStore
+type SecretStoreRef struct {
+	// Name of the store
+	Name string `json:"name"`
+	// Kind is either SecretStore or ClusterSecretStore, defaults to SecretStore
+	// +kubebuilder:validation:Enum=SecretStore;ClusterSecretStore
+	Kind string `json:"kind,omitempty"`
+}
+
+// RolloutTarget sets up what workload to restart
 type RolloutTarget struct {
-	// Kind is either Deployment, Pod or StatefulSet
+	// Kind is Deployment, StatefulSet, DaemonSet, CronJob, Rollout (Argo
+	// Rollouts) or Pod, or the kind of any resource with a pod template when
+	// APIVersion is set
 	Kind string `json:"kind"`
 	// Name is the object name
 	Name string `json:"name"`
+	// APIVersion of the resource, such as example.com/v1. Only required for
+	// kinds not listed above
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// TemplatePath is the path to the pod template of a resource set with
+	// APIVersion, such as .spec.template which is the default
+	// +optional
+	TemplatePath string `json:"templatePath,omitempty"`
+}
+
+// RolloutPolicy limits how fast the workloads are restarted
+type RolloutPolicy struct {
+	// MaxConcurrent is how many of the workloads may be restarting at the
+	// same time, unlimited when 0
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+	// WaitForAvailable holds each restart until the workload is Available
+	// again before the next one starts
+	// +optional
+	WaitForAvailable bool `json:"waitForAvailable,omitempty"`
+	// MinInterval is the minimum time between two restarts of the same
+	// workload, such as 10m. Changes made in between are applied together
+	// +optional
+	MinInterval string `json:"minInterval,omitempty"`
+}
+
+// ReloadEndpoint is called through the API server proxy to make a pod reload
+// the secret
+type ReloadEndpoint struct {
+	// Port the container serves the endpoint on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// Path of the endpoint, defaults to /-/reload
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Method defaults to POST
+	// +kubebuilder:validation:Enum=GET;POST;PUT
+	// +optional
+	Method string `json:"method,omitempty"`
+	// Scheme defaults to http
+	// +kubebuilder:validation:Enum=http;https
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+	// Delay between annotating the pods and calling the endpoint, giving
+	// kubelet time to refresh the mounted secret. Defaults to 10s
+	// +optional
+	Delay string `json:"delay,omitempty"`
+}
+
+// MaintenanceWindow is a time the secret may be changed in
+type MaintenanceWindow struct {
+	// Schedule is a cron expression for when the window opens, such as
+	// "0 2 * * sat"
+	Schedule string `json:"schedule"`
+	// Duration the window stays open for, such as 4h
+	Duration string `json:"duration"`
+	// TimeZone of the schedule, such as Europe/London. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// RolloutConsumer is a workload restarted when the secret changes and how far
+// it has rolled out
+type RolloutConsumer struct {
+	// Kind of the workload
+	Kind string `json:"kind"`
+	// Name of the workload
+	Name string `json:"name"`
+	// APIVersion of the workload when set in rollout
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Hash of the secret the workload was last restarted or reloaded for
+	// +optional
+	Hash string `json:"hash,omitempty"`
+	// Pods of the workload
+	Pods int32 `json:"pods"`
+	// UpdatedPods run a template with Hash
+	UpdatedPods int32 `json:"updatedPods"`
+	// Converged is true once all the pods run a template with Hash
+	Converged bool `json:"converged"`
 }
 
 // ValsSecretStatus defines the observed state of ValsSecret
 type ValsSecretStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// PendingUntil is when the changes held by a maintenance window will be
+	// applied
+	// +optional
+	PendingUntil *metav1.Time `json:"pendingUntil,omitempty"`
+
+	// Consumers are the workloads restarted when the secret changes
+	// +optional
+	Consumers []RolloutConsumer `json:"consumers,omitempty"`
+	// Conditions hold ConsumersConverged, False while some consumers still
+	// run an older version of the secret
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
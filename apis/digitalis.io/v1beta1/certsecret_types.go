@@ -0,0 +1,132 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CertSecretSpec defines the desired state of CertSecret
+type CertSecretSpec struct {
+	// Name can override the secret name, defaults to manifests.name
+	SecretName string          `json:"secretName,omitempty"`
+	Vault      CertVaultConfig `json:"vault"`
+	// CommonName is the CN requested for the certificate
+	CommonName string `json:"commonName"`
+	// AltNames are additional DNS or email subject alternative names
+	AltNames []string `json:"altNames,omitempty"`
+	// IPSans are IP subject alternative names
+	IPSans []string `json:"ipSans,omitempty"`
+	// TTL requested for the certificate such as 72h, defaults to the PKI role TTL
+	TTL string `json:"ttl,omitempty"`
+	// RenewPercent is how much of the certificate lifetime, in percent, may
+	// elapse before a new certificate is issued. Defaults to 66
+	RenewPercent int               `json:"renewPercent,omitempty"`
+	Rollout      []DbRolloutTarget `json:"rollout,omitempty"`
+	// RolloutMode auto also restarts the Deployments,
+	// StatefulSets and DaemonSets of the namespace that use the secret
+	// +kubebuilder:validation:Enum=auto
+	// +optional
+	RolloutMode string `json:"rolloutMode,omitempty"`
+	// RolloutPolicy staggers the restarts
+	// +optional
+	RolloutPolicy *RolloutPolicy `json:"rolloutPolicy,omitempty"`
+	// RolloutStrategy restart, the default, replaces the pods of the
+	// workloads. reload leaves them running and annotates them so that kubelet
+	// refreshes the mounted secret sooner, for applications reloading files on
+	// their own
+	// +kubebuilder:validation:Enum=restart;reload
+	// +optional
+	RolloutStrategy string `json:"rolloutStrategy,omitempty"`
+	// Reload is an HTTP endpoint called on each pod after it is annotated
+	// when RolloutStrategy is reload
+	// +optional
+	Reload *ReloadEndpoint `json:"reload,omitempty"`
+	// MaintenanceWindows hold changes to the secret, and the restarts that
+	// follow, until one of them opens. Defaults to the operator-wide window
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// ServiceAccountName is used to log in to Vault/OpenBao when the operator
+	// runs with per-namespace identity. Defaults to the default ServiceAccount
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+/*
+apiVersion: digitalis.io/v1beta1
+kind: CertSecret
+metadata:
+  name: web-tls
+spec:
+  secretName: web-tls
+  vault:
+    role: example-dot-com
+    mount: pki_int
+  commonName: web.example.com
+  altNames:
+    - www.example.com
+  ttl: 72h
+  renewPercent: 66 # optional: issue a new certificate after 2/3 of its lifetime
+  rollout: # optional: run a `rollout` to make the pods use the new certificate
+    - kind: Deployment
+      name: web
+*/
+
+type CertVaultConfig struct {
+	// Role is the PKI role used to issue the certificate
+	Role string `json:"role"`
+	// Mount is the path the PKI secrets engine is mounted on
+	Mount string `json:"mount"`
+	// Namespace is the Vault Enterprise / OpenBao namespace of the mount.
+	// Defaults to the namespace the operator is configured with
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CertSecretStatus defines the observed state of CertSecret
+type CertSecretStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// PendingUntil is when the changes held by a maintenance window will be
+	// applied
+	// +optional
+	PendingUntil *metav1.Time `json:"pendingUntil,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// CertSecret is the Schema for the certsecrets API
+type CertSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CertSecretSpec   `json:"spec,omitempty"`
+	Status CertSecretStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CertSecretList contains a list of CertSecret
+type CertSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CertSecret `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CertSecret{}, &CertSecretList{})
+}
@@ -31,6 +31,39 @@ type DbSecretSpec struct {
 	Template   map[string]string `json:"template,omitempty"`
 	Renew      bool              `json:"renew,omitempty"`
 	Rollout    []DbRolloutTarget `json:"rollout,omitempty"`
+	// RolloutMode auto also restarts the Deployments,
+	// StatefulSets and DaemonSets of the namespace that use the secret
+	// +kubebuilder:validation:Enum=auto
+	// +optional
+	RolloutMode string `json:"rolloutMode,omitempty"`
+	// RolloutPolicy staggers the restarts
+	// +optional
+	RolloutPolicy *RolloutPolicy `json:"rolloutPolicy,omitempty"`
+	// RolloutStrategy restart, the default, replaces the pods of the
+	// workloads. reload leaves them running and annotates them so that kubelet
+	// refreshes the mounted secret sooner, for applications reloading files on
+	// their own
+	// +kubebuilder:validation:Enum=restart;reload
+	// +optional
+	RolloutStrategy string `json:"rolloutStrategy,omitempty"`
+	// Reload is an HTTP endpoint called on each pod after it is annotated
+	// when RolloutStrategy is reload
+	// +optional
+	Reload *ReloadEndpoint `json:"reload,omitempty"`
+	// MaintenanceWindows hold changes to the secret, and the restarts that
+	// follow, until one of them opens. Defaults to the operator-wide window
+	// +optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// Secret renames the keys the credentials are stored under
+	Secret DbSecretKeys `json:"secret,omitempty"`
+	// Outputs adds connection strings built from the credentials
+	Outputs []DbSecretOutput `json:"outputs,omitempty"`
+	// ServiceAccountName is used to log in to Vault/OpenBao when the operator
+	// runs with per-namespace identity. Defaults to the default ServiceAccount
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// StoreRef reads the credentials from a SecretStore or ClusterSecretStore
+	// instead of the server the operator is configured with
+	StoreRef *SecretStoreRef `json:"storeRef,omitempty"`
 }
 
 /*
@@ -41,24 +74,91 @@ metadata:
 spec:
   secretName: another-name
   renew: true
+  storeRef: # optional: use a SecretStore instead of the operator configuration
+    name: openbao
   vault:
     role: application_role
     mount: which_database
   secret: # optional: vault returns the values as `username` and `password` but you may need different variable names
     username: "CASSANDRA_USERNAME"
     password: "CASSANDRA_PASSWORD"
-	host: localhost
-	dc: europe
+    hosts: "CASSANDRA_HOSTS"
+  outputs: # optional: connection strings built from the credentials
+    - key: CASSANDRA_CONTACT_POINTS
+      format: cassandra
   rollout: # optional: run a `rollout` to make the pods use new credentials
     - kind: Deployment
       name: my-cass-client
 */
 
 type DbRolloutTarget struct {
-	// Kind is either Deployment, Pod or StatefulSet
+	// Kind is Deployment, StatefulSet, DaemonSet, CronJob, Rollout (Argo
+	// Rollouts) or Pod, or the kind of any resource with a pod template when
+	// APIVersion is set
 	Kind string `json:"kind"`
 	// Name is the object name
 	Name string `json:"name"`
+	// APIVersion of the resource, such as example.com/v1. Only required for
+	// kinds not listed above
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// TemplatePath is the path to the pod template of a resource set with
+	// APIVersion, such as .spec.template which is the default
+	// +optional
+	TemplatePath string `json:"templatePath,omitempty"`
+}
+
+// RolloutPolicy limits how fast the workloads are restarted
+type RolloutPolicy struct {
+	// MaxConcurrent is how many of the workloads may be restarting at the
+	// same time, unlimited when 0
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+	// WaitForAvailable holds each restart until the workload is Available
+	// again before the next one starts
+	// +optional
+	WaitForAvailable bool `json:"waitForAvailable,omitempty"`
+	// MinInterval is the minimum time between two restarts of the same
+	// workload, such as 10m. Changes made in between are applied together
+	// +optional
+	MinInterval string `json:"minInterval,omitempty"`
+}
+
+// ReloadEndpoint is called through the API server proxy to make a pod reload
+// the secret
+type ReloadEndpoint struct {
+	// Port the container serves the endpoint on
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// Path of the endpoint, defaults to /-/reload
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Method defaults to POST
+	// +kubebuilder:validation:Enum=GET;POST;PUT
+	// +optional
+	Method string `json:"method,omitempty"`
+	// Scheme defaults to http
+	// +kubebuilder:validation:Enum=http;https
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+	// Delay between annotating the pods and calling the endpoint, giving
+	// kubelet time to refresh the mounted secret. Defaults to 10s
+	// +optional
+	Delay string `json:"delay,omitempty"`
+}
+
+// MaintenanceWindow is a time the secret may be changed in
+type MaintenanceWindow struct {
+	// Schedule is a cron expression for when the window opens, such as
+	// "0 2 * * sat"
+	Schedule string `json:"schedule"`
+	// Duration the window stays open for, such as 4h
+	Duration string `json:"duration"`
+	// TimeZone of the schedule, such as Europe/London. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 type DbVaultConfig struct {
@@ -66,6 +166,36 @@ type DbVaultConfig struct {
 	Role string `json:"role"`
 	// Mount is the vault database
 	Mount string `json:"mount"`
+	// Namespace is the Vault Enterprise / OpenBao namespace of the mount.
+	// Defaults to the namespace the operator is configured with
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// DbSecretKeys sets the key names used in the secret. Empty values keep the default name
+type DbSecretKeys struct {
+	// Username key, defaults to username
+	Username string `json:"username,omitempty"`
+	// Password key, defaults to password
+	Password string `json:"password,omitempty"`
+	// Hosts key, defaults to hosts
+	Hosts string `json:"hosts,omitempty"`
+	// ConnectionURL key, defaults to connection_url
+	ConnectionURL string `json:"connectionUrl,omitempty"`
+}
+
+// DbSecretOutput adds a connection string to the secret
+type DbSecretOutput struct {
+	// Key in the secret the connection string is stored under
+	Key string `json:"key"`
+	// Format is one of jdbc-postgresql, jdbc-mysql, libpq, mysql, mongodb or cassandra
+	// +kubebuilder:validation:Enum=jdbc-postgresql;jdbc-mysql;libpq;mysql;mongodb;cassandra
+	Format string `json:"format"`
+	// Database name, defaults to the one in the connection_url of the database engine
+	Database string `json:"database,omitempty"`
+	// Options are added as parameters to the connection string, such as
+	// sslmode. The parameters of the connection_url of the database engine
+	// are added too unless overridden here
+	Options map[string]string `json:"options,omitempty"`
 }
 
 type DbSecretRollout struct {
@@ -75,10 +205,46 @@ type DbSecretRollout struct {
 	Name string `json:"name"`
 }
 
+// RolloutConsumer is a workload restarted when the secret changes and how far
+// it has rolled out
+type RolloutConsumer struct {
+	// Kind of the workload
+	Kind string `json:"kind"`
+	// Name of the workload
+	Name string `json:"name"`
+	// APIVersion of the workload when set in rollout
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Hash of the secret the workload was last restarted or reloaded for
+	// +optional
+	Hash string `json:"hash,omitempty"`
+	// Pods of the workload
+	Pods int32 `json:"pods"`
+	// UpdatedPods run a template with Hash
+	UpdatedPods int32 `json:"updatedPods"`
+	// Converged is true once all the pods run a template with Hash
+	Converged bool `json:"converged"`
+}
+
 // DbSecretStatus defines the observed state of DbSecret
 type DbSecretStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// PendingUntil is when the changes held by a maintenance window will be
+	// applied
+	// +optional
+	PendingUntil *metav1.Time `json:"pendingUntil,omitempty"`
+
+	// Consumers are the workloads restarted when the secret changes
+	// +optional
+	Consumers []RolloutConsumer `json:"consumers,omitempty"`
+	// Conditions hold ConsumersConverged, False while some consumers still
+	// run an older version of the secret
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,95 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DbSecretPolicySpec defines which database and PKI roles the selected namespaces may request
+type DbSecretPolicySpec struct {
+	// Namespaces the policy applies to. Shell patterns such as team-* are accepted
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the namespaces the policy applies to by their labels
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Allow lists the mount and role patterns the namespaces may use
+	// +optional
+	Allow []DbSecretPolicyRule `json:"allow,omitempty"`
+	// Certificates lists the PKI mount and role patterns the namespaces may
+	// issue CertSecrets from. Store must be left empty
+	// +optional
+	Certificates []DbSecretPolicyRule `json:"certificates,omitempty"`
+}
+
+/*
+apiVersion: digitalis.io/v1beta1
+kind: DbSecretPolicy
+metadata:
+  name: team-a
+spec:
+  namespaces:
+    - team-a
+    - team-a-*
+  namespaceSelector: # optional: also match namespaces by label
+    matchLabels:
+      team: a
+  allow:
+    - mount: database
+      role: team-a-*
+      vaultNamespace: team-a # optional: defaults to the operator's namespace
+      store: SecretStore/* # optional: defaults to the operator's server
+  certificates: # optional: PKI roles for CertSecrets
+    - mount: pki_int
+      role: team-a-*
+*/
+
+type DbSecretPolicyRule struct {
+	// Mount is a shell pattern for the database secrets engine path. `*` does not match `/`
+	Mount string `json:"mount"`
+	// Role is a shell pattern for the database role
+	Role string `json:"role"`
+	// VaultNamespace is a shell pattern for the Vault Enterprise / OpenBao
+	// namespace of the mount. Empty only matches the operator's namespace
+	VaultNamespace string `json:"vaultNamespace,omitempty"`
+	// Store is a shell pattern for the store of the DbSecret, as SecretStore/name
+	// or ClusterSecretStore/name. Empty only matches DbSecrets without storeRef
+	Store string `json:"store,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// DbSecretPolicy is the Schema for the dbsecretpolicies API
+type DbSecretPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DbSecretPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DbSecretPolicyList contains a list of DbSecretPolicy
+type DbSecretPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DbSecretPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DbSecretPolicy{}, &DbSecretPolicyList{})
+}
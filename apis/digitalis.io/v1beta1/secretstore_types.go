@@ -0,0 +1,235 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecretStoreSpec declares how to reach and log in to a Vault or OpenBao server
+type SecretStoreSpec struct {
+	// Backend is either vault or openbao
+	// +kubebuilder:validation:Enum=vault;openbao
+	Backend string `json:"backend"`
+	// Address of the server, such as https://vault.example.com:8200
+	Address string `json:"address"`
+	// Namespace is the Vault Enterprise / OpenBao namespace used for all requests
+	Namespace string `json:"namespace,omitempty"`
+	// TLS configures how the server certificate is verified and the client certificate
+	TLS *SecretStoreTLS `json:"tls,omitempty"`
+	// Auth configures the login method. Exactly one method must be set
+	Auth SecretStoreAuth `json:"auth"`
+}
+
+/*
+apiVersion: digitalis.io/v1beta1
+kind: SecretStore
+metadata:
+  name: openbao
+spec:
+  backend: openbao
+  address: https://openbao.example.com:8200
+  namespace: team-a # optional
+  tls: # optional
+    caSecretRef:
+      name: openbao-ca
+      key: ca.crt
+  auth:
+    kubernetes:
+      role: team-a
+      serviceAccountRef: # optional: defaults to the operator ServiceAccount
+        name: app
+*/
+
+// SecretKeySelector selects a key of a Secret. The namespace can only be set
+// on a ClusterSecretStore and defaults to the namespace of the store otherwise
+type SecretKeySelector struct {
+	// Name of the secret
+	Name string `json:"name"`
+	// Namespace of the secret
+	Namespace string `json:"namespace,omitempty"`
+	// Key in the secret
+	Key string `json:"key"`
+}
+
+// ServiceAccountSelector selects a ServiceAccount to request a token for
+type ServiceAccountSelector struct {
+	// Name of the ServiceAccount
+	Name string `json:"name"`
+	// Namespace of the ServiceAccount. Only used by a ClusterSecretStore
+	Namespace string `json:"namespace,omitempty"`
+	// Audience requested for the token. Defaults to the API server audience
+	Audience string `json:"audience,omitempty"`
+}
+
+// SecretStoreTLS holds the TLS settings of a store
+type SecretStoreTLS struct {
+	// CASecretRef selects a PEM bundle used to verify the server certificate
+	CASecretRef *SecretKeySelector `json:"caSecretRef,omitempty"`
+	// ClientCertSecretRef names a kubernetes.io/tls secret presented to the server
+	ClientCertSecretRef *SecretKeySelector `json:"clientCertSecretRef,omitempty"`
+	// ServerName overrides the name used to verify the server certificate
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificate
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// SecretStoreAuth holds the login methods of a store
+type SecretStoreAuth struct {
+	Token      *TokenAuth      `json:"token,omitempty"`
+	Kubernetes *KubernetesAuth `json:"kubernetes,omitempty"`
+	AppRole    *AppRoleAuth    `json:"appRole,omitempty"`
+	UserPass   *UserPassAuth   `json:"userPass,omitempty"`
+	JWT        *JWTAuth        `json:"jwt,omitempty"`
+	Cert       *CertAuth       `json:"cert,omitempty"`
+}
+
+// TokenAuth reads a static token from a secret
+type TokenAuth struct {
+	SecretRef SecretKeySelector `json:"secretRef"`
+}
+
+// KubernetesAuth logs in with a ServiceAccount token
+type KubernetesAuth struct {
+	// Role to log in with
+	Role string `json:"role"`
+	// MountPath of the auth method, defaults to kubernetes
+	MountPath string `json:"mountPath,omitempty"`
+	// ServiceAccountRef requests a token for this ServiceAccount. Defaults to
+	// the default ServiceAccount of a SecretStore, required in a ClusterSecretStore
+	ServiceAccountRef *ServiceAccountSelector `json:"serviceAccountRef,omitempty"`
+}
+
+// AppRoleAuth logs in with a role ID and a secret ID
+type AppRoleAuth struct {
+	RoleID string `json:"roleId"`
+	// SecretRef selects the secret ID
+	SecretRef SecretKeySelector `json:"secretRef"`
+	// MountPath of the auth method, defaults to approle
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// UserPassAuth logs in with a username and a password
+type UserPassAuth struct {
+	Username string `json:"username"`
+	// SecretRef selects the password
+	SecretRef SecretKeySelector `json:"secretRef"`
+	// MountPath of the auth method, defaults to userpass
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// JWTAuth logs in with a JWT. The token is read from SecretRef when set, or
+// else from a token requested for ServiceAccountRef
+type JWTAuth struct {
+	// Role to log in with
+	Role string `json:"role"`
+	// MountPath of the auth method, defaults to jwt
+	MountPath         string                  `json:"mountPath,omitempty"`
+	SecretRef         *SecretKeySelector      `json:"secretRef,omitempty"`
+	ServiceAccountRef *ServiceAccountSelector `json:"serviceAccountRef,omitempty"`
+}
+
+// CertAuth logs in with the client certificate from the TLS settings
+type CertAuth struct {
+	// Role is the name of the certificate role. Optional
+	Role string `json:"role,omitempty"`
+	// MountPath of the auth method, defaults to cert
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// ClusterSecretStoreSpec declares a server along with the namespaces allowed
+// to use it. A store matching no namespace cannot be used
+type ClusterSecretStoreSpec struct {
+	SecretStoreSpec `json:",inline"`
+	// Namespaces that may use the store. Shell patterns such as team-* are accepted
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the namespaces that may use the store by their labels
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+/*
+apiVersion: digitalis.io/v1beta1
+kind: ClusterSecretStore
+metadata:
+  name: shared
+spec:
+  backend: vault
+  address: https://vault.example.com:8200
+  namespaces: # shell patterns
+    - team-*
+  namespaceSelector: # optional: also match namespaces by label
+    matchLabels:
+      vault: shared
+  auth:
+    kubernetes:
+      role: shared
+      serviceAccountRef: # required
+        name: vault-auth
+        namespace: vault
+*/
+
+// SecretStoreRef points a secret at a SecretStore or ClusterSecretStore
+type SecretStoreRef struct {
+	// Name of the store
+	Name string `json:"name"`
+	// Kind is either SecretStore or ClusterSecretStore, defaults to SecretStore
+	// +kubebuilder:validation:Enum=SecretStore;ClusterSecretStore
+	Kind string `json:"kind,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SecretStore is the Schema for the secretstores API
+type SecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecretStoreSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SecretStoreList contains a list of SecretStore
+type SecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretStore `json:"items"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterSecretStore is the Schema for the clustersecretstores API
+type ClusterSecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterSecretStoreSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterSecretStoreList contains a list of ClusterSecretStore
+type ClusterSecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecretStore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretStore{}, &SecretStoreList{}, &ClusterSecretStore{}, &ClusterSecretStoreList{})
+}
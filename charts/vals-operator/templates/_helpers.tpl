@@ -50,6 +50,20 @@ app.kubernetes.io/name: {{ include "vals-operator.name" . }}
 app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
 
+{{/*
+Whether the DbSecret and CertSecret validating webhooks are served
+*/}}
+{{- define "vals-operator.webhookEnabled" -}}
+{{- if and (or .Values.enableDbSecrets .Values.enableCertSecrets) .Values.dbSecretPolicy.enforce .Values.dbSecretPolicy.webhook.enabled }}true{{- end }}
+{{- end }}
+
+{{/*
+Secret holding the webhook serving certificate
+*/}}
+{{- define "vals-operator.webhookSecretName" -}}
+{{- default (printf "%s-webhook-cert" (include "vals-operator.fullname" .)) .Values.dbSecretPolicy.webhook.secretName }}
+{{- end }}
+
 {{/*
 Create the name of the service account to use
 */}}
@@ -0,0 +1,561 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/maintenance"
+	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/policy"
+	"digitalis.io/vals-operator/utils"
+	"digitalis.io/vals-operator/vault"
+)
+
+// defaultRenewPercent is used when the CertSecret does not set renewPercent
+const defaultRenewPercent = 66
+
+// CertSecretReconciler reconciles a CertSecret object
+type CertSecretReconciler struct {
+	client.Client
+	Scheme               *runtime.Scheme
+	Log                  logr.Logger
+	Ctx                  context.Context
+	APIReader            client.Reader
+	ReconciliationPeriod time.Duration
+	ExcludeNamespaces    map[string]bool
+	RecordChanges        bool
+	Recorder             record.EventRecorder
+	// PolicyChecker enforces the certificates rules of DbSecretPolicies when set
+	PolicyChecker *policy.Checker
+	// Identities logs in with the ServiceAccount of the namespace when set
+	Identities *vault.IdentityPool
+	// Rollouts staggers the restarts of the workloads when set
+	Rollouts *RolloutQueue
+	// MaintenanceWindows hold renewals of certificates without windows of their own
+	MaintenanceWindows maintenance.Windows
+	// DryRun reports the changes instead of making them when set
+	DryRun *DryRun
+}
+
+//+kubebuilder:rbac:groups=digitalis.io,resources=certsecrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=digitalis.io,resources=certsecrets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=digitalis.io,resources=certsecrets/finalizers,verbs=update
+
+// Reconcile issues a certificate from the PKI secrets engine and keeps it
+// in a kubernetes.io/tls secret, re-issuing it before it expires
+func (r *CertSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var certSecret digitalisiov1beta1.CertSecret
+
+	err := r.Get(ctx, req.NamespacedName, &certSecret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			r.DryRun.forget("CertSecret", req.Namespace, req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if r.shouldExclude(certSecret.Namespace) {
+		r.Log.Info("Namespace requested is in the exclusion list, ignoring", "excluded_namespaces", r.ExcludeNamespaces)
+		return ctrl.Result{}, nil
+	}
+	secretName := r.getSecretName(&certSecret)
+	currentSecret, err := r.getSecret(secretName, certSecret.GetNamespace())
+	if client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := backendUnavailable(r.Identities); err != nil {
+		r.Log.Info("Waiting for the secrets backend", "name", certSecret.Name, "namespace", certSecret.Namespace, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: backendRetryPeriod}, nil
+	}
+
+	//! [finalizer]
+	certSecretFinalizerName := "certsecret.digitalis.io/finalizer"
+	if certSecret.ObjectMeta.DeletionTimestamp.IsZero() {
+		// without the finalizer a deletion is left to garbage collection in dry-run mode
+		if !utils.ContainsString(certSecret.GetFinalizers(), certSecretFinalizerName) && !r.DryRun.Enabled() {
+			certSecret.SetFinalizers(append(certSecret.GetFinalizers(), certSecretFinalizerName))
+			if err := r.Update(context.Background(), &certSecret); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		// The object is being deleted
+		if utils.ContainsString(certSecret.GetFinalizers(), certSecretFinalizerName) {
+			if r.DryRun.Enabled() {
+				r.dryRun(&certSecret, dryRunDeleteSecret, fmt.Sprintf("Would revoke the certificate, delete secret %s/%s and remove the finalizer", certSecret.Namespace, secretName))
+				return ctrl.Result{}, nil
+			}
+			if currentSecret != nil {
+				if err := r.revokeCertificate(ctx, &certSecret, currentSecret.Annotations[serialNumberLabel], currentSecret.Annotations[vaultNamespaceLabel]); err != nil {
+					// log the error but continue
+					r.Log.Error(err, "Certificate cannot be revoked", "name", certSecret.Name, "namespace", certSecret.Namespace)
+					dmetrics.CertSecretRevokationError.WithLabelValues(certSecret.Name, certSecret.Namespace).SetToCurrentTime()
+				}
+			}
+			if err := r.deleteSecret(ctx, &certSecret); err != nil {
+				r.Log.Error(err, "Error deleting certificate secret", "name", certSecret.Name, "namespace", certSecret.Namespace)
+				return ctrl.Result{}, client.IgnoreNotFound(err)
+			}
+
+			// remove our finalizer from the list and update it.
+			certSecret.SetFinalizers(utils.RemoveString(certSecret.GetFinalizers(), certSecretFinalizerName))
+			if err := r.Update(context.Background(), &certSecret); err != nil {
+				return ctrl.Result{}, err
+			}
+			/* mark as deleted in prom */
+			dmetrics.CertSecretExpireTime.WithLabelValues(certSecret.Name, certSecret.Namespace).Set(0)
+		}
+
+		// Stop reconciliation as the item is being deleted
+		r.Log.Info("Certificate deleted", "name", certSecret.Name, "namespace", certSecret.Namespace)
+		return ctrl.Result{}, nil
+	}
+	//! [finalizer]
+
+	if r.PolicyChecker != nil {
+		if err := r.PolicyChecker.CheckCertSecret(ctx, &certSecret); err != nil {
+			if !policy.IsDenied(err) {
+				return ctrl.Result{}, err
+			}
+			r.Log.Error(err, "CertSecret not allowed", "name", certSecret.Name, "namespace", certSecret.Namespace)
+			dmetrics.CertSecretPolicyDenied.WithLabelValues(certSecret.Name, certSecret.Namespace).SetToCurrentTime()
+			if r.recordingEnabled(&certSecret) {
+				r.Recorder.Event(&certSecret, corev1.EventTypeNormal, "Denied", err.Error())
+			}
+			// check again later in case the policies are changed
+			return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+		}
+	}
+
+	/* The gauge is also set for the certificate issued before the operator started */
+	var expires int64
+	if currentSecret != nil && currentSecret.Name != "" {
+		if expires, err = strconv.ParseInt(currentSecret.Annotations[expiresOnLabel], 10, 64); err == nil {
+			dmetrics.CertSecretExpireTime.WithLabelValues(certSecret.Name, certSecret.Namespace).Set(float64(expires))
+		}
+	}
+
+	if currentSecret != nil && currentSecret.Name != "" && !r.shouldIssue(&certSecret, currentSecret) {
+		return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+	}
+
+	/* A certificate still valid when the window opens can wait for it */
+	if currentSecret != nil && currentSecret.Name != "" {
+		if until := heldUntil(&certSecret, r.maintenanceWindows(&certSecret), time.Now()); !until.IsZero() && until.Unix() < expires {
+			return ctrl.Result{RequeueAfter: r.hold(ctx, &certSecret, until)}, nil
+		}
+	}
+
+	if r.DryRun.Enabled() {
+		r.dryRunIssue(ctx, &certSecret, currentSecret)
+		return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+	}
+
+	var cert vault.VaultCertificate
+	c, err := r.vaultClient(ctx, &certSecret)
+	if err == nil {
+		cert, err = vault.IssueCertificate(ctx, c.WithNamespace(certSecret.Spec.Vault.Namespace), certSecret.Spec.Vault.Role, certSecret.Spec.Vault.Mount, r.issueParams(&certSecret))
+	}
+	if err != nil {
+		r.Log.Error(err, "Failed to issue certificate", "name", certSecret.Name, "namespace", certSecret.Namespace)
+		dmetrics.CertSecretFailures.Inc()
+		dmetrics.CertSecretError.WithLabelValues(certSecret.Name, certSecret.Namespace).SetToCurrentTime()
+		if r.recordingEnabled(&certSecret) {
+			r.Recorder.Event(&certSecret, corev1.EventTypeNormal, "Failed", fmt.Sprintf("Certificate could not be issued: %v", err))
+		}
+		return ctrl.Result{}, err
+	}
+
+	change, err := r.upsertSecret(&certSecret, cert, currentSecret)
+	if err != nil {
+		r.Log.Error(err, "Failed to create secret", "name", certSecret.Name, "namespace", certSecret.Namespace)
+		dmetrics.CertSecretFailures.Inc()
+		dmetrics.CertSecretError.WithLabelValues(certSecret.Name, certSecret.Namespace).SetToCurrentTime()
+		// the new certificate is not stored anywhere so there is no point keeping it valid
+		if err := r.revokeCertificate(ctx, &certSecret, cert.SerialNumber, certSecret.Spec.Vault.Namespace); err != nil {
+			r.Log.Error(err, "Unused certificate could not be revoked", "name", certSecret.Name, "namespace", certSecret.Namespace)
+			dmetrics.CertSecretRevokationError.WithLabelValues(certSecret.Name, certSecret.Namespace).SetToCurrentTime()
+		}
+		return ctrl.Result{}, err
+	}
+	dmetrics.CertSecretError.WithLabelValues(certSecret.Name, certSecret.Namespace).Set(0)
+
+	/* The previous certificate is left to expire as the pods still use it until they are restarted */
+	releaseChanges(ctx, r.Client, r.Log, &certSecret, &certSecret.Status.PendingUntil)
+
+	/* Patching resources to force a rollout if required */
+	if change.changed() {
+		r.rollout(ctx, &certSecret, change)
+	}
+	return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+}
+
+// shouldIssue returns true when the certificate in the secret no longer
+// matches the spec or has gone past its renewal point
+func (r *CertSecretReconciler) shouldIssue(sDef *digitalisiov1beta1.CertSecret, currentSecret *corev1.Secret) bool {
+	if currentSecret.Annotations[templateHash] != r.specHash(sDef) {
+		r.Log.Info("Certificate request changed", "name", sDef.Name, "namespace", sDef.Namespace)
+		return true
+	}
+
+	issued, err := strconv.ParseInt(currentSecret.Annotations[issuedOnLabel], 10, 64)
+	if err != nil {
+		r.Log.Info("Updating certificate due to invalid issue time", "name", sDef.Name, "namespace", sDef.Namespace)
+		return true
+	}
+	expires, err := strconv.ParseInt(currentSecret.Annotations[expiresOnLabel], 10, 64)
+	if err != nil {
+		r.Log.Info("Updating certificate due to invalid expire time", "name", sDef.Name, "namespace", sDef.Namespace)
+		return true
+	}
+
+	renewAt := certRenewalTime(time.Unix(issued, 0), time.Unix(expires, 0), sDef.Spec.RenewPercent)
+	if !time.Now().Before(renewAt) {
+		r.Log.Info(fmt.Sprintf("Certificate in secret %s is due for renewal since %s", currentSecret.Name, renewAt.UTC().Format(timeLayout)))
+		return true
+	}
+	return false
+}
+
+// certRenewalTime returns the point in the certificate lifetime after which a
+// new one should be issued
+func certRenewalTime(issued time.Time, expires time.Time, percent int) time.Time {
+	if percent <= 0 || percent >= 100 {
+		percent = defaultRenewPercent
+	}
+	lifetime := expires.Sub(issued)
+	return issued.Add(lifetime * time.Duration(percent) / 100)
+}
+
+// issueParams builds the request sent to <mount>/issue/<role>
+func (r *CertSecretReconciler) issueParams(sDef *digitalisiov1beta1.CertSecret) map[string]interface{} {
+	params := map[string]interface{}{
+		"common_name": sDef.Spec.CommonName,
+	}
+	if len(sDef.Spec.AltNames) > 0 {
+		params["alt_names"] = strings.Join(sDef.Spec.AltNames, ",")
+	}
+	if len(sDef.Spec.IPSans) > 0 {
+		params["ip_sans"] = strings.Join(sDef.Spec.IPSans, ",")
+	}
+	if sDef.Spec.TTL != "" {
+		params["ttl"] = sDef.Spec.TTL
+	}
+	return params
+}
+
+// specHash is used to detect changes to the certificate request
+func (r *CertSecretReconciler) specHash(sDef *digitalisiov1beta1.CertSecret) string {
+	spec := map[string]string{
+		"mount":      sDef.Spec.Vault.Mount,
+		"role":       sDef.Spec.Vault.Role,
+		"commonName": sDef.Spec.CommonName,
+		"altNames":   strings.Join(sDef.Spec.AltNames, ","),
+		"ipSans":     strings.Join(sDef.Spec.IPSans, ","),
+		"ttl":        sDef.Spec.TTL,
+	}
+	// only hashed when set so existing certificates are not re-issued
+	if sDef.Spec.Vault.Namespace != "" {
+		spec["namespace"] = sDef.Spec.Vault.Namespace
+	}
+	return utils.SecretHashString(spec)
+}
+
+// revokeCertificate asks the PKI engine in the given Vault namespace to revoke the serial number
+func (r *CertSecretReconciler) revokeCertificate(ctx context.Context, sDef *digitalisiov1beta1.CertSecret, serial string, namespace string) error {
+	if serial == "" {
+		return nil
+	}
+	r.Log.Info("Revoking certificate", "serial", serial, "name", sDef.Name, "namespace", sDef.Namespace)
+	c, err := r.vaultClient(ctx, sDef)
+	if err != nil {
+		return err
+	}
+	return vault.RevokeCertificate(ctx, c.WithNamespace(namespace), sDef.Spec.Vault.Mount, serial)
+}
+
+// vaultClient returns the client issuing and revoking the certificates
+func (r *CertSecretReconciler) vaultClient(ctx context.Context, sDef *digitalisiov1beta1.CertSecret) (vault.SecretsClient, error) {
+	return secretsClient(ctx, r.Identities, sDef.Namespace, sDef.Spec.ServiceAccountName)
+}
+
+// upsertSecret will create or update the TLS secret. Returns the change to its data
+func (r *CertSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.CertSecret, cert vault.VaultCertificate, secret *corev1.Secret) (*secretChange, error) {
+	var err error
+
+	secretName := r.getSecretName(sDef)
+
+	if secret == nil {
+		secret = &corev1.Secret{}
+	}
+
+	data := map[string][]byte{
+		corev1.TLSCertKey:       []byte(cert.FullChain()),
+		corev1.TLSPrivateKeyKey: []byte(cert.PrivateKey),
+		"ca.crt":                []byte(cert.IssuingCA),
+	}
+	change := newSecretChange(secretName, secret.Data, data)
+	recordDataChange(secret, change)
+	secret.Data = data
+	secret.Name = secretName
+	secret.Namespace = sDef.Namespace
+	secret.Type = corev1.SecretTypeTLS
+	secret.ResourceVersion = ""
+
+	/* additional info */
+	if secret.ObjectMeta.Labels == nil {
+		secret.ObjectMeta.Labels = make(map[string]string)
+	}
+	if secret.ObjectMeta.Annotations == nil {
+		secret.ObjectMeta.Annotations = make(map[string]string)
+	}
+
+	utils.MergeMap(secret.ObjectMeta.Labels, sDef.ObjectMeta.Labels)
+	utils.MergeMap(secret.ObjectMeta.Annotations, sDef.ObjectMeta.Annotations)
+	secret.ObjectMeta.Labels[managedByLabel] = "vals-operator"
+	secret.ObjectMeta.Annotations[serialNumberLabel] = cert.SerialNumber
+	if sDef.Spec.Vault.Namespace != "" {
+		secret.ObjectMeta.Annotations[vaultNamespaceLabel] = sDef.Spec.Vault.Namespace
+	} else {
+		delete(secret.ObjectMeta.Annotations, vaultNamespaceLabel)
+	}
+	secret.ObjectMeta.Annotations[issuedOnLabel] = fmt.Sprintf("%d", time.Now().Unix())
+	secret.ObjectMeta.Annotations[expiresOnLabel] = fmt.Sprintf("%d", cert.Expiration)
+	secret.ObjectMeta.Annotations[lastUpdatedAnnotation] = time.Now().UTC().Format(timeLayout)
+	secret.ObjectMeta.Annotations[templateHash] = r.specHash(sDef)
+	delete(secret.ObjectMeta.Annotations, corev1.LastAppliedConfigAnnotation)
+
+	if err = controllerutil.SetControllerReference(sDef, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	r.Log.Info(fmt.Sprintf("Creating secret %s", secretName))
+
+	err = r.Create(r.Ctx, secret)
+	if errors.IsAlreadyExists(err) {
+		err = r.Update(r.Ctx, secret)
+	}
+
+	if err != nil {
+		if r.recordingEnabled(sDef) {
+			msg := fmt.Sprintf("Secret %s not saved %v", secret.Name, err)
+			r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", msg)
+		}
+		return nil, err
+	}
+
+	/* Prometheus */
+	dmetrics.CertSecretExpireTime.WithLabelValues(sDef.Name, sDef.Namespace).Set(float64(cert.Expiration))
+
+	if r.recordingEnabled(sDef) {
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "Updated", fmt.Sprintf("Certificate %s issued", cert.SerialNumber)+change.message())
+	}
+	r.Log.Info("Updated secret", "name", secretName, "serial", cert.SerialNumber)
+
+	return change, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CertSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("Secrets")
+	pred := predicate.GenerationChangedPredicate{}
+	if r.Rollouts != nil {
+		r.Rollouts.AddRecovery(r.recoverRollouts)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&digitalisiov1beta1.CertSecret{}).
+		Owns(&corev1.Secret{}).WithEventFilter(pred).
+		Complete(r)
+}
+
+// shouldExclude will return true if the secretDefinition is in an excluded namespace
+func (r *CertSecretReconciler) shouldExclude(sDefNamespace string) bool {
+	if len(r.ExcludeNamespaces) > 0 {
+		return r.ExcludeNamespaces[sDefNamespace]
+	}
+	return false
+}
+
+func (r *CertSecretReconciler) getSecret(secretName string, namespace string) (*corev1.Secret, error) {
+	var secret corev1.Secret
+
+	err := r.Get(r.Ctx, client.ObjectKey{
+		Namespace: namespace,
+		Name:      secretName,
+	}, &secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secret, nil
+}
+
+// deleteSecret will delete a secret given its namespace and name
+func (r *CertSecretReconciler) deleteSecret(ctx context.Context, sDef *digitalisiov1beta1.CertSecret) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: sDef.Namespace,
+			Name:      r.getSecretName(sDef),
+		},
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// recordingEnabled check if we want the event recorded
+func (r *CertSecretReconciler) recordingEnabled(sDef *digitalisiov1beta1.CertSecret) bool {
+	recordAnn := sDef.GetAnnotations()[recordingEnabledAnnotation]
+	if recordAnn != "" && recordAnn != "true" {
+		return false
+	}
+	return r.RecordChanges
+}
+
+// maintenanceWindows returns the windows changes to the secret are held until
+func (r *CertSecretReconciler) maintenanceWindows(sDef *digitalisiov1beta1.CertSecret) maintenance.Windows {
+	if len(sDef.Spec.MaintenanceWindows) == 0 {
+		return r.MaintenanceWindows
+	}
+	var windows maintenance.Windows
+	for _, w := range sDef.Spec.MaintenanceWindows {
+		window, err := maintenance.NewWindow(w.Schedule, w.Duration, w.TimeZone)
+		if err != nil {
+			r.Log.Error(err, "Ignoring the maintenance windows", "name", sDef.Name, "namespace", sDef.Namespace)
+			if r.recordingEnabled(sDef) {
+				r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", fmt.Sprintf("Invalid maintenance window: %v", err))
+			}
+			return nil
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// hold leaves the secret unchanged until the maintenance window opens
+func (r *CertSecretReconciler) hold(ctx context.Context, sDef *digitalisiov1beta1.CertSecret, until time.Time) time.Duration {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	return holdChanges(ctx, r.Client, r.Log, recorder, sDef, &sDef.Status.PendingUntil, until, r.ReconciliationPeriod)
+}
+
+// dryRun reports a change to the secret that is not made
+func (r *CertSecretReconciler) dryRun(sDef *digitalisiov1beta1.CertSecret, action, message string) {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	r.DryRun.report(recorder, sDef, "CertSecret", action, message)
+}
+
+// dryRunIssue reports the certificate that would be issued and the workloads
+// that would be restarted for it
+func (r *CertSecretReconciler) dryRunIssue(ctx context.Context, sDef *digitalisiov1beta1.CertSecret, currentSecret *corev1.Secret) {
+	secretName := r.getSecretName(sDef)
+	message := fmt.Sprintf("Would issue a certificate for role %s of mount %s into secret %s/%s", sDef.Spec.Vault.Role, sDef.Spec.Vault.Mount, sDef.Namespace, secretName)
+	r.dryRun(sDef, dryRunIssueCertificate, message)
+	if currentSecret == nil || currentSecret.Name == "" {
+		return
+	}
+	r.rollout(ctx, sDef, newSecretChange(secretName, currentSecret.Data, nil))
+}
+
+// rolloutPolicy returns how the restarts are staggered and whether the pods
+// are reloaded instead
+func (r *CertSecretReconciler) rolloutPolicy(sDef *digitalisiov1beta1.CertSecret) rolloutPolicy {
+	owner := "CertSecret/" + sDef.Namespace + "/" + sDef.Name
+	policy := rolloutPolicy{owner: owner}
+	if p := sDef.Spec.RolloutPolicy; p != nil {
+		var err error
+		policy, err = newRolloutPolicy(owner, p.MaxConcurrent, p.WaitForAvailable, p.MinInterval)
+		if err != nil {
+			r.Log.Error(err, "Ignoring the minimum interval", "name", sDef.Name, "namespace", sDef.Namespace)
+		}
+	}
+	policy.reload = sDef.Spec.RolloutStrategy == rolloutStrategyReload
+	if e := sDef.Spec.Reload; e != nil && policy.reload {
+		var err error
+		policy.endpoint, err = newReloadEndpoint(e.Port, e.Path, e.Method, e.Scheme, e.Delay)
+		if err != nil {
+			r.Log.Error(err, "Ignoring the reload delay", "name", sDef.Name, "namespace", sDef.Namespace)
+		}
+	}
+	policy.windows = rolloutWindows(sDef, r.maintenanceWindows(sDef))
+	return policy
+}
+
+// recoverRollouts queues again the restarts lost when the operator stopped
+func (r *CertSecretReconciler) recoverRollouts(ctx context.Context) {
+	if r.DryRun.Enabled() {
+		return
+	}
+	var list digitalisiov1beta1.CertSecretList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Cannot list the CertSecrets to recover their rollouts")
+		return
+	}
+	for i := range list.Items {
+		sDef := &list.Items[i]
+		if sDef.DeletionTimestamp != nil || r.shouldExclude(sDef.Namespace) {
+			continue
+		}
+		if len(sDef.Spec.Rollout) == 0 && sDef.Spec.RolloutMode != rolloutModeAuto {
+			continue
+		}
+		recoverRollout(ctx, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, r.getSecretName(sDef), dbWorkloads(sDef.Spec.Rollout))
+	}
+}
+
+// rollout is used to restart the workloads using the secret
+func (r *CertSecretReconciler) rollout(ctx context.Context, sDef *digitalisiov1beta1.CertSecret, change *secretChange) {
+	if r.DryRun.Enabled() {
+		if message := plannedRollout(ctx, r.APIReader, r.Log, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, dbWorkloads(sDef.Spec.Rollout)); message != "" {
+			r.dryRun(sDef, dryRunRollout, message)
+		}
+		return
+	}
+	skipped := rolloutSecret(ctx, r.Client, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, dbWorkloads(sDef.Spec.Rollout))
+	if len(skipped) > 0 && r.recordingEnabled(sDef) {
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "RolloutSkipped", skippedRollout(change.secret, skipped))
+	}
+}
+
+func (r *CertSecretReconciler) getSecretName(sDef *digitalisiov1beta1.CertSecret) string {
+	if sDef.Spec.SecretName != "" {
+		return sDef.Spec.SecretName
+	}
+	return sDef.Name
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/policy"
+	"digitalis.io/vals-operator/utils"
+	"digitalis.io/vals-operator/vault"
+)
+
+func TestCertRenewalTime(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	expires := issued.Add(90 * time.Hour)
+
+	tests := []struct {
+		name     string
+		percent  int
+		expected time.Time
+	}{
+		{
+			name:     "Default when unset",
+			percent:  0,
+			expected: issued.Add(90 * time.Hour * 66 / 100),
+		},
+		{
+			name:     "Half of the lifetime",
+			percent:  50,
+			expected: issued.Add(45 * time.Hour),
+		},
+		{
+			name:     "Out of range falls back to default",
+			percent:  100,
+			expected: issued.Add(90 * time.Hour * 66 / 100),
+		},
+		{
+			name:     "Negative falls back to default",
+			percent:  -10,
+			expected: issued.Add(90 * time.Hour * 66 / 100),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := certRenewalTime(issued, expires, tt.percent)
+			if !result.Equal(tt.expected) {
+				t.Errorf("Expected %v but got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSpecHashNamespace(t *testing.T) {
+	r := &CertSecretReconciler{}
+	sDef := &digitalisiov1beta1.CertSecret{
+		Spec: digitalisiov1beta1.CertSecretSpec{
+			CommonName: "app.example.com",
+			Vault:      digitalisiov1beta1.CertVaultConfig{Role: "app", Mount: "pki"},
+		},
+	}
+	legacy := utils.SecretHashString(map[string]string{
+		"mount":      "pki",
+		"role":       "app",
+		"commonName": "app.example.com",
+		"altNames":   "",
+		"ipSans":     "",
+		"ttl":        "",
+	})
+
+	if hash := r.specHash(sDef); hash != legacy {
+		t.Errorf("Expected %s but got %s", legacy, hash)
+	}
+	sDef.Spec.Vault.Namespace = "bu1"
+	if hash := r.specHash(sDef); hash == legacy {
+		t.Error("Expected the hash to change with the namespace")
+	}
+}
+
+// pkiClient issues certificates with the given serial number and records the
+// revoked ones
+type pkiClient struct {
+	vault.SecretsClient
+	serial     string
+	expiration int64
+	revoked    []string
+}
+
+func (c *pkiClient) Write(ctx context.Context, path string, data map[string]interface{}) (*vault.SecretResponse, error) {
+	switch {
+	case strings.HasSuffix(path, "/revoke"):
+		c.revoked = append(c.revoked, fmt.Sprint(data["serial_number"]))
+		return nil, nil
+	case strings.Contains(path, "/issue/"):
+		return &vault.SecretResponse{Data: map[string]interface{}{
+			"certificate":   "certificate " + c.serial,
+			"private_key":   "key",
+			"issuing_ca":    "ca",
+			"serial_number": c.serial,
+			"expiration":    c.expiration,
+		}}, nil
+	}
+	return c.SecretsClient.Write(ctx, path, data)
+}
+
+func (c *pkiClient) WithNamespace(namespace string) vault.SecretsClient {
+	return c
+}
+
+// testIdentities logs every namespace in with the given client
+func testIdentities(c vault.SecretsClient) *vault.IdentityPool {
+	return vault.NewIdentityPool(vault.IdentityConfig{
+		TokenSource: func(ctx context.Context, namespace, serviceAccount string) (string, error) {
+			return "jwt", nil
+		},
+		NewClient: func() (vault.SecretsClient, error) {
+			return c, nil
+		},
+	})
+}
+
+func TestCertSecretReconcileIssue(t *testing.T) {
+	certSecret := func() *digitalisiov1beta1.CertSecret {
+		return &digitalisiov1beta1.CertSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "app",
+				Namespace:  "default",
+				Finalizers: []string{"certsecret.digitalis.io/finalizer"},
+			},
+			Spec: digitalisiov1beta1.CertSecretSpec{
+				SecretName: "app-tls",
+				CommonName: "app.example.com",
+				Vault:      digitalisiov1beta1.CertVaultConfig{Role: "app", Mount: "pki"},
+			},
+		}
+	}
+	current := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app-tls",
+			Namespace:   "default",
+			Annotations: map[string]string{serialNumberLabel: "old", templateHash: "outdated"},
+		},
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("certificate old")},
+	}
+	failSecrets := interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if _, ok := obj.(*corev1.Secret); ok {
+				return fmt.Errorf("secrets are read-only")
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}
+	expiration := time.Now().Add(time.Hour).Unix()
+	// issued before the operator started and not due for renewal
+	valid := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-tls",
+			Namespace: "default",
+			Annotations: map[string]string{
+				serialNumberLabel: "old",
+				templateHash:      (&CertSecretReconciler{}).specHash(certSecret()),
+				issuedOnLabel:     fmt.Sprint(time.Now().Unix()),
+				expiresOnLabel:    fmt.Sprint(expiration),
+			},
+		},
+		Data: map[string][]byte{corev1.TLSCertKey: []byte("certificate old")},
+	}
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+		funcs   interceptor.Funcs
+		wantErr bool
+		revoked string
+		serial  string
+	}{
+		{name: "Renewal leaves the old certificate to expire", objects: []client.Object{current}, serial: "new"},
+		{name: "Valid certificate kept", objects: []client.Object{valid}, serial: "old"},
+		{name: "Unsaved certificate is revoked", funcs: failSecrets, wantErr: true, revoked: "new"},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sDef := certSecret()
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(append([]client.Object{sDef}, tt.objects...)...).
+				WithInterceptorFuncs(tt.funcs).
+				Build()
+			pki := &pkiClient{SecretsClient: vault.NewMemoryBackend().Client(), serial: "new", expiration: expiration}
+			r := &CertSecretReconciler{
+				Client:        c,
+				Scheme:        scheme,
+				Ctx:           context.Background(),
+				Log:           logr.Discard(),
+				Recorder:      record.NewFakeRecorder(10),
+				RecordChanges: true,
+				Identities:    testIdentities(pki),
+			}
+			dmetrics.CertSecretError.WithLabelValues("app", "default").Set(0)
+			dmetrics.CertSecretExpireTime.WithLabelValues("app", "default").Set(0)
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v but got %v", tt.wantErr, err)
+			}
+			if strings.Join(pki.revoked, ",") != tt.revoked {
+				t.Errorf("Expected %s to be revoked but got %v", tt.revoked, pki.revoked)
+			}
+			failed := testutil.ToFloat64(dmetrics.CertSecretError.WithLabelValues("app", "default")) > 0
+			if failed != tt.wantErr {
+				t.Errorf("Expected the error metric of the CertSecret to be set %v but got %v", tt.wantErr, failed)
+			}
+			if tt.wantErr {
+				return
+			}
+			secret := &corev1.Secret{}
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app-tls"}, secret); err != nil {
+				t.Fatal(err)
+			}
+			if serial := secret.Annotations[serialNumberLabel]; serial != tt.serial {
+				t.Errorf("Expected serial %s but got %s", tt.serial, serial)
+			}
+			if got := testutil.ToFloat64(dmetrics.CertSecretExpireTime.WithLabelValues("app", "default")); got != float64(expiration) {
+				t.Errorf("Expected the expiry metric of the CertSecret to be %d but got %v", expiration, got)
+			}
+		})
+	}
+}
+
+func TestCertSecretReconcilePolicy(t *testing.T) {
+	dbPolicy := &digitalisiov1beta1.DbSecretPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: digitalisiov1beta1.DbSecretPolicySpec{
+			Namespaces:   []string{"default"},
+			Allow:        []digitalisiov1beta1.DbSecretPolicyRule{{Mount: "*", Role: "*"}},
+			Certificates: []digitalisiov1beta1.DbSecretPolicyRule{{Mount: "pki", Role: "app"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		role    string
+		allowed bool
+	}{
+		{name: "Allowed role is issued", role: "app", allowed: true},
+		{name: "Database rules do not allow certificates", role: "admin", allowed: false},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sDef := &digitalisiov1beta1.CertSecret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "app",
+					Namespace:  "default",
+					Finalizers: []string{"certsecret.digitalis.io/finalizer"},
+				},
+				Spec: digitalisiov1beta1.CertSecretSpec{
+					CommonName: "app.example.com",
+					Vault:      digitalisiov1beta1.CertVaultConfig{Role: tt.role, Mount: "pki"},
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sDef, dbPolicy).Build()
+			pki := &pkiClient{SecretsClient: vault.NewMemoryBackend().Client(), serial: "new", expiration: time.Now().Add(time.Hour).Unix()}
+			r := &CertSecretReconciler{
+				Client:        c,
+				Scheme:        scheme,
+				Ctx:           context.Background(),
+				Log:           logr.Discard(),
+				Recorder:      record.NewFakeRecorder(10),
+				PolicyChecker: &policy.Checker{Reader: c},
+				Identities:    testIdentities(pki),
+			}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}}); err != nil {
+				t.Fatal(err)
+			}
+			err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, &corev1.Secret{})
+			if issued := err == nil; issued != tt.allowed {
+				t.Errorf("Expected the certificate to be issued %v but got %v", tt.allowed, issued)
+			}
+		})
+	}
+}
@@ -17,11 +17,20 @@ package controllers
 
 const (
 	leaseIdLabel               = "vals-operator.digitalis.io/lease-id"
+	previousLeaseIdLabel       = "vals-operator.digitalis.io/previous-lease-id"
 	leaseDurationLabel         = "vals-operator.digitalis.io/lease-duration"
 	expiresOnLabel             = "vals-operator.digitalis.io/expires-on"
+	issuedOnLabel              = "vals-operator.digitalis.io/issued-on"
+	serialNumberLabel          = "vals-operator.digitalis.io/serial-number"
+	vaultNamespaceLabel        = "vals-operator.digitalis.io/vault-namespace"
+	secretStoreLabel           = "vals-operator.digitalis.io/secret-store"
 	restartedAnnotation        = "vals-operator.digitalis.io/restartedAt"
+	secretHashPrefix           = "secret-hash.vals-operator.digitalis.io/"
+	reloadedAnnotation         = "vals-operator.digitalis.io/reloadedAt"
+	reloadResultAnnotation     = "vals-operator.digitalis.io/reload-result"
 	timeLayout                 = "2006-01-02T15.04.05Z"
 	lastUpdatedAnnotation      = "vals-operator.digitalis.io/last-updated"
+	dataChangedAnnotation      = "vals-operator.digitalis.io/data-changed"
 	recordingEnabledAnnotation = "vals-operator.digitalis.io/record"
 	forceCreateAnnotation      = "vals-operator.digitalis.io/force"
 	templateHash               = "vals-operator.digitalis.io/hash"
@@ -0,0 +1,444 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutModeAuto restarts the workloads using the secret on top of those
+// listed in rollout
+const rolloutModeAuto = "auto"
+
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=list
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+
+// secretUsage records how a pod spec uses a secret
+type secretUsage struct {
+	// all is set when every key is used, as with envFrom or a volume
+	// without items
+	all bool
+	// keys read one by one with secretKeyRef or volume items
+	keys map[string]bool
+}
+
+func (u secretUsage) used() bool {
+	return u.all || len(u.keys) > 0
+}
+
+// podSecretUsage returns how the pod spec uses the secret through envFrom,
+// env, secret and projected volumes or imagePullSecrets
+func podSecretUsage(spec *corev1.PodSpec, secretName string) secretUsage {
+	u := secretUsage{keys: make(map[string]bool)}
+	useItems := func(items []corev1.KeyToPath) {
+		if len(items) == 0 {
+			u.all = true
+		}
+		for _, item := range items {
+			u.keys[item.Key] = true
+		}
+	}
+	useEnv := func(envFrom []corev1.EnvFromSource, env []corev1.EnvVar) {
+		for _, e := range envFrom {
+			if e.SecretRef != nil && e.SecretRef.Name == secretName {
+				u.all = true
+			}
+		}
+		for _, e := range env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil && e.ValueFrom.SecretKeyRef.Name == secretName {
+				u.keys[e.ValueFrom.SecretKeyRef.Key] = true
+			}
+		}
+	}
+
+	for _, c := range spec.InitContainers {
+		useEnv(c.EnvFrom, c.Env)
+	}
+	for _, c := range spec.Containers {
+		useEnv(c.EnvFrom, c.Env)
+	}
+	for _, c := range spec.EphemeralContainers {
+		useEnv(c.EnvFrom, c.Env)
+	}
+	for _, v := range spec.Volumes {
+		if v.Secret != nil && v.Secret.SecretName == secretName {
+			useItems(v.Secret.Items)
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secretName {
+					useItems(source.Secret.Items)
+				}
+			}
+		}
+	}
+	for _, s := range spec.ImagePullSecrets {
+		if s.Name == secretName {
+			u.all = true
+		}
+	}
+	return u
+}
+
+// secretConsumers returns the Deployments, StatefulSets and DaemonSets of the
+// namespace using the secret. Pods created by a ReplicaSet, StatefulSet,
+// DaemonSet or Job are left to their workload. Pods without a controller
+// cannot be restarted and Pods managed by any other controller, such as a
+// database operator, are not restarted behind its back: they are returned as
+// skipped instead, by controller.
+func secretConsumers(ctx context.Context, reader client.Reader, namespace, secretName string) ([]workloadRef, []string, error) {
+	var found []workloadRef
+	add := func(kind, name string, spec *corev1.PodSpec) {
+		if podSecretUsage(spec, secretName).used() {
+			found = append(found, workloadRef{Kind: kind, Name: name})
+		}
+	}
+
+	var deployments appsv1.DeploymentList
+	if err := reader.List(ctx, &deployments, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("cannot list Deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		add("Deployment", deployments.Items[i].Name, &deployments.Items[i].Spec.Template.Spec)
+	}
+	var statefulSets appsv1.StatefulSetList
+	if err := reader.List(ctx, &statefulSets, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("cannot list StatefulSets: %w", err)
+	}
+	for i := range statefulSets.Items {
+		add("StatefulSet", statefulSets.Items[i].Name, &statefulSets.Items[i].Spec.Template.Spec)
+	}
+	var daemonSets appsv1.DaemonSetList
+	if err := reader.List(ctx, &daemonSets, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("cannot list DaemonSets: %w", err)
+	}
+	for i := range daemonSets.Items {
+		add("DaemonSet", daemonSets.Items[i].Name, &daemonSets.Items[i].Spec.Template.Spec)
+	}
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("cannot list Pods: %w", err)
+	}
+	var skipped []string
+	seen := make(map[string]bool)
+	for i := range pods.Items {
+		name := "Pod/" + pods.Items[i].Name + " (no controller)"
+		if owner := metav1.GetControllerOf(&pods.Items[i]); owner != nil {
+			switch owner.Kind {
+			case "ReplicaSet", "StatefulSet", "DaemonSet", "Job":
+				continue
+			}
+			name = owner.Kind + "/" + owner.Name
+		}
+		if !seen[name] && podSecretUsage(&pods.Items[i].Spec, secretName).used() {
+			seen[name] = true
+			skipped = append(skipped, name)
+		}
+	}
+	sort.Strings(skipped)
+	return found, skipped, nil
+}
+
+// secretChange is a change to the data of a secret
+type secretChange struct {
+	secret string
+	// keys added, removed or updated
+	keys []string
+	// hash of the new data, recorded on the restarted workloads
+	hash string
+	// hashes of the new value of every key, to record the hash of only the
+	// keys a workload uses
+	hashes map[string]string
+}
+
+// newSecretChange compares the data of a secret before and after an update
+func newSecretChange(secret string, oldData, newData map[string][]byte) *secretChange {
+	hashes := keyHashes(newData)
+	return &secretChange{
+		secret: secret,
+		keys:   changedKeys(oldData, newData),
+		hash:   hashOf(hashes, nil),
+		hashes: hashes,
+	}
+}
+
+// hashFor returns the hash recorded on a workload with the pod spec: the hash
+// of the keys it reads one by one, or of the whole secret when it uses all of
+// it, does not use it directly or its spec is not known
+func (c *secretChange) hashFor(spec *corev1.PodSpec) string {
+	if c.hashes == nil || spec == nil {
+		return c.hash
+	}
+	return usedHash(c.hashes, podSecretUsage(spec, c.secret))
+}
+
+// hashValues returns the hash annotations recording the changes on a workload
+// with the pod spec
+func hashValues(changes []*secretChange, spec *corev1.PodSpec) map[string]string {
+	values := make(map[string]string)
+	for _, change := range changes {
+		if change != nil && change.hash != "" {
+			values[hashAnnotation(change.secret)] = change.hashFor(spec)
+		}
+	}
+	return values
+}
+
+// recordDataChange records on the secret when change replaced its data, so
+// that workloads which started before and were never restarted for it are not
+// taken as current. It is called before the data is replaced. A new secret
+// has no older data to run.
+func recordDataChange(secret *corev1.Secret, change *secretChange) {
+	if len(secret.Data) == 0 || !change.changed() {
+		return
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[dataChangedAnnotation] = time.Now().UTC().Format(timeLayout)
+}
+
+// changed reports whether any key was added, removed or updated
+func (c *secretChange) changed() bool {
+	return c != nil && len(c.keys) > 0
+}
+
+// dataHash returns a stable hash of the keys and values of a secret
+func dataHash(data map[string][]byte) string {
+	return hashOf(keyHashes(data), nil)
+}
+
+// keyHashes returns the hash of the value of every key, keyed with the hash
+// key of the operator
+func keyHashes(data map[string][]byte) map[string]string {
+	return valueHashes(data, hashKey)
+}
+
+// hashOf returns a stable hash of the keys and the hashes of their values,
+// only of the given keys when set
+func hashOf(hashes map[string]string, only map[string]bool) string {
+	keys := make([]string, 0, len(hashes))
+	for k := range hashes {
+		if only == nil || only[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		// lengths keep {"ab": "c"} and {"a": "bc"} apart
+		fmt.Fprintf(h, "%d:%s%s:", len(k), k, hashes[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// usedHash returns the hash of the keys read one by one, or of the whole
+// secret when every key or none is used directly
+func usedHash(hashes map[string]string, u secretUsage) string {
+	if u.all || !u.used() {
+		return hashOf(hashes, nil)
+	}
+	return hashOf(hashes, u.keys)
+}
+
+// hashAnnotation returns the annotation recording the hash of the secret on
+// the workloads restarted for it. Each secret has its own so that workloads
+// using several secrets are not restarted back and forth.
+func hashAnnotation(secret string) string {
+	name := secret
+	if len(name) > 63 {
+		sum := sha256.Sum256([]byte(secret))
+		name = strings.TrimRight(name[:54], "-.") + "-" + hex.EncodeToString(sum[:4])
+	}
+	return secretHashPrefix + name
+}
+
+// changedKeys returns the sorted keys added, removed or updated
+func changedKeys(oldData, newData map[string][]byte) []string {
+	var keys []string
+	for k, v := range newData {
+		if old, ok := oldData[k]; !ok || !bytes.Equal(old, v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range oldData {
+		if _, ok := newData[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// message lists the changed keys for events, never their values
+func (c *secretChange) message() string {
+	if !c.changed() {
+		return ""
+	}
+	return ", changed keys: " + strings.Join(c.keys, ", ")
+}
+
+// affects reports whether a workload with the pod spec at specPath has to be
+// restarted. Only workloads reading some keys with secretKeyRef or volume items,
+// none of which changed, are left alone. Those using the whole secret, not
+// using it directly or whose pod spec cannot be read are restarted.
+func (c *secretChange) affects(object *unstructured.Unstructured, specPath []string) bool {
+	if c == nil {
+		return true
+	}
+	spec := podSpecAt(object, specPath)
+	if spec == nil {
+		return true
+	}
+	u := podSecretUsage(spec, c.secret)
+	if u.all || !u.used() {
+		return true
+	}
+	for _, k := range c.keys {
+		if u.keys[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// podSpecAt returns the pod spec of the object at specPath, nil when it
+// cannot be read
+func podSpecAt(object *unstructured.Unstructured, specPath []string) *corev1.PodSpec {
+	raw, found, err := unstructured.NestedMap(object.Object, specPath...)
+	if err != nil || !found {
+		return nil
+	}
+	var spec corev1.PodSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+		return nil
+	}
+	return &spec
+}
+
+// rolloutTargets returns the workloads listed in rollout and, in auto mode,
+// the ones using the secret, without duplicates. It also returns the
+// controllers whose Pods use the secret but are not restarted.
+func rolloutTargets(ctx context.Context, reader client.Reader, log logr.Logger, namespace, mode, secretName string, targets []workloadRef) ([]workloadRef, []string) {
+	var skipped []string
+	if mode == rolloutModeAuto {
+		var found []workloadRef
+		var err error
+		found, skipped, err = secretConsumers(ctx, reader, namespace, secretName)
+		if err != nil {
+			log.Error(err, "Could not find the workloads using the secret", "secret", secretName, "namespace", namespace)
+		}
+		targets = append(targets, found...)
+	}
+
+	seen := make(map[string]bool)
+	var unique []workloadRef
+	for _, target := range targets {
+		if target.Name == "" || target.Kind == "" {
+			continue
+		}
+		key := strings.ToLower(target.APIVersion + "/" + target.Kind + "/" + target.Name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, target)
+	}
+	return unique, skipped
+}
+
+// rolloutSecret restarts the workloads listed in rollout and, in auto mode,
+// the ones using the secret, unless they only use keys that did not change.
+// The restarts are staggered by the queue when there is one, which is also
+// needed to call the reload endpoint of the pods. It returns the controllers
+// whose Pods use the secret but are left for the user to restart.
+func rolloutSecret(ctx context.Context, c client.Client, reader client.Reader, log logr.Logger, queue *RolloutQueue, policy rolloutPolicy, namespace, mode string, change *secretChange, targets []workloadRef) []string {
+	secretName := change.secret
+	found, skipped := rolloutTargets(ctx, reader, log, namespace, mode, secretName, targets)
+	if len(skipped) > 0 {
+		log.Info(skippedRollout(secretName, skipped), "namespace", namespace)
+	}
+	for _, target := range found {
+		if queue != nil {
+			queue.Enqueue(namespace, target, change, policy)
+			continue
+		}
+		var err error
+		if policy.reload {
+			_, err = reloadWorkload(ctx, c, nil, log, namespace, target, policy.endpoint, change)
+		} else {
+			_, err = restartWorkload(ctx, c, log, namespace, target, change)
+		}
+		if err != nil {
+			log.Error(err, "Could not perform rollout",
+				"secret", secretName,
+				"namespace", namespace,
+				"kind", target.Kind,
+				"name", target.Name)
+		}
+	}
+	return skipped
+}
+
+// skippedRollout describes the Pods left out of a rollout
+func skippedRollout(secretName string, skipped []string) string {
+	return fmt.Sprintf("Not restarting the Pods of %s using secret %s, restart them through their controller or recreate them", strings.Join(skipped, ", "), secretName)
+}
+
+// recoverRollout queues again the restarts of the workloads recorded for an
+// older version of the secret, which were lost when the operator stopped
+// before making them. The changed keys are not known any more so every key
+// is taken as changed. Workloads never restarted for the secret are left alone.
+func recoverRollout(ctx context.Context, reader client.Reader, log logr.Logger, queue *RolloutQueue, policy rolloutPolicy, namespace, mode, secretName string, targets []workloadRef) {
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretName}, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			log.Error(err, "Cannot read the secret to recover its rollout", "secret", secretName, "namespace", namespace)
+		}
+		return
+	}
+	change := newSecretChange(secretName, nil, secret.Data)
+	found, _ := rolloutTargets(ctx, reader, log, namespace, mode, secretName, targets)
+	for _, target := range found {
+		state, err := consumerStateOf(ctx, reader, namespace, secretName, secret, policy.reload, target)
+		if err != nil {
+			log.Error(err, "Cannot recover the rollout", "secret", secretName, "namespace", namespace, "kind", target.Kind, "name", target.Name)
+			continue
+		}
+		if state.current() {
+			continue
+		}
+		log.Info(fmt.Sprintf("Queueing the restart of %s/%s in namespace %s, it still uses an older version of secret %s", target.Kind, target.Name, namespace, secretName))
+		queue.Enqueue(namespace, target, change, policy)
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPodSecretUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		all  bool
+		keys string
+	}{
+		{name: "Unused", spec: corev1.PodSpec{Containers: []corev1.Container{{
+			EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "other"}}}},
+		}}}},
+		{name: "envFrom", all: true, spec: corev1.PodSpec{Containers: []corev1.Container{{
+			EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}},
+		}}}},
+		{name: "secretKeyRef in an init container", keys: "password,username", spec: corev1.PodSpec{InitContainers: []corev1.Container{{
+			Env: []corev1.EnvVar{
+				{Name: "USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: "username"}}},
+				{Name: "PASS", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: "password"}}},
+				{Name: "OTHER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "other"}, Key: "token"}}},
+			},
+		}}}},
+		{name: "Secret volume", all: true, spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "app"}},
+		}}}},
+		{name: "Projected volume items", keys: "tls.crt", spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{{
+				Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Items: []corev1.KeyToPath{{Key: "tls.crt", Path: "cert"}}},
+			}}}},
+		}}}},
+		{name: "imagePullSecrets", all: true, spec: corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "app"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := podSecretUsage(&tt.spec, "app")
+			var keys []string
+			for k := range u.keys {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if u.all != tt.all || strings.Join(keys, ",") != tt.keys {
+				t.Errorf("Expected all=%v keys=%q but got all=%v keys=%q", tt.all, tt.keys, u.all, strings.Join(keys, ","))
+			}
+		})
+	}
+}
+
+func TestSecretConsumers(t *testing.T) {
+	usesSecret := corev1.PodSpec{Volumes: []corev1.Volume{{
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "app"}},
+	}}}
+	template := corev1.PodTemplateSpec{Spec: usesSecret}
+	meta := func(name string, owners ...metav1.OwnerReference) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: owners}
+	}
+	controller := true
+	ownedBy := func(kind string) metav1.OwnerReference {
+		return metav1.OwnerReference{APIVersion: "apps/v1", Kind: kind, Name: "owner", UID: "1", Controller: &controller}
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.Deployment{ObjectMeta: meta("web"), Spec: appsv1.DeploymentSpec{Template: template}},
+		&appsv1.Deployment{ObjectMeta: meta("unrelated")},
+		&appsv1.StatefulSet{ObjectMeta: meta("db"), Spec: appsv1.StatefulSetSpec{Template: template}},
+		&appsv1.DaemonSet{ObjectMeta: meta("agent"), Spec: appsv1.DaemonSetSpec{Template: template}},
+		&corev1.Pod{ObjectMeta: meta("web-abc", ownedBy("ReplicaSet")), Spec: usesSecret},
+		&corev1.Pod{ObjectMeta: meta("custom", metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Widget", Name: "w", UID: "2", Controller: &controller}), Spec: usesSecret},
+		&corev1.Pod{ObjectMeta: meta("custom-2", metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Widget", Name: "w", UID: "2", Controller: &controller}), Spec: usesSecret},
+		&corev1.Pod{ObjectMeta: meta("other", metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Widget", Name: "x", UID: "3", Controller: &controller})},
+		&corev1.Pod{ObjectMeta: meta("debug"), Spec: usesSecret},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "elsewhere", Namespace: "other"}, Spec: appsv1.DeploymentSpec{Template: template}},
+	).Build()
+
+	found, skipped, err := secretConsumers(context.Background(), c, "default", "app")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var names []string
+	for _, w := range found {
+		names = append(names, w.Kind+"/"+w.Name)
+	}
+	sort.Strings(names)
+	expected := "DaemonSet/agent,Deployment/web,StatefulSet/db"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("Expected %s but got %s", expected, strings.Join(names, ","))
+	}
+	if strings.Join(skipped, ",") != "Pod/debug (no controller),Widget/w" {
+		t.Errorf("Expected Pod/debug and Widget/w to be skipped but got %v", skipped)
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      map[string][]byte
+		new      map[string][]byte
+		expected string
+	}{
+		{name: "Created", new: map[string][]byte{"b": []byte("1"), "a": []byte("2")}, expected: "a,b"},
+		{name: "Unchanged", old: map[string][]byte{"a": []byte("1")}, new: map[string][]byte{"a": []byte("1")}},
+		{name: "Updated", old: map[string][]byte{"a": []byte("1"), "b": []byte("2")}, new: map[string][]byte{"a": []byte("1"), "b": []byte("3")}, expected: "b"},
+		{name: "Added and removed", old: map[string][]byte{"a": []byte("1"), "b": []byte("2")}, new: map[string][]byte{"a": []byte("1"), "c": []byte("2")}, expected: "b,c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if keys := strings.Join(changedKeys(tt.old, tt.new), ","); keys != tt.expected {
+				t.Errorf("Expected %q but got %q", tt.expected, keys)
+			}
+		})
+	}
+}
+
+func TestDataHash(t *testing.T) {
+	a := dataHash(map[string][]byte{"ab": []byte("c"), "d": []byte("e")})
+	if b := dataHash(map[string][]byte{"d": []byte("e"), "ab": []byte("c")}); a != b {
+		t.Errorf("Expected the same hash but got %s and %s", a, b)
+	}
+	if b := dataHash(map[string][]byte{"a": []byte("bc"), "d": []byte("e")}); a == b {
+		t.Errorf("Expected a different hash but got %s", b)
+	}
+
+	long := strings.Repeat("a", 100)
+	key := hashAnnotation(long)
+	if name := strings.TrimPrefix(key, secretHashPrefix); len(name) > 63 || key == hashAnnotation(long+"b") {
+		t.Errorf("Expected a unique name of at most 63 characters but got %s", key)
+	}
+}
+
+func TestRolloutChangedKeys(t *testing.T) {
+	keyRef := func(key string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Env: []corev1.EnvVar{{Name: "VALUE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: key}}}},
+		}}}}
+	}
+	envFrom := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}},
+	}}}}
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.Deployment{ObjectMeta: meta("password"), Spec: appsv1.DeploymentSpec{Template: keyRef("password")}},
+		&appsv1.Deployment{ObjectMeta: meta("username"), Spec: appsv1.DeploymentSpec{Template: keyRef("username")}},
+		&appsv1.Deployment{ObjectMeta: meta("all"), Spec: appsv1.DeploymentSpec{Template: envFrom}},
+		// listed in rollout without using the secret directly
+		&appsv1.Deployment{ObjectMeta: meta("listed")},
+	).Build()
+
+	ctx := context.Background()
+	targets := []workloadRef{{Kind: "Deployment", Name: "listed"}}
+	rolloutSecret(ctx, c, c, logr.Discard(), nil, rolloutPolicy{}, "default", rolloutModeAuto, &secretChange{secret: "app", keys: []string{"password"}}, targets)
+
+	expected := map[string]bool{"password": true, "username": false, "all": true, "listed": true}
+	for name, restarted := range expected {
+		d := &appsv1.Deployment{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, d); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := d.Spec.Template.Annotations[restartedAnnotation]; ok != restarted {
+			t.Errorf("Expected Deployment/%s restarted=%v but got %v", name, restarted, ok)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// consumersConverged is the condition telling whether every workload using
+// the secret runs the version it was restarted for
+const consumersConverged = "ConsumersConverged"
+
+// consumerState is how far a workload restarted for the secret has rolled out
+type consumerState struct {
+	target workloadRef
+	// hash of the secret the workload was last restarted or reloaded for
+	hash string
+	// hash it has to record for the current data of the secret, of the keys
+	// it uses
+	expected string
+	// predates is set when the workload records no hash and some of its pods
+	// started before the data of the secret last changed
+	predates bool
+	pods     int32
+	updated  int32
+}
+
+// current reports whether the workload was last restarted for the current
+// data of the secret. Workloads never restarted for it are taken as current
+// unless they started before the data last changed, as when their first
+// restart failed.
+func (s consumerState) current() bool {
+	if s.expected == "" {
+		return true
+	}
+	if s.hash == "" {
+		return !s.predates
+	}
+	return s.hash == s.expected
+}
+
+func (s consumerState) converged() bool {
+	return s.current() && s.updated >= s.pods
+}
+
+// consumerStates returns the state of every workload. A workload that cannot
+// be read is reported as stale so that it is looked at.
+func consumerStates(ctx context.Context, reader client.Reader, namespace, secretName string, reload bool, targets []workloadRef) ([]consumerState, error) {
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: secretName}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("cannot read secret %s: %w", secretName, err)
+	}
+	if err != nil {
+		secret = nil
+	}
+
+	var states []consumerState
+	var errs []string
+	for _, target := range targets {
+		state, err := consumerStateOf(ctx, reader, namespace, secretName, secret, reload, target)
+		if err != nil {
+			errs = append(errs, err.Error())
+			state = consumerState{target: target, pods: 1}
+		}
+		states = append(states, state)
+	}
+	if len(errs) > 0 {
+		return states, fmt.Errorf("cannot read the consumers of %s: %s", secretName, strings.Join(errs, "; "))
+	}
+	return states, nil
+}
+
+// consumerStateOf counts the pods of the workload running its latest version
+// of the secret, and compares that version with the hash of the keys it uses
+// in the current data of the secret, nil when it does not exist. Restarted
+// workloads record the hash on their pod template, which their new pods copy,
+// while reloaded pods are annotated one by one. Pods of workloads recording no
+// hash are compared with the time the data last changed instead. CronJobs
+// have no pods to wait for and Argo Rollouts, which keep the hash on the
+// Rollout itself, are converged once Available.
+func consumerStateOf(ctx context.Context, reader client.Reader, namespace, secretName string, secret *corev1.Secret, reload bool, target workloadRef) (consumerState, error) {
+	state := consumerState{target: target}
+	annotation := hashAnnotation(secretName)
+	var hashes map[string]string
+	var changedAt time.Time
+	if secret != nil {
+		hashes = keyHashes(secret.Data)
+		changedAt = dataChangedAt(secret)
+	}
+	// started reports whether something created at t runs data older than the
+	// current one without recording it
+	started := func(t metav1.Time) bool {
+		return state.hash == "" && t.Time.Before(changedAt)
+	}
+
+	if target.APIVersion == "" && strings.ToLower(target.Kind) == "pod" {
+		pod := &corev1.Pod{}
+		err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, pod)
+		if errors.IsNotFound(err) {
+			return state, nil
+		}
+		if err != nil {
+			return state, err
+		}
+		state.hash = pod.Annotations[annotation]
+		state.expected = expectedHash(hashes, &pod.Spec, secretName)
+		state.predates = started(pod.CreationTimestamp)
+		state.pods, state.updated = 1, 1
+		return state, nil
+	}
+
+	gvk, templatePath, err := target.resolve()
+	if err != nil {
+		return state, err
+	}
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+	err = reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, object)
+	if errors.IsNotFound(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	specPath := []string{"spec", "template", "spec"}
+	if len(templatePath) > 0 {
+		specPath = append(append([]string{}, templatePath...), "spec")
+	}
+	state.expected = expectedHash(hashes, podSpecAt(object, specPath), secretName)
+	if len(templatePath) == 0 {
+		state.hash = object.GetAnnotations()[annotation]
+		state.predates = started(object.GetCreationTimestamp())
+		state.pods = 1
+		if workloadAvailable(object) {
+			state.updated = 1
+		}
+		return state, nil
+	}
+	state.hash, _, _ = unstructured.NestedString(object.Object, append(append([]string{}, templatePath...), "metadata", "annotations", annotation)...)
+	if target.APIVersion == "" && strings.ToLower(target.Kind) == "cronjob" {
+		return state, nil
+	}
+
+	pods, err := selectedPods(ctx, reader, namespace, object)
+	if err != nil {
+		return state, err
+	}
+	var reloadedAt time.Time
+	if reload {
+		// the latest reload tells which version the pods should have
+		for _, pod := range pods {
+			at, err := time.Parse(timeLayout, pod.Annotations[reloadedAnnotation])
+			if err == nil && at.After(reloadedAt) {
+				reloadedAt = at
+				state.hash = pod.Annotations[annotation]
+			}
+		}
+	}
+	for _, pod := range pods {
+		state.pods++
+		if started(pod.CreationTimestamp) {
+			state.predates = true
+			continue
+		}
+		// pods created after the reload mount the new secret from the start
+		if pod.Annotations[annotation] == state.hash || (!reloadedAt.IsZero() && pod.CreationTimestamp.After(reloadedAt)) {
+			state.updated++
+		}
+	}
+	return state, nil
+}
+
+// dataChangedAt returns when the operator last changed the data of the secret,
+// zero when it has not since creating it
+func dataChangedAt(secret *corev1.Secret) time.Time {
+	at, err := time.Parse(timeLayout, secret.Annotations[dataChangedAnnotation])
+	if err != nil {
+		return time.Time{}
+	}
+	return at
+}
+
+// expectedHash returns the hash a workload with the pod spec records for the
+// current data of the secret, empty when the secret is not known
+func expectedHash(hashes map[string]string, spec *corev1.PodSpec, secretName string) string {
+	if hashes == nil {
+		return ""
+	}
+	change := &secretChange{secret: secretName, hash: hashOf(hashes, nil), hashes: hashes}
+	return change.hashFor(spec)
+}
+
+// selectedPods returns the live pods matching the selector of the workload
+func selectedPods(ctx context.Context, reader client.Reader, namespace string, object *unstructured.Unstructured) ([]corev1.Pod, error) {
+	raw, found, err := unstructured.NestedMap(object.Object, "spec", "selector")
+	if err != nil || !found {
+		return nil, fmt.Errorf("%s/%s has no .spec.selector to find its pods", object.GetKind(), object.GetName())
+	}
+	var labelSelector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid selector on %s/%s: %w", object.GetKind(), object.GetName(), err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err == nil && selector.Empty() {
+		err = fmt.Errorf("it selects every pod")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector on %s/%s: %w", object.GetKind(), object.GetName(), err)
+	}
+	var list corev1.PodList
+	if err := reader.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// consumersCondition summarises the states, naming the Pods left out of the
+// rollouts. Restarts still queued keep the condition False as the workloads
+// have not been patched yet.
+func consumersCondition(states []consumerState, skipped []string, busy bool, generation int64) (metav1.Condition, int) {
+	var stale []string
+	for _, s := range states {
+		switch {
+		case !s.current():
+			stale = append(stale, fmt.Sprintf("%s/%s (restarted for an older version)", s.target.Kind, s.target.Name))
+		case !s.converged():
+			stale = append(stale, fmt.Sprintf("%s/%s (%d of %d pods updated)", s.target.Kind, s.target.Name, s.updated, s.pods))
+		}
+	}
+	condition := metav1.Condition{
+		Type:               consumersConverged,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Converged",
+		Message:            fmt.Sprintf("All %d consumers run the version of the secret they were restarted for", len(states)),
+		ObservedGeneration: generation,
+	}
+	switch {
+	case busy:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RolloutInProgress"
+		condition.Message = "Restarts are queued"
+	case len(stale) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "StaleConsumers"
+		condition.Message = "Not all pods run the latest version: " + strings.Join(stale, ", ")
+	}
+	if len(skipped) > 0 {
+		condition.Message += ". Not restarted by the operator: " + strings.Join(skipped, ", ")
+	}
+	return condition, len(stale)
+}
+
+// needsTracking reports whether the consumers have to be looked at again.
+// Once they have converged they are only checked again when forced, which
+// the controllers do after a change or when the secret is read again.
+func needsTracking(conditions []metav1.Condition, force bool) bool {
+	for _, c := range conditions {
+		if c.Type == consumersConverged {
+			return force || c.Status != metav1.ConditionTrue
+		}
+	}
+	return true
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConsumerStates(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	reloadedAt := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	pod := func(name, hash string, created time.Time, reloaded bool) client.Object {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            labels,
+				Annotations:       map[string]string{hashAnnotation("app"): hash},
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if reloaded {
+			p.Annotations[reloadedAnnotation] = reloadedAt.Format(timeLayout)
+		}
+		return p
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{hashAnnotation("app"): "2"}}},
+		},
+	}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"},
+		Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{hashAnnotation("app"): "2"}}},
+		}}},
+	}
+	before, after := reloadedAt.Add(-time.Hour), reloadedAt.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		reload  bool
+		objects []client.Object
+		target  workloadRef
+		hash    string
+		pods    int32
+		updated int32
+	}{
+		{
+			name:    "Restarted",
+			objects: []client.Object{deployment, pod("web-1", "2", after, false), pod("web-2", "2", after, false)},
+			target:  workloadRef{Kind: "Deployment", Name: "web"},
+			hash:    "2", pods: 2, updated: 2,
+		},
+		{
+			name:    "Rolling out",
+			objects: []client.Object{deployment, pod("web-1", "2", after, false), pod("web-2", "1", before, false)},
+			target:  workloadRef{Kind: "Deployment", Name: "web"},
+			hash:    "2", pods: 2, updated: 1,
+		},
+		{
+			name:    "Reloaded",
+			reload:  true,
+			objects: []client.Object{deployment, pod("web-1", "3", before, true), pod("web-2", "", after, false), pod("web-3", "1", before, false)},
+			target:  workloadRef{Kind: "Deployment", Name: "web"},
+			hash:    "3", pods: 3, updated: 2,
+		},
+		{
+			name:    "CronJob",
+			objects: []client.Object{cronJob},
+			target:  workloadRef{Kind: "CronJob", Name: "backup"},
+			hash:    "2",
+		},
+		{
+			name:   "Missing",
+			target: workloadRef{Kind: "Deployment", Name: "web"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build()
+			states, err := consumerStates(context.Background(), c, "default", "app", tt.reload, []workloadRef{tt.target})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(states) != 1 {
+				t.Fatalf("Expected 1 state but got %d", len(states))
+			}
+			s := states[0]
+			if s.hash != tt.hash || s.pods != tt.pods || s.updated != tt.updated {
+				t.Errorf("Expected hash %q with %d of %d pods updated but got hash %q with %d of %d", tt.hash, tt.updated, tt.pods, s.hash, s.updated, s.pods)
+			}
+		})
+	}
+}
+
+func TestConsumerStatesSecretHash(t *testing.T) {
+	oldData := map[string][]byte{"username": []byte("app"), "password": []byte("old")}
+	data := map[string][]byte{"username": []byte("app"), "password": []byte("new")}
+	keyRef := func(key string) corev1.PodSpec {
+		return corev1.PodSpec{Containers: []corev1.Container{{
+			Env: []corev1.EnvVar{{Name: "VALUE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: key}}}},
+		}}}
+	}
+	envFrom := corev1.PodSpec{Containers: []corev1.Container{{
+		EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}},
+	}}}
+	// hash records the hash a restart for the data leaves on the workload
+	hash := func(data map[string][]byte, spec corev1.PodSpec) string {
+		return newSecretChange("app", nil, data).hashFor(&spec)
+	}
+	deployment := func(name string, spec corev1.PodSpec, hash string) client.Object {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{hashAnnotation("app"): hash}},
+					Spec:       spec,
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		spec      corev1.PodSpec
+		hash      string
+		converged bool
+	}{
+		{name: "Whole secret current", spec: envFrom, hash: dataHash(data), converged: true},
+		{name: "Whole secret older", spec: envFrom, hash: dataHash(oldData), converged: false},
+		{name: "Changed key current", spec: keyRef("password"), hash: hash(data, keyRef("password")), converged: true},
+		{name: "Changed key older", spec: keyRef("password"), hash: hash(oldData, keyRef("password")), converged: false},
+		{name: "Unchanged key", spec: keyRef("username"), hash: hash(oldData, keyRef("username")), converged: true},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}, Data: data},
+				deployment("web", tt.spec, tt.hash),
+			).Build()
+			states, err := consumerStates(context.Background(), c, "default", "app", false, []workloadRef{{Kind: "Deployment", Name: "web"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := states[0].converged(); got != tt.converged {
+				t.Errorf("Expected converged to be %v but got %v", tt.converged, got)
+			}
+		})
+	}
+}
+
+func TestConsumerStatesNeverRestarted(t *testing.T) {
+	changedAt := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	before, after := changedAt.Add(-time.Hour), changedAt.Add(time.Minute)
+	labels := map[string]string{"app": "web"}
+	pod := func(name string, created time.Time) client.Object {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels, CreationTimestamp: metav1.NewTime(created)},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	secret := func(changed bool) client.Object {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}, Data: map[string][]byte{"password": []byte("new")}}
+		if changed {
+			s.Annotations = map[string]string{dataChangedAnnotation: changedAt.Format(timeLayout)}
+		}
+		return s
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}}}},
+			}}}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		objects   []client.Object
+		updated   int32
+		converged bool
+	}{
+		{name: "Started after the change", objects: []client.Object{secret(true), deployment, pod("web-1", after)}, updated: 1, converged: true},
+		{name: "Restart failed", objects: []client.Object{secret(true), deployment, pod("web-1", before), pod("web-2", after)}, updated: 1, converged: false},
+		{name: "Data never changed", objects: []client.Object{secret(false), deployment, pod("web-1", before)}, updated: 1, converged: true},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build()
+			states, err := consumerStates(context.Background(), c, "default", "app", false, []workloadRef{{Kind: "Deployment", Name: "web"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := states[0]
+			if s.updated != tt.updated || s.converged() != tt.converged || s.current() != tt.converged {
+				t.Errorf("Expected %d pods updated and converged %v but got %d and %v", tt.updated, tt.converged, s.updated, s.converged())
+			}
+		})
+	}
+}
+
+func TestRecordDataChange(t *testing.T) {
+	secret := &corev1.Secret{}
+	recordDataChange(secret, newSecretChange("app", nil, map[string][]byte{"password": []byte("new")}))
+	if _, ok := secret.Annotations[dataChangedAnnotation]; ok {
+		t.Errorf("Expected a new secret not to record a change")
+	}
+	secret.Data = map[string][]byte{"password": []byte("old")}
+	recordDataChange(secret, newSecretChange("app", secret.Data, secret.Data))
+	if _, ok := secret.Annotations[dataChangedAnnotation]; ok {
+		t.Errorf("Expected unchanged data not to record a change")
+	}
+	recordDataChange(secret, newSecretChange("app", secret.Data, map[string][]byte{"password": []byte("new")}))
+	if dataChangedAt(secret).IsZero() {
+		t.Errorf("Expected the change to be recorded but got %v", secret.Annotations)
+	}
+}
+
+func TestConsumersCondition(t *testing.T) {
+	converged := consumerState{target: workloadRef{Kind: "Deployment", Name: "web"}, pods: 2, updated: 2}
+	stale := consumerState{target: workloadRef{Kind: "StatefulSet", Name: "db"}, pods: 3, updated: 1}
+	older := consumerState{target: workloadRef{Kind: "DaemonSet", Name: "agent"}, hash: "1", expected: "2"}
+
+	tests := []struct {
+		name    string
+		states  []consumerState
+		busy    bool
+		skipped []string
+		status  metav1.ConditionStatus
+		reason  string
+		stale   int
+	}{
+		{name: "Converged", states: []consumerState{converged}, status: metav1.ConditionTrue, reason: "Converged"},
+		{name: "Stale", states: []consumerState{converged, stale}, status: metav1.ConditionFalse, reason: "StaleConsumers", stale: 1},
+		{name: "Older version", states: []consumerState{converged, older}, status: metav1.ConditionFalse, reason: "StaleConsumers", stale: 1},
+		{name: "Skipped", states: []consumerState{converged}, skipped: []string{"Pod/debug (no controller)"}, status: metav1.ConditionTrue, reason: "Converged"},
+		{name: "Queued", states: []consumerState{converged}, busy: true, status: metav1.ConditionFalse, reason: "RolloutInProgress"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, n := consumersCondition(tt.states, tt.skipped, tt.busy, 3)
+			if condition.Status != tt.status || condition.Reason != tt.reason || n != tt.stale {
+				t.Errorf("Expected %s/%s with %d stale but got %s/%s with %d", tt.status, tt.reason, tt.stale, condition.Status, condition.Reason, n)
+			}
+			for _, s := range tt.skipped {
+				if !strings.Contains(condition.Message, s) {
+					t.Errorf("Expected the message to name %s but got %s", s, condition.Message)
+				}
+			}
+			if condition.ObservedGeneration != 3 {
+				t.Errorf("Expected observed generation 3 but got %d", condition.ObservedGeneration)
+			}
+			if got := needsTracking([]metav1.Condition{condition}, false); got == (tt.status == metav1.ConditionTrue) {
+				t.Errorf("Expected needsTracking to be %v", !got)
+			}
+		})
+	}
+	if !needsTracking(nil, false) {
+		t.Errorf("Expected consumers never tracked to need tracking")
+	}
+}
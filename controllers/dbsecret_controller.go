@@ -19,6 +19,7 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -28,11 +29,11 @@ import (
 
 	sprig "github.com/Masterminds/sprig/v3"
 	"github.com/go-logr/logr"
-	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -41,7 +42,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/db/connstr"
+	"digitalis.io/vals-operator/maintenance"
 	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/policy"
 	"digitalis.io/vals-operator/utils"
 	"digitalis.io/vals-operator/vault"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -59,6 +63,18 @@ type DbSecretReconciler struct {
 	RecordChanges        bool
 	Recorder             record.EventRecorder
 	DefaultTTL           time.Duration
+	// PolicyChecker enforces DbSecretPolicies when set
+	PolicyChecker *policy.Checker
+	// Identities logs in with the ServiceAccount of the namespace when set
+	Identities *vault.IdentityPool
+	// Rollouts staggers the restarts of the workloads when set
+	Rollouts *RolloutQueue
+	// Stores logs in to the SecretStore or ClusterSecretStore of a DbSecret
+	Stores *SecretStores
+	// MaintenanceWindows hold rotations of secrets without windows of their own
+	MaintenanceWindows maintenance.Windows
+	// DryRun reports the changes instead of making them when set
+	DryRun *DryRun
 
 	errorCounts map[string]int
 	errMu       sync.Mutex
@@ -67,6 +83,8 @@ type DbSecretReconciler struct {
 //+kubebuilder:rbac:groups=digitalis.io,resources=dbsecrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=digitalis.io,resources=dbsecrets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=digitalis.io,resources=dbsecrets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=digitalis.io,resources=dbsecretpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -84,6 +102,9 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	err := r.Get(ctx, req.NamespacedName, &dbSecret)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			r.DryRun.forget("DbSecret", req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -97,10 +118,16 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
+	if err := backendUnavailable(r.Identities); err != nil && dbSecret.Spec.StoreRef == nil {
+		r.Log.Info("Waiting for the secrets backend", "name", dbSecret.Name, "namespace", dbSecret.Namespace, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: backendRetryPeriod}, nil
+	}
+
 	//! [finalizer]
 	valsDbSecretFinalizerName := "dbsecret.digitalis.io/finalizer"
 	if dbSecret.ObjectMeta.DeletionTimestamp.IsZero() {
-		if !utils.ContainsString(dbSecret.GetFinalizers(), valsDbSecretFinalizerName) {
+		// without the finalizer a deletion is left to garbage collection in dry-run mode
+		if !utils.ContainsString(dbSecret.GetFinalizers(), valsDbSecretFinalizerName) && !r.DryRun.Enabled() {
 			dbSecret.SetFinalizers(append(dbSecret.GetFinalizers(), valsDbSecretFinalizerName))
 			if err := r.Update(context.Background(), &dbSecret); err != nil {
 				return ctrl.Result{}, err
@@ -110,7 +137,11 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		// The object is being deleted
 		r.clearErrorCount(&dbSecret)
 		if utils.ContainsString(dbSecret.GetFinalizers(), valsDbSecretFinalizerName) {
-			err := r.revokeLease(&dbSecret, currentSecret)
+			if r.DryRun.Enabled() {
+				r.dryRun(&dbSecret, dryRunDeleteSecret, fmt.Sprintf("Would revoke the lease, delete secret %s/%s and remove the finalizer", dbSecret.Namespace, secretName))
+				return ctrl.Result{}, nil
+			}
+			err := r.revokeLease(ctx, &dbSecret, currentSecret)
 			if err != nil {
 				// log the error but continue
 				r.Log.Error(err, "Lease cannot be revoked", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
@@ -132,6 +163,7 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 			/* mark as deleted in prom */
 			dmetrics.DbSecretExpireTime.WithLabelValues(dbSecret.Name, dbSecret.Namespace).Set(0)
 			dmetrics.DbSecretInfo.WithLabelValues(dbSecret.Name, dbSecret.Namespace).Set(0)
+			dmetrics.StaleConsumers.DeleteLabelValues("DbSecret", dbSecret.Name, dbSecret.Namespace)
 		}
 
 		// Stop reconciliation as the item is being deleted
@@ -140,22 +172,54 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 	//! [finalizer]
 
+	if r.PolicyChecker != nil {
+		if err := r.PolicyChecker.Check(ctx, &dbSecret); err != nil {
+			if !policy.IsDenied(err) {
+				return ctrl.Result{}, err
+			}
+			r.Log.Error(err, "DbSecret not allowed", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
+			dmetrics.DbSecretPolicyDenied.WithLabelValues(dbSecret.Name, dbSecret.Namespace).SetToCurrentTime()
+			if r.recordingEnabled(&dbSecret) {
+				r.Recorder.Event(&dbSecret, corev1.EventTypeNormal, "Denied", err.Error())
+			}
+			// check again later in case the policies are changed
+			return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+		}
+	}
+
 	if currentSecret != nil && currentSecret.Name != "" {
 		shouldUpdate := false
 		canRenew := true
 
+		if err := r.migrateLeaseId(ctx, &dbSecret, currentSecret); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if currentSecret.Annotations[vaultNamespaceLabel] != dbSecret.Spec.Vault.Namespace {
+			r.Log.Info("Vault namespace changed, issuing new credentials", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
+			shouldUpdate = true
+			canRenew = false
+		}
+
+		if currentSecret.Annotations[secretStoreLabel] != dbStoreName(&dbSecret) {
+			r.Log.Info("Secret store changed, issuing new credentials", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
+			shouldUpdate = true
+			canRenew = false
+		}
+
+		grace := int64(120) // if expires in less then 2 min, we'll update it
 		e, err := strconv.ParseInt(currentSecret.Annotations[expiresOnLabel], 10, 64)
 		if err != nil {
 			r.Log.Info("Updating secret due to invalid expire time", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
 			shouldUpdate = true
 		} else {
-			grace := int64(120) // if expires in less then 2 min, we'll update it
 			if time.Now().Unix() >= e || time.Now().Unix()+grace >= e {
 				shouldUpdate = true
 				r.Log.Info(fmt.Sprintf("Credentials for secret %s expired on %s", currentSecret.Name, currentSecret.Annotations[expiresOnLabel]))
 			}
 		}
-		if !r.isLeaseValid(&dbSecret, currentSecret) {
+		leaseValid := r.isLeaseValid(ctx, &dbSecret, currentSecret)
+		if !leaseValid {
 			shouldUpdate = true
 			canRenew = false
 			if r.recordingEnabled(&dbSecret) {
@@ -171,14 +235,15 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 		/* If the new secret doesn't have a template anymore, make sure it's deleted from the secret */
 		if len(dbSecret.Spec.Template) == 0 {
-			for k, _ := range currentSecret.Data {
-				if k != "username" && k != "password" {
+			keep := r.plainKeys(&dbSecret)
+			for k := range currentSecret.Data {
+				if !keep[k] {
 					delete(currentSecret.Data, k)
 				}
 			}
 		}
 
-		newHash := utils.CreateFakeHash(dbSecret.Spec.Template)
+		newHash := r.outputHash(&dbSecret)
 		if newHash != "" && currentSecret.Annotations[templateHash] != "" {
 			if newHash != currentSecret.Annotations[templateHash] {
 				shouldUpdate = true
@@ -186,24 +251,44 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 
 		if !shouldUpdate {
+			r.trackConsumers(ctx, &dbSecret, false)
 			return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
 		}
 		if canRenew && dbSecret.Spec.Renew {
-			err = r.renewLease(&dbSecret, currentSecret)
+			if r.DryRun.Enabled() {
+				r.dryRun(&dbSecret, dryRunRenewLease, fmt.Sprintf("Would renew the lease of secret %s/%s", dbSecret.Namespace, secretName))
+				return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+			}
+			err = r.renewLease(ctx, &dbSecret, currentSecret)
 			if err != nil {
 				r.Log.Error(err, "Lease could not be extended", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
 			}
 			return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, err
 		}
-	}
 
-	/* Because we're about to request a new credential, revoke any possible old ones */
-	if currentSecret != nil && currentSecret.Name != "" && currentSecret.ObjectMeta.Annotations[leaseIdLabel] != "" {
-		if err := r.revokeLease(&dbSecret, currentSecret); err != nil {
-			r.Log.Error(err, "Old lease could not be revoked", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
+		/* Credentials still valid when the window opens can wait for it */
+		if until := heldUntil(&dbSecret, r.maintenanceWindows(&dbSecret), time.Now()); !until.IsZero() &&
+			leaseValid && e > 0 && until.Unix()+grace < e {
+			return ctrl.Result{RequeueAfter: r.hold(ctx, &dbSecret, until)}, nil
 		}
 	}
-	creds, err := vault.GetDbCredentials(dbSecret.Spec.Vault.Role, dbSecret.Spec.Vault.Mount)
+
+	if r.DryRun.Enabled() {
+		r.dryRunRotation(ctx, &dbSecret, currentSecret)
+		return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
+	}
+
+	/*
+	 * The current lease is left to expire rather than revoked: the workloads
+	 * keep using its credentials until they are restarted or reloaded, which
+	 * may be staggered or held by a maintenance window.
+	 */
+	var creds vault.VaultDbSecret
+	c, err := r.storeClient(ctx, &dbSecret, dbStoreName(&dbSecret))
+	if err == nil {
+		c = c.WithNamespace(dbSecret.Spec.Vault.Namespace)
+		creds, err = vault.GetDbCredentials(ctx, c, dbSecret.Spec.Vault.Role, dbSecret.Spec.Vault.Mount)
+	}
 	if err != nil {
 		r.Log.Error(err, "Failed to obtain credentials from Vault", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
 		dmetrics.DbSecretFailures.Inc()
@@ -211,57 +296,157 @@ func (r *DbSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	err = r.upsertSecret(&dbSecret, creds, currentSecret)
+	change, err := r.upsertSecret(&dbSecret, creds, currentSecret)
 	if err != nil {
 		r.Log.Error(err, "Failed to create secret", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
 		dmetrics.DbSecretFailures.Inc()
 		dmetrics.DbSecretError.WithLabelValues(dbSecret.Name, dbSecret.Namespace).SetToCurrentTime()
-		return ctrl.Result{}, nil
+		// the new credentials are not stored anywhere so there is no point keeping them valid
+		if err := vault.RevokeDbCredentials(ctx, c, creds.LeaseId); err != nil {
+			r.Log.Error(err, "Unused lease could not be revoked", "name", dbSecret.Name, "namespace", dbSecret.Namespace)
+			dmetrics.DbSecretRevokationError.WithLabelValues(dbSecret.Name, dbSecret.Namespace).SetToCurrentTime()
+		}
+		return ctrl.Result{}, err
 	}
 
+	releaseChanges(ctx, r.Client, r.Log, &dbSecret, &dbSecret.Status.PendingUntil)
+
 	/* Patching resources to force a rollout if required */
-	for target := range dbSecret.Spec.Rollout {
-		if dbSecret.Spec.Rollout[target].Name != "" && dbSecret.Spec.Rollout[target].Kind != "" {
-			if err := r.rollout(&dbSecret, dbSecret.Spec.Rollout[target]); err != nil {
-				r.Log.Error(err, "Could not perform rollout",
-					"name", dbSecret.Name,
-					"namespace", dbSecret.Namespace,
-					"kind", dbSecret.Spec.Rollout[target].Kind,
-					"name", dbSecret.Spec.Rollout[target].Name)
-			}
-		}
+	if change.changed() {
+		r.rollout(ctx, &dbSecret, change)
 	}
+	r.trackConsumers(ctx, &dbSecret, true)
 	return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
 }
 
-func (r *DbSecretReconciler) revokeLease(sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) error {
-	if currentSecret == nil || currentSecret.Name != "" {
+func (r *DbSecretReconciler) revokeLease(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) error {
+	if currentSecret == nil || currentSecret.Name == "" {
 		return nil
 	}
 
 	r.Log.Info(fmt.Sprintf("Revoking lease for %s in namespace %s", currentSecret.Name, currentSecret.Namespace))
 
-	if currentSecret.ObjectMeta.Annotations[leaseIdLabel] == "" {
+	leaseId := leaseIdFromSecret(currentSecret)
+	if leaseId == "" {
+		leaseId = r.resolveLegacyLeaseId(ctx, sDef, currentSecret)
+	}
+	if leaseId == "" {
 		return fmt.Errorf("cannot revoke credentials without lease Id: secret %s in namespace %s",
 			currentSecret.Name, currentSecret.Namespace)
 	}
-	leaseId := fmt.Sprintf("%s/creds/%s/%s",
-		sDef.Spec.Vault.Mount,
+	c, err := r.leaseClient(ctx, sDef, currentSecret)
+	if err != nil {
+		return err
+	}
+	return vault.RevokeDbCredentials(ctx, c, leaseId)
+}
+
+// leaseIdFromSecret returns the lease ID recorded on the secret. Older releases
+// only stored the last element of the lease ID, which is empty here until
+// migrateLeaseId resolves it.
+func leaseIdFromSecret(secret *corev1.Secret) string {
+	leaseId := secret.ObjectMeta.Annotations[leaseIdLabel]
+	if !strings.Contains(leaseId, "/") {
+		return ""
+	}
+	return leaseId
+}
+
+// legacyLeaseId rebuilds the full lease ID from the short one written by older
+// releases and the current mount and role of the DbSecret, which are not the
+// ones the lease was issued for if they were changed since
+func legacyLeaseId(sDef *digitalisiov1beta1.DbSecret, secret *corev1.Secret) string {
+	leaseId := secret.ObjectMeta.Annotations[leaseIdLabel]
+	if leaseId == "" || strings.Contains(leaseId, "/") {
+		return ""
+	}
+	return fmt.Sprintf("%s/creds/%s/%s",
+		strings.Trim(sDef.Spec.Vault.Mount, "/"),
 		sDef.Spec.Vault.Role,
-		currentSecret.ObjectMeta.Annotations[leaseIdLabel])
-	return vault.RevokeDbCredentials(leaseId)
+		leaseId)
 }
 
-// renewLease will ask vault to renew the lease
-func (r *DbSecretReconciler) isLeaseValid(sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) bool {
-	if currentSecret.ObjectMeta.Annotations[leaseIdLabel] == "" {
+// resolveLegacyLeaseId returns the full ID of the lease recorded by an older
+// release, or an empty string when no lease exists at the rebuilt ID
+func (r *DbSecretReconciler) resolveLegacyLeaseId(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, secret *corev1.Secret) string {
+	leaseId := legacyLeaseId(sDef, secret)
+	if leaseId == "" {
+		return ""
+	}
+	c, err := r.leaseClient(ctx, sDef, secret)
+	if err != nil {
+		r.Log.Error(err, "Cannot check lease", "name", sDef.Name, "namespace", sDef.Namespace)
+		return ""
+	}
+	if !vault.IsLeaseValid(ctx, c, leaseId) {
+		return ""
+	}
+	return leaseId
+}
+
+// leaseClient returns a client for the Vault namespace the lease of the secret
+// was issued in, which may differ from the one in the spec after it is changed
+func (r *DbSecretReconciler) leaseClient(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, secret *corev1.Secret) (vault.SecretsClient, error) {
+	c, err := r.storeClient(ctx, sDef, secret.ObjectMeta.Annotations[secretStoreLabel])
+	if err != nil {
+		return nil, err
+	}
+	return c.WithNamespace(secret.ObjectMeta.Annotations[vaultNamespaceLabel]), nil
+}
+
+// storeClient returns the client of the named secret store or, when empty,
+// the one the operator is configured with
+func (r *DbSecretReconciler) storeClient(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, store string) (vault.SecretsClient, error) {
+	if store != "" {
+		return r.Stores.clientFor(ctx, store, sDef.Namespace)
+	}
+	return secretsClient(ctx, r.Identities, sDef.Namespace, sDef.Spec.ServiceAccountName)
+}
+
+// dbStoreName returns the store the DbSecret reads its credentials from
+func dbStoreName(sDef *digitalisiov1beta1.DbSecret) string {
+	if sDef.Spec.StoreRef == nil {
+		return ""
+	}
+	return storeName(sDef.Spec.StoreRef.Kind, sDef.Spec.StoreRef.Name)
+}
+
+// migrateLeaseId replaces the short lease ID written by older releases with the
+// full one. When no lease exists at the rebuilt ID, for instance because the
+// mount or role was changed, the lease is left unresolved and new credentials
+// are issued.
+func (r *DbSecretReconciler) migrateLeaseId(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) error {
+	if legacyLeaseId(sDef, currentSecret) == "" {
+		return nil
+	}
+	leaseId := r.resolveLegacyLeaseId(ctx, sDef, currentSecret)
+	if leaseId == "" {
+		r.Log.Info("Lease id recorded by an older release cannot be resolved, new credentials will be issued", "name", sDef.Name, "namespace", sDef.Namespace)
+		return nil
+	}
+
+	currentSecret.ObjectMeta.Annotations[leaseIdLabel] = leaseId
+	// the lease id is resolved again on every reconcile until the secret is written
+	if r.DryRun.Enabled() {
+		r.dryRun(sDef, dryRunUpdateSecret, fmt.Sprintf("Would record the full lease id on secret %s/%s", currentSecret.Namespace, currentSecret.Name))
+		return nil
+	}
+	r.Log.Info("Migrating lease id annotation to the full lease id", "name", sDef.Name, "namespace", sDef.Namespace)
+	return r.Update(r.Ctx, currentSecret)
+}
+
+// isLeaseValid will ask vault whether the lease still exists
+func (r *DbSecretReconciler) isLeaseValid(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) bool {
+	leaseId := leaseIdFromSecret(currentSecret)
+	if leaseId == "" {
 		return false
 	}
-	leaseId := fmt.Sprintf("%s/creds/%s/%s",
-		sDef.Spec.Vault.Mount,
-		sDef.Spec.Vault.Role,
-		currentSecret.ObjectMeta.Annotations[leaseIdLabel])
-	ok := vault.IsLeaseValid(leaseId)
+	c, err := r.leaseClient(ctx, sDef, currentSecret)
+	if err != nil {
+		r.Log.Error(err, "Cannot check lease", "name", sDef.Name, "namespace", sDef.Namespace)
+		return false
+	}
+	ok := vault.IsLeaseValid(ctx, c, leaseId)
 	if !ok {
 		r.Log.Info("Lease on secret no longer valid", "name", sDef.Name, "namespace", sDef.Namespace)
 	}
@@ -269,19 +454,16 @@ func (r *DbSecretReconciler) isLeaseValid(sDef *digitalisiov1beta1.DbSecret, cur
 }
 
 // renewLease will ask vault to renew the lease
-func (r *DbSecretReconciler) renewLease(sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) error {
+func (r *DbSecretReconciler) renewLease(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) error {
 	var err error
 	var leaseId string
 
 	r.Log.Info("Renewing lease on secret", "name", sDef.Name, "namespace", sDef.Namespace)
 
-	if currentSecret.ObjectMeta.Annotations[leaseIdLabel] == "" {
+	leaseId = leaseIdFromSecret(currentSecret)
+	if leaseId == "" {
 		return fmt.Errorf("cannot renew without lease Id")
 	}
-	leaseId = fmt.Sprintf("%s/creds/%s/%s",
-		sDef.Spec.Vault.Mount,
-		sDef.Spec.Vault.Role,
-		currentSecret.ObjectMeta.Annotations[leaseIdLabel])
 
 	var increment int
 	increment, err = strconv.Atoi(currentSecret.ObjectMeta.Annotations[leaseDurationLabel])
@@ -289,7 +471,11 @@ func (r *DbSecretReconciler) renewLease(sDef *digitalisiov1beta1.DbSecret, curre
 		r.Log.Error(err, "Can't get increment")
 		return err
 	}
-	err = vault.RenewDbCredentials(leaseId, increment)
+	c, err := r.leaseClient(ctx, sDef, currentSecret)
+	if err != nil {
+		return err
+	}
+	err = vault.RenewDbCredentials(ctx, c, leaseId, increment)
 	if err != nil {
 		return err
 	}
@@ -314,8 +500,8 @@ func (r *DbSecretReconciler) renewLease(sDef *digitalisiov1beta1.DbSecret, curre
 	return err
 }
 
-// upsertSecret will create or update a secret
-func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, creds vault.VaultDbSecret, secret *corev1.Secret) error {
+// upsertSecret will create or update a secret. Returns the change to its data
+func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, creds vault.VaultDbSecret, secret *corev1.Secret) (*secretChange, error) {
 	var err error
 
 	secretName := r.getSecretName(sDef)
@@ -336,10 +522,16 @@ func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, cre
 	data := r.renderTemplate(sDef, dataStr)
 
 	if len(data) < 1 {
-		secret.StringData = dataStr
-	} else {
-		secret.Data = data
+		for k, v := range dataStr {
+			data[r.keyName(sDef, k)] = []byte(v)
+		}
+	}
+	for k, v := range r.renderOutputs(sDef, creds) {
+		data[k] = v
 	}
+	change := newSecretChange(secretName, secret.Data, data)
+	recordDataChange(secret, change)
+	secret.Data = data
 
 	secret.Name = secretName
 	secret.Namespace = sDef.Namespace
@@ -357,17 +549,31 @@ func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, cre
 	utils.MergeMap(secret.ObjectMeta.Labels, sDef.ObjectMeta.Labels)
 	utils.MergeMap(secret.ObjectMeta.Annotations, sDef.ObjectMeta.Annotations)
 	secret.ObjectMeta.Annotations[managedByLabel] = "vals-operator"
-	secret.ObjectMeta.Annotations[leaseIdLabel] = strings.Split(creds.LeaseId, "/")[3]
+	/* The replaced lease is left to expire, keep it so it is not taken for an orphan */
+	if previous := secret.ObjectMeta.Annotations[leaseIdLabel]; previous != "" && previous != creds.LeaseId {
+		secret.ObjectMeta.Annotations[previousLeaseIdLabel] = previous
+	}
+	secret.ObjectMeta.Annotations[leaseIdLabel] = creds.LeaseId
+	if sDef.Spec.Vault.Namespace != "" {
+		secret.ObjectMeta.Annotations[vaultNamespaceLabel] = sDef.Spec.Vault.Namespace
+	} else {
+		delete(secret.ObjectMeta.Annotations, vaultNamespaceLabel)
+	}
+	if store := dbStoreName(sDef); store != "" {
+		secret.ObjectMeta.Annotations[secretStoreLabel] = store
+	} else {
+		delete(secret.ObjectMeta.Annotations, secretStoreLabel)
+	}
 
 	secret.ObjectMeta.Annotations[leaseDurationLabel] = fmt.Sprintf("%d", creds.LeaseDuration)
 	secret.ObjectMeta.Annotations[lastUpdatedAnnotation] = time.Now().UTC().Format(timeLayout)
 	secret.ObjectMeta.Annotations[expiresOnLabel] = fmt.Sprintf("%d", time.Now().Unix()+int64(creds.LeaseDuration))
 	/* Hash to check for changes later on */
-	secret.ObjectMeta.Annotations[templateHash] = utils.CreateFakeHash(sDef.Spec.Template)
+	secret.ObjectMeta.Annotations[templateHash] = r.outputHash(sDef)
 	delete(secret.ObjectMeta.Annotations, forceCreateAnnotation)
 
 	if err = controllerutil.SetControllerReference(sDef, secret, r.Scheme); err != nil {
-		return err
+		return nil, err
 	}
 
 	r.Log.Info(fmt.Sprintf("Creating secret %s", secretName))
@@ -382,7 +588,7 @@ func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, cre
 			msg := fmt.Sprintf("Secret %s not saved %v", secret.Name, err)
 			r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", msg)
 		}
-		return err
+		return nil, err
 	}
 	/* Prometheus */
 	f, err := strconv.ParseFloat(secret.Annotations[expiresOnLabel], 10)
@@ -393,17 +599,20 @@ func (r *DbSecretReconciler) upsertSecret(sDef *digitalisiov1beta1.DbSecret, cre
 	dmetrics.DbSecretInfo.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
 
 	if r.recordingEnabled(sDef) {
-		r.Recorder.Event(sDef, corev1.EventTypeNormal, "Updated", "Secret created or updated")
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "Updated", "Secret created or updated"+change.message())
 	}
 	r.Log.Info("Updated secret", "name", secretName)
 
-	return err
+	return change, err
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DbSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("Secrets")
 	pred := predicate.GenerationChangedPredicate{}
+	if r.Rollouts != nil {
+		r.Rollouts.AddRecovery(r.recoverRollouts)
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&digitalisiov1beta1.DbSecret{}).
@@ -470,57 +679,165 @@ func (r *DbSecretReconciler) recordingEnabled(sDef *digitalisiov1beta1.DbSecret)
 	return r.RecordChanges
 }
 
-// rollout is used to restart the Deployment or StatefulSet
-func (r *DbSecretReconciler) rollout(sDef *digitalisiov1beta1.DbSecret, rolloutTarget digitalisiov1beta1.DbRolloutTarget) error {
-	var err error
-
-	clientObject := types.NamespacedName{
-		Namespace: sDef.Namespace,
-		Name:      rolloutTarget.Name,
-	}
-	r.Log.Info(fmt.Sprintf("Rolling restart %s/%s in namespace %s", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace))
-
-	if strings.ToLower(rolloutTarget.Kind) == "deployment" {
-		var object v1.Deployment
-		err = r.Get(r.Ctx, clientObject, &object)
-		if errors.IsNotFound(err) {
-			msg := fmt.Sprintf("%s/%s in namespace %s not found", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace)
-			r.Log.Error(err, msg)
-			return nil
+// trackConsumers records in the status how far the workloads restarted for
+// the secret have rolled out
+func (r *DbSecretReconciler) trackConsumers(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, force bool) {
+	before := sDef.DeepCopy()
+	var targets []workloadRef
+	for _, t := range sDef.Spec.Rollout {
+		targets = append(targets, workloadRef{APIVersion: t.APIVersion, Kind: t.Kind, Name: t.Name, TemplatePath: t.TemplatePath})
+	}
+	if len(targets) == 0 && sDef.Spec.RolloutMode != rolloutModeAuto {
+		sDef.Status.Consumers = nil
+		meta.RemoveStatusCondition(&sDef.Status.Conditions, consumersConverged)
+		dmetrics.StaleConsumers.DeleteLabelValues("DbSecret", sDef.Name, sDef.Namespace)
+	} else {
+		if !needsTracking(sDef.Status.Conditions, force) {
+			return
 		}
+		secretName := r.getSecretName(sDef)
+		policy := r.rolloutPolicy(sDef)
+		var skipped []string
+		targets, skipped = rolloutTargets(ctx, r.APIReader, r.Log, sDef.Namespace, sDef.Spec.RolloutMode, secretName, targets)
+		states, err := consumerStates(ctx, r.APIReader, sDef.Namespace, secretName, policy.reload, targets)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Cannot track the consumers", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
-
-		if object.Spec.Template.Annotations == nil {
-			object.Spec.Template.Annotations = make(map[string]string)
+		condition, stale := consumersCondition(states, skipped, r.Rollouts.Busy(policy.owner), sDef.Generation)
+		dmetrics.StaleConsumers.WithLabelValues("DbSecret", sDef.Name, sDef.Namespace).Set(float64(stale))
+		sDef.Status.Consumers = nil
+		for _, s := range states {
+			sDef.Status.Consumers = append(sDef.Status.Consumers, digitalisiov1beta1.RolloutConsumer{
+				Kind:        s.target.Kind,
+				Name:        s.target.Name,
+				APIVersion:  s.target.APIVersion,
+				Hash:        s.hash,
+				Pods:        s.pods,
+				UpdatedPods: s.updated,
+				Converged:   s.converged(),
+			})
 		}
-		object.Spec.Template.Annotations[restartedAnnotation] = time.Now().UTC().Format(timeLayout)
-		err = r.Update(r.Ctx, &object)
+		meta.SetStatusCondition(&sDef.Status.Conditions, condition)
+	}
+	if equality.Semantic.DeepEqual(before.Status, sDef.Status) {
+		return
+	}
+	if err := r.Status().Patch(ctx, sDef, client.MergeFrom(before)); err != nil {
+		r.Log.Error(err, "Cannot update status", "name", sDef.Name, "namespace", sDef.Namespace)
+	}
+}
+
+// maintenanceWindows returns the windows changes to the secret are held until
+func (r *DbSecretReconciler) maintenanceWindows(sDef *digitalisiov1beta1.DbSecret) maintenance.Windows {
+	if len(sDef.Spec.MaintenanceWindows) == 0 {
+		return r.MaintenanceWindows
+	}
+	var windows maintenance.Windows
+	for _, w := range sDef.Spec.MaintenanceWindows {
+		window, err := maintenance.NewWindow(w.Schedule, w.Duration, w.TimeZone)
 		if err != nil {
-			return err
-		}
-	} else if strings.ToLower(rolloutTarget.Kind) == "statefulset" {
-		var object v1.StatefulSet
-		err = r.Get(r.Ctx, clientObject, &object)
-		if errors.IsNotFound(err) {
-			r.Log.Error(err, fmt.Sprintf("%s/%s in namespace %s not found", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace))
+			r.Log.Error(err, "Ignoring the maintenance windows", "name", sDef.Name, "namespace", sDef.Namespace)
+			if r.recordingEnabled(sDef) {
+				r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", fmt.Sprintf("Invalid maintenance window: %v", err))
+			}
 			return nil
 		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// hold leaves the secret unchanged until the maintenance window opens
+func (r *DbSecretReconciler) hold(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, until time.Time) time.Duration {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	return holdChanges(ctx, r.Client, r.Log, recorder, sDef, &sDef.Status.PendingUntil, until, r.ReconciliationPeriod)
+}
+
+// dryRun reports a change to the secret that is not made
+func (r *DbSecretReconciler) dryRun(sDef *digitalisiov1beta1.DbSecret, action, message string) {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	r.DryRun.report(recorder, sDef, "DbSecret", action, message)
+}
+
+// dryRunRotation reports the credentials that would be issued. New
+// credentials change every key of the secret, so the workloads using any of
+// them would be restarted.
+func (r *DbSecretReconciler) dryRunRotation(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, currentSecret *corev1.Secret) {
+	secretName := r.getSecretName(sDef)
+	if currentSecret == nil || currentSecret.Name == "" {
+		r.dryRun(sDef, dryRunCreateSecret, fmt.Sprintf("Would issue credentials for role %s of mount %s and create secret %s/%s",
+			sDef.Spec.Vault.Role, sDef.Spec.Vault.Mount, sDef.Namespace, secretName))
+		return
+	}
+	r.dryRun(sDef, dryRunRotateCredentials, fmt.Sprintf("Would issue new credentials for role %s of mount %s in secret %s/%s, leaving the current lease to expire",
+		sDef.Spec.Vault.Role, sDef.Spec.Vault.Mount, sDef.Namespace, secretName))
+	r.rollout(ctx, sDef, newSecretChange(secretName, currentSecret.Data, nil))
+}
+
+// rolloutPolicy returns how the restarts are staggered and whether the pods
+// are reloaded instead
+func (r *DbSecretReconciler) rolloutPolicy(sDef *digitalisiov1beta1.DbSecret) rolloutPolicy {
+	owner := "DbSecret/" + sDef.Namespace + "/" + sDef.Name
+	policy := rolloutPolicy{owner: owner}
+	if p := sDef.Spec.RolloutPolicy; p != nil {
+		var err error
+		policy, err = newRolloutPolicy(owner, p.MaxConcurrent, p.WaitForAvailable, p.MinInterval)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Ignoring the minimum interval", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
-
-		object.Spec.Template.Annotations[restartedAnnotation] = time.Now().UTC().Format(timeLayout)
-		err = r.Update(r.Ctx, &object)
+	}
+	policy.reload = sDef.Spec.RolloutStrategy == rolloutStrategyReload
+	if e := sDef.Spec.Reload; e != nil && policy.reload {
+		var err error
+		policy.endpoint, err = newReloadEndpoint(e.Port, e.Path, e.Method, e.Scheme, e.Delay)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Ignoring the reload delay", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
-	} else {
-		return fmt.Errorf("%s kind is not supported", rolloutTarget.Kind)
 	}
+	policy.windows = rolloutWindows(sDef, r.maintenanceWindows(sDef))
+	return policy
+}
 
-	return nil
+// recoverRollouts queues again the restarts lost when the operator stopped
+func (r *DbSecretReconciler) recoverRollouts(ctx context.Context) {
+	if r.DryRun.Enabled() {
+		return
+	}
+	var list digitalisiov1beta1.DbSecretList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Cannot list the DbSecrets to recover their rollouts")
+		return
+	}
+	for i := range list.Items {
+		sDef := &list.Items[i]
+		if sDef.DeletionTimestamp != nil || r.shouldExclude(sDef.Namespace) {
+			continue
+		}
+		if len(sDef.Spec.Rollout) == 0 && sDef.Spec.RolloutMode != rolloutModeAuto {
+			continue
+		}
+		recoverRollout(ctx, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, r.getSecretName(sDef), dbWorkloads(sDef.Spec.Rollout))
+	}
+}
+
+// rollout is used to restart the workloads using the secret
+func (r *DbSecretReconciler) rollout(ctx context.Context, sDef *digitalisiov1beta1.DbSecret, change *secretChange) {
+	if r.DryRun.Enabled() {
+		if message := plannedRollout(ctx, r.APIReader, r.Log, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, dbWorkloads(sDef.Spec.Rollout)); message != "" {
+			r.dryRun(sDef, dryRunRollout, message)
+		}
+		return
+	}
+	skipped := rolloutSecret(ctx, r.Client, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, dbWorkloads(sDef.Spec.Rollout))
+	if len(skipped) > 0 && r.recordingEnabled(sDef) {
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "RolloutSkipped", skippedRollout(change.secret, skipped))
+	}
 }
 
 // rollout is used to restart the Deployment or StatefulSet
@@ -562,3 +879,95 @@ func (r *DbSecretReconciler) renderTemplate(sDef *digitalisiov1beta1.DbSecret, d
 	}
 	return data
 }
+
+// keyName returns the key a credential is stored under, as renamed by spec.secret
+func (r *DbSecretReconciler) keyName(sDef *digitalisiov1beta1.DbSecret, key string) string {
+	var name string
+	switch key {
+	case "username":
+		name = sDef.Spec.Secret.Username
+	case "password":
+		name = sDef.Spec.Secret.Password
+	case "hosts":
+		name = sDef.Spec.Secret.Hosts
+	case "connection_url":
+		name = sDef.Spec.Secret.ConnectionURL
+	}
+	if name == "" {
+		return key
+	}
+	return name
+}
+
+// plainKeys lists the keys expected in the secret when no template is used
+func (r *DbSecretReconciler) plainKeys(sDef *digitalisiov1beta1.DbSecret) map[string]bool {
+	keys := make(map[string]bool)
+	for _, k := range []string{"username", "password", "hosts", "connection_url"} {
+		keys[r.keyName(sDef, k)] = true
+	}
+	for _, output := range sDef.Spec.Outputs {
+		keys[output.Key] = true
+	}
+	return keys
+}
+
+// outputHash is used to detect changes to the templates, key names and connection strings
+func (r *DbSecretReconciler) outputHash(sDef *digitalisiov1beta1.DbSecret) string {
+	hash := utils.CreateFakeHash(sDef.Spec.Template)
+	if hash == "" || (sDef.Spec.Secret == digitalisiov1beta1.DbSecretKeys{} && len(sDef.Spec.Outputs) == 0) {
+		return hash
+	}
+	outputs, err := json.Marshal(struct {
+		Secret  digitalisiov1beta1.DbSecretKeys
+		Outputs []digitalisiov1beta1.DbSecretOutput
+	}{sDef.Spec.Secret, sDef.Spec.Outputs})
+	if err != nil {
+		return hash
+	}
+	return utils.SecretHashString(map[string]string{
+		"template": hash,
+		"outputs":  string(outputs),
+	})
+}
+
+// renderOutputs builds the connection strings requested in spec.outputs
+func (r *DbSecretReconciler) renderOutputs(sDef *digitalisiov1beta1.DbSecret, creds vault.VaultDbSecret) map[string][]byte {
+	data := make(map[string][]byte)
+	if len(sDef.Spec.Outputs) == 0 {
+		return data
+	}
+
+	hosts := connstr.SplitHosts(creds.Hosts)
+	urlHosts, database, urlOptions := connstr.ParseConnectionURL(creds.ConnectionURLTemplate)
+	if len(hosts) == 0 {
+		hosts = urlHosts
+	}
+
+	for _, output := range sDef.Spec.Outputs {
+		/* TLS and auth options of the engine are kept unless the output overrides them */
+		options := make(map[string]string)
+		utils.MergeMap(options, urlOptions)
+		utils.MergeMap(options, output.Options)
+		params := connstr.Params{
+			Username: creds.Username,
+			Password: creds.Password,
+			Hosts:    hosts,
+			Database: database,
+			Options:  options,
+		}
+		if output.Database != "" {
+			params.Database = output.Database
+		}
+		value, err := connstr.Build(output.Format, params)
+		if err != nil {
+			r.Log.Error(err, "Cannot build connection string", "key", output.Key, "name", sDef.Name, "namespace", sDef.Namespace)
+			if r.recordingEnabled(sDef) {
+				msg := fmt.Sprintf("Connection string %s could not be built: %v", output.Key, err)
+				r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", msg)
+			}
+			continue
+		}
+		data[output.Key] = []byte(value)
+	}
+	return data
+}
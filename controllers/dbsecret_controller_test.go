@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/utils"
+	"digitalis.io/vals-operator/vault"
+)
+
+func TestMigrateLeaseId(t *testing.T) {
+	tests := []struct {
+		name string
+		// mount the lease was issued from and mount of the spec
+		issued string
+		mount  string
+		// whether the short id is recorded instead of the full one
+		short bool
+		// recorded lease id, relative to the issued mount
+		expected string
+	}{
+		{name: "Full lease id is used as is", issued: "database", mount: "database", expected: "full"},
+		{name: "Legacy short id is expanded", issued: "database", mount: "database", short: true, expected: "full"},
+		{name: "Legacy short id with nested mount is expanded", issued: "teams/db/prod", mount: "/teams/db/prod/", short: true, expected: "full"},
+		{name: "Legacy short id of a changed mount is not resolved", issued: "database", mount: "database-v2", short: true, expected: "short"},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := vault.NewMemoryBackend()
+			lease, err := backend.Client().Read(ctx, tt.issued+"/creds/readonly")
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorded := lease.LeaseID
+			if tt.short {
+				recorded = path.Base(lease.LeaseID)
+			}
+
+			sDef := &digitalisiov1beta1.DbSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+				Spec: digitalisiov1beta1.DbSecretSpec{
+					Vault: digitalisiov1beta1.DbVaultConfig{Mount: tt.mount, Role: "readonly"},
+				},
+			}
+			current := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Annotations: map[string]string{leaseIdLabel: recorded}},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sDef, current).Build()
+			r := &DbSecretReconciler{
+				Client:     c,
+				Ctx:        ctx,
+				Log:        logr.Discard(),
+				Identities: testIdentities(backend.Client()),
+			}
+			if err := r.migrateLeaseId(ctx, sDef, current); err != nil {
+				t.Fatal(err)
+			}
+
+			secret := &corev1.Secret{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, secret); err != nil {
+				t.Fatal(err)
+			}
+			expected, resolved := lease.LeaseID, lease.LeaseID
+			if tt.expected == "short" {
+				expected, resolved = recorded, ""
+			}
+			if id := secret.Annotations[leaseIdLabel]; id != expected {
+				t.Errorf("Expected lease id %s to be recorded but got %s", expected, id)
+			}
+			if id := leaseIdFromSecret(secret); id != resolved {
+				t.Errorf("Expected lease id %q but got %q", resolved, id)
+			}
+		})
+	}
+}
+
+func TestDbSecretReconcileRotation(t *testing.T) {
+	failSecretUpdates := interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if _, ok := obj.(*corev1.Secret); ok {
+				return fmt.Errorf("secrets are read-only")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}
+
+	tests := []struct {
+		name    string
+		mount   string
+		vaultNs string
+		fail    string
+		funcs   interceptor.Funcs
+		wantErr bool
+		rotated bool
+	}{
+		{name: "Nested mount keeps the old lease until it expires", mount: "teams/db/prod", rotated: true},
+		{name: "Namespaced engine keeps the old lease until it expires", mount: "database", vaultNs: "team-a", rotated: true},
+		{name: "Failed issue keeps the old credentials", mount: "database", fail: "read", wantErr: true},
+		{name: "Unsaved credentials are revoked", mount: "database", funcs: failSecretUpdates, wantErr: true},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := vault.NewMemoryBackend()
+			old, err := backend.Client().WithNamespace(tt.vaultNs).Read(ctx, tt.mount+"/creds/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldLease := strings.Trim(tt.vaultNs+"/"+old.LeaseID, "/")
+
+			sDef := &digitalisiov1beta1.DbSecret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "db",
+					Namespace:  "default",
+					Finalizers: []string{"dbsecret.digitalis.io/finalizer"},
+				},
+				Spec: digitalisiov1beta1.DbSecretSpec{
+					Vault: digitalisiov1beta1.DbVaultConfig{Mount: tt.mount, Role: "app", Namespace: tt.vaultNs},
+				},
+			}
+			annotations := map[string]string{
+				leaseIdLabel:       old.LeaseID,
+				leaseDurationLabel: fmt.Sprint(old.LeaseDuration),
+				// about to expire, so new credentials are issued
+				expiresOnLabel: fmt.Sprint(time.Now().Unix() + 60),
+			}
+			if tt.vaultNs != "" {
+				annotations[vaultNamespaceLabel] = tt.vaultNs
+			}
+			current := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Annotations: annotations},
+				Data:       map[string][]byte{"username": []byte(old.Data["username"].(string))},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(sDef, current).
+				WithInterceptorFuncs(tt.funcs).
+				Build()
+			if tt.fail != "" {
+				backend.Fail(tt.fail, -1, fmt.Errorf("%s failed", tt.fail))
+			}
+			r := &DbSecretReconciler{
+				Client:     c,
+				Scheme:     scheme,
+				Ctx:        ctx,
+				Log:        logr.Discard(),
+				Recorder:   record.NewFakeRecorder(10),
+				Identities: testIdentities(backend.Client()),
+			}
+
+			_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v but got %v", tt.wantErr, err)
+			}
+			backend.Reset()
+
+			secret := &corev1.Secret{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, secret); err != nil {
+				t.Fatal(err)
+			}
+			leases := backend.Leases()
+			if !utils.ContainsString(leases, oldLease) {
+				t.Errorf("Expected the old lease %s to be left to expire but got %v", oldLease, leases)
+			}
+			if !tt.rotated {
+				if secret.Annotations[leaseIdLabel] != old.LeaseID {
+					t.Errorf("Expected the secret to keep lease %s but got %s", old.LeaseID, secret.Annotations[leaseIdLabel])
+				}
+				if len(leases) != 1 {
+					t.Errorf("Expected only the old lease to be active but got %v", leases)
+				}
+				return
+			}
+			newLease := secret.Annotations[leaseIdLabel]
+			if newLease == old.LeaseID || !strings.HasPrefix(newLease, tt.mount+"/creds/app/") {
+				t.Errorf("Expected a new lease of %s/creds/app but got %s", tt.mount, newLease)
+			}
+			if !utils.ContainsString(leases, strings.Trim(tt.vaultNs+"/"+newLease, "/")) {
+				t.Errorf("Expected the new lease %s to be active but got %v", newLease, leases)
+			}
+			if previous := secret.Annotations[previousLeaseIdLabel]; previous != old.LeaseID {
+				t.Errorf("Expected the previous lease %s to be recorded but got %s", old.LeaseID, previous)
+			}
+		})
+	}
+}
+
+func TestDbSecretReconcile(t *testing.T) {
+	failSecretWrites := interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if _, ok := obj.(*corev1.Secret); ok {
+				return fmt.Errorf("secrets are read-only")
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+	}
+
+	tests := []struct {
+		name string
+		// lease of the current secret: none, valid, expiring or revoked
+		lease    string
+		renew    bool
+		deleting bool
+		fail     string
+		funcs    interceptor.Funcs
+		wantErr  bool
+		// whether the secret is left, with a new lease or renewed
+		secret  bool
+		rotated bool
+		renewed bool
+		// leases left active
+		leases int
+	}{
+		{name: "Create", lease: "none", secret: true, rotated: true, leases: 1},
+		{name: "Create fails to issue", lease: "none", fail: "read", wantErr: true},
+		{name: "Create fails to save", lease: "none", funcs: failSecretWrites, wantErr: true},
+		{name: "Valid lease is kept", lease: "valid", secret: true, leases: 1},
+		{name: "Renew", lease: "expiring", renew: true, secret: true, renewed: true, leases: 1},
+		{name: "Renew fails", lease: "expiring", renew: true, fail: "renew", wantErr: true, secret: true, leases: 1},
+		{name: "Rotate", lease: "expiring", secret: true, rotated: true, leases: 2},
+		{name: "Revoked lease is replaced", lease: "revoked", secret: true, rotated: true, leases: 1},
+		{name: "Delete revokes the lease", lease: "valid", deleting: true},
+		{name: "Delete when the lease cannot be revoked", lease: "valid", deleting: true, fail: "revoke", leases: 1},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := vault.NewMemoryBackend()
+			vc := backend.Client()
+
+			sDef := &digitalisiov1beta1.DbSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+				Spec: digitalisiov1beta1.DbSecretSpec{
+					Vault: digitalisiov1beta1.DbVaultConfig{Mount: "database", Role: "app"},
+					Renew: tt.renew,
+				},
+			}
+			if tt.deleting {
+				now := metav1.Now()
+				sDef.DeletionTimestamp = &now
+				sDef.Finalizers = []string{"dbsecret.digitalis.io/finalizer"}
+			}
+			objects := []client.Object{sDef}
+
+			var oldLease string
+			var oldExpiry string
+			if tt.lease != "none" {
+				old, err := vc.Read(ctx, "database/creds/app")
+				if err != nil {
+					t.Fatal(err)
+				}
+				oldLease = old.LeaseID
+				expires := time.Now().Unix() + 3600
+				if tt.lease == "expiring" {
+					expires = time.Now().Unix() + 60
+				}
+				if tt.lease == "revoked" {
+					if err := vc.Revoke(ctx, oldLease); err != nil {
+						t.Fatal(err)
+					}
+				}
+				oldExpiry = fmt.Sprint(expires)
+				objects = append(objects, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Annotations: map[string]string{
+						leaseIdLabel:       oldLease,
+						leaseDurationLabel: fmt.Sprint(old.LeaseDuration),
+						expiresOnLabel:     oldExpiry,
+					}},
+					Data: map[string][]byte{"username": []byte(old.Data["username"].(string))},
+				})
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(objects...).
+				WithInterceptorFuncs(tt.funcs).
+				Build()
+			if tt.fail != "" {
+				backend.Fail(tt.fail, -1, fmt.Errorf("%s failed", tt.fail))
+			}
+			r := &DbSecretReconciler{
+				Client:     c,
+				Scheme:     scheme,
+				Ctx:        ctx,
+				Log:        logr.Discard(),
+				Recorder:   record.NewFakeRecorder(10),
+				Identities: testIdentities(vc),
+			}
+
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "db"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v but got %v", tt.wantErr, err)
+			}
+			backend.Reset()
+
+			if leases := backend.Leases(); len(leases) != tt.leases {
+				t.Errorf("Expected %d active leases but got %v", tt.leases, leases)
+			}
+			updated := &digitalisiov1beta1.DbSecret{}
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, updated)
+			if tt.deleting {
+				if !errors.IsNotFound(err) {
+					t.Errorf("Expected the finalizer to be removed but got %v", updated.Finalizers)
+				}
+			} else if !utils.ContainsString(updated.Finalizers, "dbsecret.digitalis.io/finalizer") {
+				t.Errorf("Expected the finalizer to be added but got %v", updated.Finalizers)
+			}
+
+			secret := &corev1.Secret{}
+			err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "db"}, secret)
+			if !tt.secret {
+				if !errors.IsNotFound(err) {
+					t.Errorf("Expected no secret but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			lease := secret.Annotations[leaseIdLabel]
+			if rotated := lease != oldLease; rotated != tt.rotated {
+				t.Errorf("Expected new credentials %v but the secret has lease %s, previously %s", tt.rotated, lease, oldLease)
+			}
+			if tt.rotated && !utils.ContainsString(backend.Leases(), lease) {
+				t.Errorf("Expected the lease %s of the secret to be active", lease)
+			}
+			if tt.rotated && (len(secret.Data["username"]) == 0 || len(secret.Data["password"]) == 0) {
+				t.Errorf("Expected the credentials in the secret but got %d keys", len(secret.Data))
+			}
+			if renewed := !tt.rotated && secret.Annotations[expiresOnLabel] != oldExpiry; renewed != tt.renewed {
+				t.Errorf("Expected renewed %v but the lease expires on %s, previously %s", tt.renewed, secret.Annotations[expiresOnLabel], oldExpiry)
+			}
+		})
+	}
+}
+
+func TestRenderOutputsOptions(t *testing.T) {
+	r := &DbSecretReconciler{Log: logr.Discard()}
+	sDef := &digitalisiov1beta1.DbSecret{
+		Spec: digitalisiov1beta1.DbSecretSpec{
+			Outputs: []digitalisiov1beta1.DbSecretOutput{
+				{Key: "dsn", Format: "libpq"},
+				{Key: "dsn-verify", Format: "libpq", Options: map[string]string{"sslmode": "verify-full"}},
+			},
+		},
+	}
+	creds := vault.VaultDbSecret{
+		Username:              "app",
+		Password:              "secret",
+		ConnectionURLTemplate: "postgresql://{{username}}:{{password}}@db:5432/app?sslmode=require",
+	}
+
+	data := r.renderOutputs(sDef, creds)
+	expected := map[string]string{
+		"dsn":        "host='db' port='5432' user='app' password='secret' dbname='app' sslmode='require'",
+		"dsn-verify": "host='db' port='5432' user='app' password='secret' dbname='app' sslmode='verify-full'",
+	}
+	for k, v := range expected {
+		if string(data[k]) != v {
+			t.Errorf("Expected %s to be %s but got %s", k, v, data[k])
+		}
+	}
+}
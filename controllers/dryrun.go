@@ -0,0 +1,174 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dmetrics "digitalis.io/vals-operator/metrics"
+)
+
+// dryRunEvent is the reason of the events reporting a change not made
+const dryRunEvent = "DryRun"
+
+// Changes reported in dry-run mode, used as the action label of the metric
+const (
+	dryRunCreateSecret      = "create-secret"
+	dryRunUpdateSecret      = "update-secret"
+	dryRunDeleteSecret      = "delete-secret"
+	dryRunRollout           = "rollout"
+	dryRunUpdateDatabase    = "update-database"
+	dryRunRotateCredentials = "rotate-credentials"
+	dryRunRenewLease        = "renew-lease"
+	dryRunIssueCertificate  = "issue-certificate"
+)
+
+// DryRun reports the changes the controllers would make instead of making
+// them. As nothing is written the same change is found on every
+// reconciliation, so each is only reported again once it differs.
+type DryRun struct {
+	Log logr.Logger
+
+	mu       sync.Mutex
+	reported map[string]string
+}
+
+// NewDryRun returns a reporter logging to log
+func NewDryRun(log logr.Logger) *DryRun {
+	return &DryRun{Log: log, reported: make(map[string]string)}
+}
+
+// Enabled reports whether changes are only reported
+func (d *DryRun) Enabled() bool {
+	return d != nil
+}
+
+// report logs the change, records it as an event when recorder is set and
+// counts it. Messages must not include any secret value.
+func (d *DryRun) report(recorder record.EventRecorder, obj client.Object, kind, action, message string) {
+	key := strings.Join([]string{kind, obj.GetNamespace(), obj.GetName(), action}, "/")
+	d.mu.Lock()
+	if d.reported[key] == message {
+		d.mu.Unlock()
+		return
+	}
+	d.reported[key] = message
+	d.mu.Unlock()
+
+	d.Log.Info(message, "kind", kind, "name", obj.GetName(), "namespace", obj.GetNamespace(), "action", action)
+	if recorder != nil {
+		recorder.Event(obj, corev1.EventTypeNormal, dryRunEvent, message)
+	}
+	dmetrics.DryRunChanges.WithLabelValues(kind, action).Inc()
+}
+
+// forget drops what was reported for a resource once it is gone
+func (d *DryRun) forget(kind, namespace, name string) {
+	if d == nil {
+		return
+	}
+	prefix := strings.Join([]string{kind, namespace, name}, "/") + "/"
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.reported {
+		if strings.HasPrefix(key, prefix) {
+			delete(d.reported, key)
+		}
+	}
+}
+
+// redactedDiff describes the changes to the data of a secret by key name
+// only. Returns an empty string when the data is the same.
+func redactedDiff(oldData, newData map[string][]byte) string {
+	var added, updated, removed []string
+	for k, v := range newData {
+		old, ok := oldData[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case !bytes.Equal(old, v):
+			updated = append(updated, k)
+		}
+	}
+	for k := range oldData {
+		if _, ok := newData[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	var parts []string
+	for _, p := range []struct {
+		name string
+		keys []string
+	}{{"added", added}, {"updated", updated}, {"removed", removed}} {
+		if len(p.keys) > 0 {
+			sort.Strings(p.keys)
+			parts = append(parts, p.name+": "+strings.Join(p.keys, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// plannedRollout describes the workloads the change would restart or reload,
+// or returns an empty string when there are none
+func plannedRollout(ctx context.Context, reader client.Reader, log logr.Logger, policy rolloutPolicy, namespace, mode string, change *secretChange, targets []workloadRef) string {
+	var planned []string
+	found, _ := rolloutTargets(ctx, reader, log, namespace, mode, change.secret, targets)
+	for _, target := range found {
+		object := &unstructured.Unstructured{}
+		specPath := []string{"spec"}
+		if target.APIVersion == "" && strings.ToLower(target.Kind) == "pod" {
+			object.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+		} else {
+			gvk, templatePath, err := target.resolve()
+			if err != nil {
+				log.Error(err, "Could not perform rollout", "secret", change.secret, "namespace", namespace, "kind", target.Kind, "name", target.Name)
+				continue
+			}
+			object.SetGroupVersionKind(gvk)
+			specPath = []string{"spec", "template", "spec"}
+			if len(templatePath) > 0 {
+				specPath = append(append([]string{}, templatePath...), "spec")
+			}
+		}
+		err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, object)
+		if errors.IsNotFound(err) || (err == nil && !change.affects(object, specPath)) {
+			continue
+		}
+		planned = append(planned, target.Kind+"/"+target.Name)
+	}
+	if len(planned) == 0 {
+		return ""
+	}
+	verb := "restart"
+	if policy.reload {
+		verb = "reload"
+	}
+	return fmt.Sprintf("Would %s %s for the changed keys %s", verb, strings.Join(planned, ", "), strings.Join(change.keys, ", "))
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/vault"
+)
+
+func TestRedactedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldData  map[string][]byte
+		newData  map[string][]byte
+		expected string
+	}{
+		{name: "Same", oldData: map[string][]byte{"a": []byte("1")}, newData: map[string][]byte{"a": []byte("1")}},
+		{name: "New secret", newData: map[string][]byte{"b": []byte("2"), "a": []byte("1")}, expected: "added: a, b"},
+		{
+			name:     "All changes",
+			oldData:  map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")},
+			newData:  map[string][]byte{"a": []byte("1"), "b": []byte("two"), "d": []byte("4")},
+			expected: "added: d; updated: b; removed: c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactedDiff(tt.oldData, tt.newData); got != tt.expected {
+				t.Errorf("Expected %q but got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDryRunReport(t *testing.T) {
+	d := NewDryRun(logr.Discard())
+	recorder := record.NewFakeRecorder(10)
+	obj := &secretv1.ValsSecret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	counter := dmetrics.DryRunChanges.WithLabelValues("ValsSecret", dryRunUpdateSecret)
+	before := testutil.ToFloat64(counter)
+
+	for _, message := range []string{"first", "first", "second"} {
+		d.report(recorder, obj, "ValsSecret", dryRunUpdateSecret, message)
+	}
+	d.forget("ValsSecret", "default", "app")
+	d.report(recorder, obj, "ValsSecret", dryRunUpdateSecret, "second")
+
+	if got := testutil.ToFloat64(counter) - before; got != 3 {
+		t.Errorf("Expected 3 changes counted but got %v", got)
+	}
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	expected := []string{"Normal DryRun first", "Normal DryRun second", "Normal DryRun second"}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected events %v but got %v", expected, events)
+	}
+}
+
+func TestPlannedRollout(t *testing.T) {
+	deployment := func(name string, env corev1.EnvVar) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{env}}},
+			}}},
+		}
+	}
+	keyRef := func(key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: "V", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: key,
+		}}}
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		deployment("uses-password", keyRef("password")),
+		deployment("uses-username", keyRef("username")),
+	).Build()
+	targets := []workloadRef{
+		{Kind: "Deployment", Name: "uses-password"},
+		{Kind: "Deployment", Name: "uses-username"},
+		{Kind: "Deployment", Name: "missing"},
+	}
+	change := &secretChange{secret: "app", keys: []string{"password"}}
+
+	got := plannedRollout(context.Background(), c, logr.Discard(), rolloutPolicy{}, "default", "", change, targets)
+	expected := "Would restart Deployment/uses-password for the changed keys password"
+	if got != expected {
+		t.Errorf("Expected %q but got %q", expected, got)
+	}
+	got = plannedRollout(context.Background(), c, logr.Discard(), rolloutPolicy{reload: true}, "default", "", change, targets[1:])
+	if got != "" {
+		t.Errorf("Expected nothing to roll out but got %q", got)
+	}
+}
+
+func TestValsSecretDryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = secretv1.AddToScheme(scheme)
+	sDef := &secretv1.ValsSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1"},
+		Spec: secretv1.ValsSecretSpec{
+			Databases: []secretv1.Database{{
+				Driver:           "postgres",
+				Hosts:            []string{"db"},
+				UsernameKey:      "username",
+				PasswordKey:      "password",
+				LoginCredentials: secretv1.DatabaseLoginCredentials{SecretName: "admin", PasswordKey: "password"},
+			}},
+		},
+	}
+	admin := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("admin")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sDef, admin).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &ValsSecretReconciler{
+		Client:        c,
+		Ctx:           context.Background(),
+		Log:           logr.Discard(),
+		Recorder:      recorder,
+		RecordChanges: true,
+		DryRun:        NewDryRun(logr.Discard()),
+	}
+
+	change, err := r.upsertSecret(sDef, map[string][]byte{"username": []byte("app"), "password": []byte("s3cr3t")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !change.changed() {
+		t.Errorf("Expected the change to be returned for the rollout")
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, &corev1.Secret{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected the secret not to be created but got %v", err)
+	}
+
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		if strings.Contains(e, "s3cr3t") {
+			t.Errorf("Expected the values to be redacted but got %q", e)
+		}
+		events = append(events, e)
+	}
+	expected := []string{
+		"Normal DryRun Would create secret default/app (added: password, username)",
+		"Normal DryRun Would update the password of the user in postgres on db",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected events %v but got %v", expected, events)
+	}
+}
+
+func TestMigrateLeaseIdDryRun(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	sDef := &digitalisiov1beta1.DbSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "1"},
+		Spec: digitalisiov1beta1.DbSecretSpec{
+			Vault: digitalisiov1beta1.DbVaultConfig{Mount: "database", Role: "readonly"},
+		},
+	}
+	backend := vault.NewMemoryBackend()
+	lease, err := backend.Client().Read(context.Background(), "database/creds/readonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := path.Base(lease.LeaseID)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: map[string]string{leaseIdLabel: short}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sDef, secret).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &DbSecretReconciler{
+		Client:        c,
+		Ctx:           context.Background(),
+		Log:           logr.Discard(),
+		Recorder:      recorder,
+		RecordChanges: true,
+		DryRun:        NewDryRun(logr.Discard()),
+		Identities:    testIdentities(backend.Client()),
+	}
+
+	current := secret.DeepCopy()
+	if err := r.migrateLeaseId(context.Background(), sDef, current); err != nil {
+		t.Fatal(err)
+	}
+	stored := &corev1.Secret{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "app"}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if id := stored.Annotations[leaseIdLabel]; id != short {
+		t.Errorf("Expected the secret to be left alone but got lease id %s", id)
+	}
+	if n := len(recorder.Events); n != 1 {
+		t.Errorf("Expected the migration to be reported but got %d events", n)
+	}
+	if id := leaseIdFromSecret(current); id != lease.LeaseID {
+		t.Errorf("Expected the lease id to be resolved to %s but got %s", lease.LeaseID, id)
+	}
+}
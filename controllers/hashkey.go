@@ -0,0 +1,103 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hashKeyField is the key of the secret holding the hash key
+	hashKeyField = "key"
+	hashKeySize  = 32
+)
+
+// hashKey keys the hashes of secret values recorded on workloads, so that
+// they cannot be used to guess the values. It is set once before the
+// controllers start.
+var hashKey []byte
+
+// SetHashKey sets the key the hashes of secret values are computed with
+func SetHashKey(key []byte) {
+	hashKey = key
+}
+
+// NewHashKey returns a random hash key
+func NewHashKey() ([]byte, error) {
+	key := make([]byte, hashKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LoadHashKey reads the hash key from the secret, creating it with a random
+// key when it does not exist yet. Every replica of the operator uses the same
+// key so they record the same hashes.
+func LoadHashKey(ctx context.Context, reader client.Reader, c client.Client, namespace, name string) ([]byte, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: name}
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, key, secret)
+	if errors.IsNotFound(err) {
+		var value []byte
+		if value, err = NewHashKey(); err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{managedByLabel: "vals-operator"},
+			},
+			Data: map[string][]byte{hashKeyField: value},
+		}
+		err = c.Create(ctx, secret)
+		// another replica created it first
+		if errors.IsAlreadyExists(err) {
+			err = reader.Get(ctx, key, secret)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the hash key from secret %s/%s: %w", namespace, name, err)
+	}
+	value := secret.Data[hashKeyField]
+	if len(value) < hashKeySize/2 {
+		return nil, fmt.Errorf("secret %s/%s has no %s of at least %d bytes", namespace, name, hashKeyField, hashKeySize/2)
+	}
+	return value, nil
+}
+
+// valueHashes returns the HMAC of the value of every key with key
+func valueHashes(data map[string][]byte, key []byte) map[string]string {
+	hashes := make(map[string]string, len(data))
+	for k, v := range data {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(v)
+		hashes[k] = hex.EncodeToString(mac.Sum(nil))
+	}
+	return hashes
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoadHashKey(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	ctx := context.Background()
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	key, err := LoadHashKey(ctx, c, c, "vals", "hash-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(key) != hashKeySize {
+		t.Errorf("Expected a key of %d bytes but got %d", hashKeySize, len(key))
+	}
+	again, err := LoadHashKey(ctx, c, c, "vals", "hash-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(key, again) {
+		t.Errorf("Expected the key to be kept")
+	}
+
+	c = fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hash-key", Namespace: "vals"},
+		Data:       map[string][]byte{hashKeyField: []byte("short")},
+	}).Build()
+	if _, err := LoadHashKey(ctx, c, c, "vals", "hash-key"); err == nil {
+		t.Errorf("Expected an error for a short key")
+	}
+}
+
+func TestValueHashes(t *testing.T) {
+	data := map[string][]byte{"password": []byte("hunter2")}
+	keyed := valueHashes(data, []byte("0123456789abcdef"))
+	other := valueHashes(data, []byte("fedcba9876543210"))
+	if keyed["password"] == other["password"] {
+		t.Errorf("Expected the hash to depend on the key")
+	}
+	if again := valueHashes(data, []byte("0123456789abcdef")); again["password"] != keyed["password"] {
+		t.Errorf("Expected the same hash for the same key")
+	}
+	if keyed["password"] == "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7" {
+		t.Errorf("Expected a keyed hash rather than the SHA-256 of the value")
+	}
+}
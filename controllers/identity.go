@@ -0,0 +1,91 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"digitalis.io/vals-operator/vault"
+)
+
+// backendRetryPeriod is how often reconciles paused while the operator is not
+// logged in are retried
+const backendRetryPeriod = 15 * time.Second
+
+// serviceAccountTokenTTL is how long the tokens used to log in are valid for,
+// the minimum accepted by the TokenRequest API
+const serviceAccountTokenTTL = int64(600)
+
+//+kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+
+// ServiceAccountTokenSource issues short lived ServiceAccount tokens with the TokenRequest API
+func ServiceAccountTokenSource(c client.Client, audience string) vault.TokenSource {
+	return func(ctx context.Context, namespace, serviceAccount string) (string, error) {
+		return requestToken(ctx, c, namespace, serviceAccount, audience, serviceAccountTokenTTL)
+	}
+}
+
+// OperatorTokenRequester issues tokens of the operator's own ServiceAccount
+func OperatorTokenRequester(c client.Client, namespace, serviceAccount string) vault.TokenRequester {
+	return func(ctx context.Context, audience string, expiration int64) (string, error) {
+		if namespace == "" || serviceAccount == "" {
+			return "", fmt.Errorf("POD_NAMESPACE and POD_SERVICE_ACCOUNT must be set to request tokens")
+		}
+		return requestToken(ctx, c, namespace, serviceAccount, audience, expiration)
+	}
+}
+
+func requestToken(ctx context.Context, c client.Client, namespace, serviceAccount, audience string, expiration int64) (string, error) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Name: serviceAccount, Namespace: namespace},
+	}
+	tr := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expiration},
+	}
+	if audience != "" {
+		tr.Spec.Audiences = []string{audience}
+	}
+	if err := c.SubResource("token").Create(ctx, sa, tr); err != nil {
+		return "", err
+	}
+	return tr.Status.Token, nil
+}
+
+// secretsClient returns the client for the operator's own identity or, when
+// per-namespace identity is enabled, one logged in as the given ServiceAccount
+func secretsClient(ctx context.Context, identities *vault.IdentityPool, namespace, serviceAccount string) (vault.SecretsClient, error) {
+	if identities == nil {
+		return vault.DefaultClient()
+	}
+	return identities.Client(ctx, namespace, serviceAccount)
+}
+
+// backendUnavailable returns why resources read with the operator's own token
+// cannot be reconciled right now. Such reconciles are requeued quietly until the
+// token renewer has logged in again instead of each one failing on its own.
+func backendUnavailable(identities *vault.IdentityPool) error {
+	if identities != nil {
+		return nil
+	}
+	return vault.Ready()
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/utils"
+	"digitalis.io/vals-operator/vault"
+)
+
+// LeaseAuditor periodically revokes the database leases issued for the roles
+// used by DbSecrets that are not recorded on any secret, such as those left
+// behind when a DbSecret is deleted while the operator is down. It only runs
+// on the leader.
+type LeaseAuditor struct {
+	client.Client
+	Log      logr.Logger
+	Interval time.Duration
+	// MinAge skips leases issued more recently, which may belong to
+	// credentials that are still being written to a secret
+	MinAge time.Duration
+	// DryRun only reports the orphaned leases. Leases carry no record of who
+	// issued them, so revoking also revokes those of other clients of the roles
+	DryRun            bool
+	ExcludeNamespaces map[string]bool
+	Stores            *SecretStores
+
+	// operatorClient returns the client of the operator, replaced in tests
+	operatorClient func() (vault.SecretsClient, error)
+}
+
+// leaseScope is a prefix leases are listed under with one client
+type leaseScope struct {
+	// store the DbSecrets read from, empty for the operator's own backend
+	store string
+	// namespaces of the DbSecrets using the prefix, which a SecretStore is
+	// looked up in and a ClusterSecretStore must be allowed in
+	namespaces     []string
+	vaultNamespace string
+	prefix         string
+}
+
+func (s leaseScope) String() string {
+	if s.vaultNamespace == "" {
+		return s.prefix
+	}
+	return strings.Trim(s.vaultNamespace, "/") + "/" + s.prefix
+}
+
+// NeedLeaderElection makes the manager only start the auditor on the leader
+func (a *LeaseAuditor) NeedLeaderElection() bool {
+	return true
+}
+
+// Start audits the leases every interval until the context is cancelled
+func (a *LeaseAuditor) Start(ctx context.Context) error {
+	a.Log.Info("Auditing database leases", "interval", a.Interval.String(), "dry_run", a.DryRun)
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := a.Audit(ctx); err != nil {
+				a.Log.Error(err, "Lease audit failed")
+			}
+		}
+	}
+}
+
+// Audit lists the leases of every mount and role used by a DbSecret and
+// revokes, or only reports in dry-run mode, those not recorded on a secret
+func (a *LeaseAuditor) Audit(ctx context.Context) error {
+	scopes, err := a.scopes(ctx)
+	if err != nil {
+		dmetrics.LeaseAuditFailures.Inc()
+		return err
+	}
+	owned, err := a.ownedLeases(ctx)
+	if err != nil {
+		dmetrics.LeaseAuditFailures.Inc()
+		return err
+	}
+
+	var errs []error
+	orphans := make(map[string]int)
+	for _, s := range scopes {
+		found, err := a.auditScope(ctx, s, owned)
+		orphans[s.String()] += found
+		if err != nil {
+			dmetrics.LeaseAuditFailures.Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", s, err))
+		}
+	}
+
+	dmetrics.OrphanedLeases.Reset()
+	for p, found := range orphans {
+		dmetrics.OrphanedLeases.WithLabelValues(p).Set(float64(found))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	dmetrics.LeaseAuditTime.SetToCurrentTime()
+	return nil
+}
+
+// scopes returns the prefixes the DbSecrets issue credentials under
+func (a *LeaseAuditor) scopes(ctx context.Context) ([]leaseScope, error) {
+	var list digitalisiov1beta1.DbSecretList
+	if err := a.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("cannot list DbSecrets: %w", err)
+	}
+
+	// a ClusterSecretStore prefix is listed once for all the namespaces
+	// using it, with the client of the first one it is allowed in
+	seen := make(map[string]int)
+	var scopes []leaseScope
+	for i := range list.Items {
+		sDef := &list.Items[i]
+		if a.ExcludeNamespaces[sDef.Namespace] || sDef.Spec.Vault.Role == "" {
+			continue
+		}
+		s := leaseScope{
+			store:          dbStoreName(sDef),
+			vaultNamespace: sDef.Spec.Vault.Namespace,
+			prefix:         fmt.Sprintf("%s/creds/%s", strings.Trim(sDef.Spec.Vault.Mount, "/"), sDef.Spec.Vault.Role),
+		}
+		key := fmt.Sprint(s)
+		if strings.HasPrefix(s.store, secretStoreKind+"/") {
+			key += "/" + sDef.Namespace
+		}
+		j, ok := seen[key]
+		if !ok {
+			j = len(scopes)
+			seen[key] = j
+			scopes = append(scopes, s)
+		}
+		if !utils.ContainsString(scopes[j].namespaces, sDef.Namespace) {
+			scopes[j].namespaces = append(scopes[j].namespaces, sDef.Namespace)
+		}
+	}
+	for _, s := range scopes {
+		sort.Strings(s.namespaces)
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		return fmt.Sprint(scopes[i]) < fmt.Sprint(scopes[j])
+	})
+	return scopes, nil
+}
+
+// ownedLeases returns the lease IDs recorded on secrets, including the leases
+// replaced by new credentials that are left to expire. Older releases only
+// recorded the last element of the lease ID, which is kept as is.
+func (a *LeaseAuditor) ownedLeases(ctx context.Context) (map[string]bool, error) {
+	var list corev1.SecretList
+	if err := a.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("cannot list secrets: %w", err)
+	}
+	owned := make(map[string]bool)
+	for _, secret := range list.Items {
+		for _, key := range []string{leaseIdLabel, previousLeaseIdLabel} {
+			if id := secret.Annotations[key]; id != "" {
+				owned[id] = true
+			}
+		}
+	}
+	return owned, nil
+}
+
+// auditScope revokes the orphaned leases under the prefix and returns how many
+// were found
+func (a *LeaseAuditor) auditScope(ctx context.Context, s leaseScope, owned map[string]bool) (int, error) {
+	c, err := a.client(ctx, s)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := vault.ListLeases(ctx, c, s.prefix)
+	if err != nil {
+		return 0, fmt.Errorf("cannot list leases: %w", err)
+	}
+
+	found := 0
+	var errs []error
+	for _, id := range ids {
+		if owned[id] || owned[path.Base(id)] {
+			continue
+		}
+		issued, err := vault.LeaseIssueTime(ctx, c, id)
+		if err != nil {
+			// it may have expired or been revoked since it was listed
+			a.Log.V(1).Info("Cannot look up lease", "lease", id, "error", err.Error())
+			continue
+		}
+		if time.Since(issued) < a.MinAge {
+			continue
+		}
+
+		found++
+		if a.DryRun {
+			a.Log.Info("Orphaned lease found", "lease", id, "issued", issued.UTC().Format(time.RFC3339), "dry_run", true)
+			continue
+		}
+		if err := vault.RevokeDbCredentials(ctx, c, id); err != nil {
+			errs = append(errs, fmt.Errorf("cannot revoke lease %s: %w", id, err))
+			continue
+		}
+		a.Log.Info("Orphaned lease revoked", "lease", id, "issued", issued.UTC().Format(time.RFC3339))
+		dmetrics.OrphanedLeasesRevoked.WithLabelValues(s.String()).Inc()
+	}
+	return found, errors.Join(errs...)
+}
+
+// client returns the client leases of the scope are listed with. Leases issued
+// with the identity of a namespace are listed with the operator's own token.
+// A ClusterSecretStore is used as in the first namespace of the scope it is
+// allowed in.
+func (a *LeaseAuditor) client(ctx context.Context, s leaseScope) (vault.SecretsClient, error) {
+	var c vault.SecretsClient
+	var err error
+	switch {
+	case s.store != "":
+		for _, namespace := range s.namespaces {
+			if c, err = a.Stores.clientFor(ctx, s.store, namespace); err == nil {
+				break
+			}
+		}
+	case a.operatorClient != nil:
+		c, err = a.operatorClient()
+	default:
+		if err = vault.Ready(); err == nil {
+			c, err = vault.DefaultClient()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.WithNamespace(s.vaultNamespace), nil
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/vault"
+)
+
+func TestLeaseAuditor(t *testing.T) {
+	tests := []struct {
+		name     string
+		dryRun   bool
+		minAge   time.Duration
+		expected []string
+	}{
+		{name: "Orphaned leases are revoked", expected: []string{"app-owned", "app-replaced", "app-short", "other-orphan", "team-b-orphan"}},
+		{name: "Dry run", dryRun: true, expected: []string{"app-orphan", "app-owned", "app-replaced", "app-short", "other-orphan", "team-b-orphan"}},
+		{name: "Recent leases are kept", minAge: time.Hour, expected: []string{"app-orphan", "app-owned", "app-replaced", "app-short", "other-orphan", "team-b-orphan"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := vault.NewMemoryBackend()
+			vc := backend.Client()
+
+			// leases are named after the test case to check which are left
+			leases := make(map[string]string)
+			issue := func(name, role string) string {
+				creds, err := vault.GetDbCredentials(ctx, vc, role, "database")
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				leases[creds.LeaseId] = name
+				return creds.LeaseId
+			}
+			owned := issue("app-owned", "app")
+			// replaced by the owned lease and left to expire
+			replaced := issue("app-replaced", "app")
+			short := issue("app-short", "app")
+			issue("app-orphan", "app")
+			// no DbSecret uses this role
+			issue("other-orphan", "other")
+			// only used by a DbSecret in an excluded namespace
+			issue("team-b-orphan", "team-b")
+
+			dbSecret := func(name, namespace, role string) *digitalisiov1beta1.DbSecret {
+				return &digitalisiov1beta1.DbSecret{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+					Spec: digitalisiov1beta1.DbSecretSpec{
+						Vault: digitalisiov1beta1.DbVaultConfig{Role: role, Mount: "/database/"},
+					},
+				}
+			}
+			secret := func(name, leaseId, previous string) *corev1.Secret {
+				return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   "team-a",
+					Annotations: map[string]string{leaseIdLabel: leaseId, previousLeaseIdLabel: previous},
+				}}
+			}
+
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = digitalisiov1beta1.AddToScheme(scheme)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				dbSecret("app", "team-a", "app"),
+				dbSecret("app-copy", "team-a", "app"),
+				dbSecret("team-b", "team-b", "team-b"),
+				secret("app", owned, replaced),
+				secret("app-old", path.Base(short), ""),
+			).Build()
+
+			auditor := &LeaseAuditor{
+				Client:            c,
+				Log:               logr.Discard(),
+				MinAge:            tt.minAge,
+				DryRun:            tt.dryRun,
+				ExcludeNamespaces: map[string]bool{"team-b": true},
+				operatorClient:    func() (vault.SecretsClient, error) { return vc, nil },
+			}
+			if err := auditor.Audit(ctx); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var left []string
+			for _, id := range backend.Leases() {
+				left = append(left, leases[id])
+			}
+			sort.Strings(left)
+			if strings.Join(left, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v but got %v", tt.expected, left)
+			}
+		})
+	}
+}
+
+func TestLeaseAuditorClusterSecretStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		store digitalisiov1beta1.ClusterSecretStoreSpec
+	}{
+		{name: "Namespace patterns", store: digitalisiov1beta1.ClusterSecretStoreSpec{Namespaces: []string{"team-*"}}},
+		{name: "Namespace selector", store: digitalisiov1beta1.ClusterSecretStoreSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"vault": "shared"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := vault.NewMemoryBackend()
+			owned, err := vault.GetDbCredentials(ctx, backend.Client(), "app", "database")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			orphan, err := vault.GetDbCredentials(ctx, backend.Client(), "app", "database")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			tt.store.Backend = "vault"
+			tt.store.Address = "http://vault:8200"
+			tt.store.Auth.Token = &digitalisiov1beta1.TokenAuth{
+				SecretRef: digitalisiov1beta1.SecretKeySelector{Name: "token", Namespace: "vault", Key: "token"},
+			}
+			dbSecret := func(namespace string) *digitalisiov1beta1.DbSecret {
+				return &digitalisiov1beta1.DbSecret{
+					ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: namespace},
+					Spec: digitalisiov1beta1.DbSecretSpec{
+						Vault:    digitalisiov1beta1.DbVaultConfig{Role: "app", Mount: "database"},
+						StoreRef: &digitalisiov1beta1.SecretStoreRef{Kind: clusterSecretStoreKind, Name: "shared"},
+					},
+				}
+			}
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = digitalisiov1beta1.AddToScheme(scheme)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"vault": "shared"}}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "vault"}, Data: map[string][]byte{"token": []byte("t")}},
+				&digitalisiov1beta1.ClusterSecretStore{ObjectMeta: metav1.ObjectMeta{Name: "shared"}, Spec: tt.store},
+				// sorted first but not allowed to use the store
+				dbSecret("other"),
+				dbSecret("team-a"),
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Namespace:   "team-a",
+					Annotations: map[string]string{leaseIdLabel: owned.LeaseId, secretStoreLabel: "ClusterSecretStore/shared"},
+				}},
+			).Build()
+			stores := NewSecretStores(c)
+			stores.newClient = func(vault.ClientConfig) (vault.SecretsClient, error) {
+				return backend.Client(), nil
+			}
+
+			auditor := &LeaseAuditor{Client: c, Log: logr.Discard(), Stores: stores}
+			scopes, err := auditor.scopes(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(scopes) != 1 {
+				t.Fatalf("Expected one scope for the store but got %v", scopes)
+			}
+			if err := auditor.Audit(ctx); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			left := backend.Leases()
+			if len(left) != 1 || left[0] != owned.LeaseId {
+				t.Errorf("Expected only %s to be left but got %v (orphan %s)", owned.LeaseId, left, orphan.LeaseId)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"digitalis.io/vals-operator/maintenance"
+)
+
+// ignoreMaintenanceAnnotation applies changes straight away while it is set to true
+const ignoreMaintenanceAnnotation = "vals-operator.digitalis.io/ignore-maintenance-window"
+
+// heldUntil returns when the windows next open if a change to the resource
+// has to wait for them, otherwise the zero time
+func heldUntil(obj client.Object, windows maintenance.Windows, now time.Time) time.Time {
+	if obj.GetAnnotations()[ignoreMaintenanceAnnotation] == "true" {
+		return time.Time{}
+	}
+	at, ok := windows.NextOpen(now)
+	// a schedule that never matches must not hold changes forever
+	if !ok || !at.After(now) {
+		return time.Time{}
+	}
+	return at
+}
+
+// rolloutWindows returns the windows the restarts made for the resource wait
+// for, none when it ignores them
+func rolloutWindows(obj client.Object, windows maintenance.Windows) maintenance.Windows {
+	if obj.GetAnnotations()[ignoreMaintenanceAnnotation] == "true" {
+		return nil
+	}
+	return windows
+}
+
+// stillHeld returns when the window opens while the changes recorded as
+// pending are still held, or zero once they may be applied. Held changes are
+// read again from the backend once the window opens rather than on every
+// requeue.
+func stillHeld(obj client.Object, pending *metav1.Time, windows maintenance.Windows, now time.Time) time.Time {
+	if pending == nil || !now.Before(pending.Time) {
+		return time.Time{}
+	}
+	return heldUntil(obj, windows, now)
+}
+
+// heldRequeue returns when to check a held resource again
+func heldRequeue(until time.Time, period time.Duration) time.Duration {
+	if d := time.Until(until); d < period {
+		return d
+	}
+	return period
+}
+
+// setPendingUntil records until when changes are held in the status of the
+// resource, clearing it when until is zero. It returns whether it changed.
+func setPendingUntil(ctx context.Context, c client.Client, obj client.Object, field **metav1.Time, until time.Time) (bool, error) {
+	var value *metav1.Time
+	if !until.IsZero() {
+		t := metav1.NewTime(until.Truncate(time.Second))
+		value = &t
+	}
+	if (*field == nil && value == nil) || (*field != nil && value != nil && (*field).Equal(value)) {
+		return false, nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	*field = value
+	return true, c.Status().Patch(ctx, obj, patch)
+}
+
+// holdChanges records that the changes to the resource wait for a maintenance
+// window and returns when to check it again
+func holdChanges(ctx context.Context, c client.Client, log logr.Logger, recorder record.EventRecorder, obj client.Object, field **metav1.Time, until time.Time, period time.Duration) time.Duration {
+	changed, err := setPendingUntil(ctx, c, obj, field, until)
+	if err != nil {
+		log.Error(err, "Cannot update status", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+	if changed {
+		log.Info("Changes held until the maintenance window opens", "name", obj.GetName(), "namespace", obj.GetNamespace(), "until", until.UTC().Format(time.RFC3339))
+		if recorder != nil {
+			recorder.Event(obj, corev1.EventTypeNormal, "Pending", fmt.Sprintf("Changes held until the maintenance window opens at %s", until.UTC().Format(time.RFC3339)))
+		}
+	}
+	return heldRequeue(until, period)
+}
+
+// releaseChanges clears the pending time once the changes have been applied
+func releaseChanges(ctx context.Context, c client.Client, log logr.Logger, obj client.Object, field **metav1.Time) {
+	if _, err := setPendingUntil(ctx, c, obj, field, time.Time{}); err != nil {
+		log.Error(err, "Cannot update status", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+}
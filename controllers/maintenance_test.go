@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	"digitalis.io/vals-operator/maintenance"
+)
+
+func TestHeldUntil(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)
+	window := func(schedule string) maintenance.Windows {
+		w, err := maintenance.NewWindow(schedule, "2h", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return maintenance.Windows{w}
+	}
+
+	tests := []struct {
+		name        string
+		windows     maintenance.Windows
+		annotations map[string]string
+		expected    time.Time
+	}{
+		{name: "No windows"},
+		{name: "Window open", windows: window("0 10 * * *")},
+		{name: "Window closed", windows: window("0 2 * * sat"), expected: time.Date(2026, 3, 7, 2, 0, 0, 0, time.UTC)},
+		{name: "Window ignored", windows: window("0 2 * * sat"), annotations: map[string]string{ignoreMaintenanceAnnotation: "true"}},
+		{name: "Window never opens", windows: window("0 0 30 2 *")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &secretv1.ValsSecret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: tt.annotations}}
+			if got := heldUntil(obj, tt.windows, now); !got.Equal(tt.expected) {
+				t.Errorf("Expected %s but got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetPendingUntil(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = secretv1.AddToScheme(scheme)
+	obj := &secretv1.ValsSecret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(obj).WithStatusSubresource(obj).Build()
+	ctx := context.Background()
+	until := time.Date(2026, 3, 7, 2, 0, 0, 0, time.UTC)
+
+	stored := func() *metav1.Time {
+		got := &secretv1.ValsSecret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "app"}, got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Status.PendingUntil
+	}
+
+	for _, step := range []struct {
+		until   time.Time
+		changed bool
+	}{{until, true}, {until, false}, {time.Time{}, true}, {time.Time{}, false}} {
+		changed, err := setPendingUntil(ctx, c, obj, &obj.Status.PendingUntil, step.until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != step.changed {
+			t.Errorf("Expected changed to be %v but got %v", step.changed, changed)
+		}
+		got := stored()
+		if step.until.IsZero() != (got == nil) || (got != nil && !got.Time.Equal(step.until)) {
+			t.Errorf("Expected pendingUntil %s but got %v", step.until, got)
+		}
+	}
+}
+
+func TestValsSecretHeldChangesNotRead(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pending time.Duration
+		read    bool
+	}{
+		{name: "Held", pending: time.Hour},
+		{name: "Window opened", pending: -time.Minute, read: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = secretv1.AddToScheme(scheme)
+			sDef := &secretv1.ValsSecret{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Finalizers: []string{"vals.digitalis.io/finalizer"}},
+				Spec: secretv1.ValsSecretSpec{
+					// fails when read, and opens on New Year's Day
+					Data:               map[string]secretv1.DataSource{"password": {Ref: "ref+unknown://password"}},
+					MaintenanceWindows: []secretv1.MaintenanceWindow{{Schedule: "0 0 1 1 *", Duration: "1m"}},
+				},
+				Status: secretv1.ValsSecretStatus{PendingUntil: &metav1.Time{Time: time.Now().Add(tt.pending)}},
+			}
+			current := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Data:       map[string][]byte{"password": []byte("old")},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sDef, current).WithStatusSubresource(sDef).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &ValsSecretReconciler{
+				Client:               c,
+				Ctx:                  context.Background(),
+				Log:                  logr.Discard(),
+				Recorder:             recorder,
+				RecordChanges:        true,
+				ReconciliationPeriod: 5 * time.Second,
+			}
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "app"}}); err != nil {
+				t.Fatal(err)
+			}
+			close(recorder.Events)
+			read := false
+			for e := range recorder.Events {
+				read = read || strings.Contains(e, "Failed to get secrets")
+			}
+			if read != tt.read {
+				t.Errorf("Expected the data to be read to be %v but got %v", tt.read, read)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=patch
+//+kubebuilder:rbac:groups="",resources=pods/proxy,verbs=get;create;update
+
+const (
+	// rolloutStrategyReload annotates the running pods instead of replacing them
+	rolloutStrategyReload = "reload"
+	defaultReloadPath     = "/-/reload"
+	defaultReloadDelay    = 10 * time.Second
+	// maxReloadResult keeps the error recorded on the pod short
+	maxReloadResult = 256
+)
+
+// reloadEndpoint is the HTTP endpoint called on each pod
+type reloadEndpoint struct {
+	port   int32
+	path   string
+	method string
+	scheme string
+	// delay gives kubelet time to refresh the mounted secret before the call
+	delay time.Duration
+}
+
+// newReloadEndpoint applies the defaults to the reload endpoint of a resource
+func newReloadEndpoint(port int32, path, method, scheme, delay string) (*reloadEndpoint, error) {
+	e := &reloadEndpoint{port: port, path: path, method: method, scheme: scheme, delay: defaultReloadDelay}
+	if e.path == "" {
+		e.path = defaultReloadPath
+	}
+	if !strings.HasPrefix(e.path, "/") {
+		e.path = "/" + e.path
+	}
+	if e.method == "" {
+		e.method = "POST"
+	}
+	if e.scheme == "" {
+		e.scheme = "http"
+	}
+	if delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return e, fmt.Errorf("invalid reload.delay %q: %w", delay, err)
+		}
+		e.delay = d
+	}
+	return e, nil
+}
+
+// PodReloader calls the reload endpoint of pods through the API server proxy,
+// so that the operator does not need to reach the pod network
+type PodReloader struct {
+	client rest.Interface
+}
+
+// NewPodReloader returns a reloader using the given configuration
+func NewPodReloader(config *rest.Config) (*PodReloader, error) {
+	c, err := corev1client.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &PodReloader{client: c.RESTClient()}, nil
+}
+
+// Reload calls the endpoint of the pod and fails unless it answers with a
+// 2xx status
+func (p *PodReloader) Reload(ctx context.Context, namespace, pod string, endpoint *reloadEndpoint) error {
+	return p.client.Verb(endpoint.method).
+		Namespace(namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%s:%s:%d", endpoint.scheme, pod, endpoint.port)).
+		SubResource("proxy").
+		Suffix(endpoint.path).
+		Do(ctx).
+		Error()
+}
+
+// reloadWorkload annotates the running pods of a workload with the hash of
+// the secrets, which makes kubelet refresh the mounted secret sooner, and then
+// calls the reload endpoint of each of them when there is one. The result is
+// recorded on every pod. Pods already annotated with these versions of the
+// secrets are left alone. Returns whether any pod was reloaded.
+func reloadWorkload(ctx context.Context, c client.Client, reloader *PodReloader, log logr.Logger, namespace string, target workloadRef, endpoint *reloadEndpoint, changes ...*secretChange) (bool, error) {
+	pods, err := workloadPods(ctx, c, log, namespace, target, changes)
+	if err != nil || len(pods) == 0 {
+		return false, err
+	}
+
+	now := time.Now().UTC().Format(timeLayout)
+	var annotated []*corev1.Pod
+	for _, pod := range pods {
+		values := hashValues(changes, &pod.Spec)
+		if annotationsCurrent(pod.Annotations, values) {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		for k, v := range values {
+			pod.Annotations[k] = v
+		}
+		pod.Annotations[reloadedAnnotation] = now
+		if endpoint == nil {
+			pod.Annotations[reloadResultAnnotation] = "Succeeded"
+		}
+		if err := c.Patch(ctx, pod, patch); err != nil {
+			log.Error(err, fmt.Sprintf("Could not annotate Pod/%s in namespace %s", pod.Name, namespace))
+			continue
+		}
+		log.Info(fmt.Sprintf("Reloading Pod/%s of %s/%s in namespace %s", pod.Name, target.Kind, target.Name, namespace))
+		annotated = append(annotated, pod)
+	}
+	if endpoint == nil || len(annotated) == 0 {
+		return len(annotated) > 0, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-time.After(endpoint.delay):
+	}
+	failed := 0
+	for _, pod := range annotated {
+		result := "Succeeded"
+		var err error
+		if reloader == nil {
+			err = fmt.Errorf("no reloader configured")
+		} else {
+			err = reloader.Reload(ctx, namespace, pod.Name, endpoint)
+		}
+		if err != nil {
+			failed++
+			log.Error(err, fmt.Sprintf("Could not reload Pod/%s in namespace %s", pod.Name, namespace))
+			result = "Failed: " + err.Error()
+			if len(result) > maxReloadResult {
+				result = result[:maxReloadResult]
+			}
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		pod.Annotations[reloadResultAnnotation] = result
+		if err := c.Patch(ctx, pod, patch); err != nil {
+			log.Error(err, fmt.Sprintf("Could not record the reload of Pod/%s in namespace %s", pod.Name, namespace))
+		}
+	}
+	if failed > 0 {
+		return true, fmt.Errorf("%d of %d pods of %s/%s could not be reloaded", failed, len(annotated), target.Kind, target.Name)
+	}
+	return true, nil
+}
+
+// annotationsCurrent reports whether the annotations already hold the values.
+// Without values the pods are always reloaded.
+func annotationsCurrent(annotations, values map[string]string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for k, v := range values {
+		if annotations[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// workloadPods returns the running pods of a workload affected by the changes,
+// found with the selector of the workload. CronJobs have no running pods to
+// reload, their next Job uses the new secret.
+func workloadPods(ctx context.Context, c client.Client, log logr.Logger, namespace string, target workloadRef, changes []*secretChange) ([]*corev1.Pod, error) {
+	running := func(pod *corev1.Pod) bool {
+		return pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning
+	}
+
+	if target.APIVersion == "" {
+		switch strings.ToLower(target.Kind) {
+		case "pod":
+			pod := &corev1.Pod{}
+			err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, pod)
+			if errors.IsNotFound(err) {
+				log.Error(err, fmt.Sprintf("Pod/%s in namespace %s not found", target.Name, namespace))
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+			if err != nil {
+				return nil, err
+			}
+			if !running(pod) || !affected(changes, &unstructured.Unstructured{Object: raw}, []string{"spec"}) {
+				return nil, nil
+			}
+			return []*corev1.Pod{pod}, nil
+		case "cronjob":
+			log.Info(fmt.Sprintf("Skipping CronJob/%s in namespace %s, its next run uses the new secret", target.Name, namespace))
+			return nil, nil
+		}
+	}
+
+	gvk, templatePath, err := target.resolve()
+	if err != nil {
+		return nil, err
+	}
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+	err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Name}, object)
+	if errors.IsNotFound(err) {
+		log.Error(err, fmt.Sprintf("%s/%s in namespace %s not found", target.Kind, target.Name, namespace))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	specPath := []string{"spec", "template", "spec"}
+	if len(templatePath) > 0 {
+		specPath = append(append([]string{}, templatePath...), "spec")
+	}
+	if !affected(changes, object, specPath) {
+		log.Info(fmt.Sprintf("Skipping %s/%s in namespace %s, none of the keys it uses changed", target.Kind, target.Name, namespace))
+		return nil, nil
+	}
+
+	selected, err := selectedPods(ctx, c, namespace, object)
+	if err != nil {
+		return nil, err
+	}
+	var pods []*corev1.Pod
+	for i := range selected {
+		if running(&selected[i]) {
+			pods = append(pods, &selected[i])
+		}
+	}
+	return pods, nil
+}
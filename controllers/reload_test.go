@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	restfake "k8s.io/client-go/rest/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReloadWorkload(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		deployment,
+		pod("web-1", corev1.PodRunning),
+		pod("web-2", corev1.PodRunning),
+		pod("web-3", corev1.PodPending),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+	).Build()
+
+	var calls []string
+	reloader := &PodReloader{client: &restfake.RESTClient{
+		NegotiatedSerializer: clientgoscheme.Codecs.WithoutConversion(),
+		GroupVersion:         corev1.SchemeGroupVersion,
+		VersionedAPIPath:     "/api/v1",
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, req.Method+" "+req.URL.Path)
+			status := http.StatusOK
+			if strings.Contains(req.URL.Path, "web-2") {
+				status = http.StatusInternalServerError
+			}
+			return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}),
+	}}
+	endpoint, err := newReloadEndpoint(8080, "", "", "", "0s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := workloadRef{Kind: "Deployment", Name: "web"}
+	change := &secretChange{secret: "app", keys: []string{"config"}, hash: "1"}
+	ctx := context.Background()
+
+	reloaded, err := reloadWorkload(ctx, c, reloader, logr.Discard(), "default", target, endpoint, change)
+	if !reloaded {
+		t.Errorf("Expected the pods to be reloaded")
+	}
+	if err == nil {
+		t.Errorf("Expected an error for the failed reload")
+	}
+	expected := []string{
+		"POST /api/v1/namespaces/default/pods/http:web-1:8080/proxy/-/reload",
+		"POST /api/v1/namespaces/default/pods/http:web-2:8080/proxy/-/reload",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected calls %v but got %v", expected, calls)
+	}
+
+	annotations := func(name string) map[string]string {
+		p := &corev1.Pod{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, p); err != nil {
+			t.Fatal(err)
+		}
+		return p.Annotations
+	}
+	for name, result := range map[string]string{"web-1": "Succeeded", "web-2": "Failed: "} {
+		got := annotations(name)
+		if got[hashAnnotation("app")] != "1" {
+			t.Errorf("Expected %s to be annotated with the hash", name)
+		}
+		if !strings.HasPrefix(got[reloadResultAnnotation], result) {
+			t.Errorf("Expected %s result %q but got %q", name, result, got[reloadResultAnnotation])
+		}
+	}
+	for _, name := range []string{"web-3", "other"} {
+		if _, ok := annotations(name)[hashAnnotation("app")]; ok {
+			t.Errorf("Expected %s to be left alone", name)
+		}
+	}
+
+	// already annotated with this version
+	calls = nil
+	reloaded, err = reloadWorkload(ctx, c, reloader, logr.Discard(), "default", target, endpoint, change)
+	if reloaded || err != nil || len(calls) > 0 {
+		t.Errorf("Expected nothing to reload but got %v, %v and %d calls", reloaded, err, len(calls))
+	}
+}
+
+func TestRolloutQueueReload(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	q, c := testQueue(t,
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default", Labels: labels}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+	)
+	target := workloadRef{Kind: "Deployment", Name: "web"}
+	q.Enqueue("default", target, &secretChange{secret: "app", keys: []string{"config"}, hash: "1"}, rolloutPolicy{owner: "ValsSecret/default/app", reload: true})
+	q.dispatch(context.Background())
+	idle(t, q)
+
+	if v := annotations(t, c, "web")[hashAnnotation("app")]; v != "" {
+		t.Errorf("Expected the Deployment to be left alone but got hash %s", v)
+	}
+	pod := &corev1.Pod{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "web-1"}, pod); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Annotations[hashAnnotation("app")] != "1" || pod.Annotations[reloadResultAnnotation] != "Succeeded" {
+		t.Errorf("Expected the pod to be reloaded but got %v", pod.Annotations)
+	}
+}
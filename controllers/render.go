@@ -0,0 +1,148 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	sprig "github.com/Masterminds/sprig/v3"
+	"github.com/helmfile/vals"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	"digitalis.io/vals-operator/utils"
+	"digitalis.io/vals-operator/vault"
+)
+
+var k8sRefRegexp = regexp.MustCompile(`ref\+k8s://(?P<namespace>\S+)/(?P<secretName>\S+)#(?P<key>\S+)`)
+
+// parseK8sRef splits a ref+k8s://namespace/secret-name#key reference
+func parseK8sRef(ref string) (namespace, name, key string, err error) {
+	matchMap := utils.FindAllGroups(k8sRefRegexp, ref)
+	if !utils.K8sSecretFound(matchMap) {
+		return "", "", "", fmt.Errorf("the ref+k8s secret '%s' did not match the regular expression for ref+k8s://namespace/secret-name#key", ref)
+	}
+	return matchMap["namespace"], matchMap["secretName"], matchMap["key"], nil
+}
+
+// decodeData converts the values of the ValsSecret to the data of the secret,
+// decoding those with the base64 encoding. Values read from ref+k8s are
+// already decoded. The values are also returned as strings for the templates.
+func decodeData(sDef *secretv1.ValsSecret, values map[string]interface{}) (map[string][]byte, map[string]string, error) {
+	data := make(map[string][]byte)
+	dataStr := make(map[string]string)
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("value of %s is not a string", k)
+		}
+		if sDef.Spec.Data[k].Encoding == "base64" && !strings.HasPrefix(sDef.Spec.Data[k].Ref, k8sSecretPrefix) {
+			sDec, err := b64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot decode %s: %w", k, err)
+			}
+			s = string(sDec)
+		}
+		data[k] = []byte(s)
+		dataStr[k] = s
+	}
+	return data, dataStr, nil
+}
+
+// renderTemplates renders the sprig templates into data. Templates that cannot
+// be parsed or rendered are left out and their errors returned, the others
+// are still rendered.
+func renderTemplates(templates map[string]string, data map[string][]byte, dataStr map[string]string) []error {
+	var errs []error
+	for k, v := range templates {
+		b := bytes.NewBuffer(nil)
+		t, err := template.New(k).Funcs(sprig.FuncMap()).Parse(v)
+		if err == nil {
+			err = t.Execute(b, &dataStr)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		data[k] = b.Bytes()
+	}
+	return errs
+}
+
+// RenderValsSecret builds the secret of a ValsSecret with the same steps as
+// the controller, to check a manifest without applying it. References are
+// evaluated with vals and the credentials of the environment, ref+k8s ones
+// are read with reader. Vault references vals cannot read are rejected as
+// the controller does. Templates that cannot be rendered are left out of the
+// secret and their errors returned with it.
+func RenderValsSecret(ctx context.Context, sDef *secretv1.ValsSecret, reader client.Reader) (*corev1.Secret, []error, error) {
+	secretYaml := make(map[string]interface{})
+	for k, v := range sDef.Spec.Data {
+		if err := vault.CheckValsRef(v.Ref); err != nil {
+			return nil, nil, err
+		}
+		if !strings.HasPrefix(v.Ref, k8sSecretPrefix) {
+			secretYaml[k] = v.Ref
+			continue
+		}
+		namespace, name, key, err := parseK8sRef(v.Ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		var secret corev1.Secret
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &secret); err != nil {
+			return nil, nil, fmt.Errorf("cannot read %s: %w", v.Ref, err)
+		}
+		secretYaml[k] = string(secret.Data[key])
+	}
+
+	values, err := vals.Eval(secretYaml, vals.Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+	data, dataStr, err := decodeData(sDef, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	templateErrs := renderTemplates(sDef.Spec.Template, data, dataStr)
+
+	secret := &corev1.Secret{
+		Data: data,
+		Type: corev1.SecretType(sDef.Spec.Type),
+	}
+	secret.APIVersion, secret.Kind = corev1.SchemeGroupVersion.String(), "Secret"
+	secret.Name = sDef.Name
+	if sDef.Spec.Name != "" {
+		secret.Name = sDef.Spec.Name
+	}
+	secret.Namespace = sDef.Namespace
+	secret.Labels = make(map[string]string)
+	utils.MergeMap(secret.Labels, sDef.Labels)
+	secret.Labels[managedByLabel] = "vals-operator"
+	if len(sDef.Annotations) > 0 {
+		secret.Annotations = make(map[string]string)
+		utils.MergeMap(secret.Annotations, sDef.Annotations)
+		delete(secret.Annotations, corev1.LastAppliedConfigAnnotation)
+	}
+	return secret, templateErrs, nil
+}
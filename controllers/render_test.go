@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+)
+
+func TestRenderValsSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "other"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}).Build()
+
+	sDef := &secretv1.ValsSecret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "default",
+			Labels:      map[string]string{"team": "a"},
+			Annotations: map[string]string{corev1.LastAppliedConfigAnnotation: "{}"},
+		},
+		Spec: secretv1.ValsSecretSpec{
+			Name: "app-secret",
+			Type: "Opaque",
+			Data: map[string]secretv1.DataSource{
+				"user":     {Ref: "admin"},
+				"password": {Ref: "ref+k8s://other/db#password"},
+				"token":    {Ref: "aGVsbG8=", Encoding: "base64"},
+			},
+			Template: map[string]string{
+				"dsn":    "postgres://{{ .user }}:{{ .password }}@db",
+				"broken": "{{ .user | nope }}",
+			},
+		},
+	}
+
+	secret, templateErrs, err := RenderValsSecret(context.Background(), sDef, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templateErrs) != 1 {
+		t.Errorf("Expected the broken template to fail but got %v", templateErrs)
+	}
+	expected := map[string]string{
+		"user":     "admin",
+		"password": "hunter2",
+		"token":    "hello",
+		"dsn":      "postgres://admin:hunter2@db",
+	}
+	if len(secret.Data) != len(expected) {
+		t.Errorf("Expected %d keys but got %d", len(expected), len(secret.Data))
+	}
+	for k, v := range expected {
+		if string(secret.Data[k]) != v {
+			t.Errorf("Expected %s to be %q but got %q", k, v, secret.Data[k])
+		}
+	}
+	if secret.Name != "app-secret" || secret.Namespace != "default" || secret.Type != corev1.SecretTypeOpaque {
+		t.Errorf("Expected Opaque secret default/app-secret but got %s %s/%s", secret.Type, secret.Namespace, secret.Name)
+	}
+	if secret.Labels["team"] != "a" || secret.Labels[managedByLabel] != "vals-operator" {
+		t.Errorf("Expected the labels to be copied but got %v", secret.Labels)
+	}
+	if _, ok := secret.Annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		t.Errorf("Expected the last applied configuration to be dropped")
+	}
+
+	sDef.Spec.Data["password"] = secretv1.DataSource{Ref: "ref+k8s://other/missing#password"}
+	if _, _, err := RenderValsSecret(context.Background(), sDef, c); err == nil {
+		t.Errorf("Expected an error for a missing secret")
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	t.Setenv("VAULT_AUTH_METHOD", "")
+	sDef.Spec.Data["password"] = secretv1.DataSource{Ref: "ref+vault://kv/app?address=http://vault:8200#/password"}
+	if _, _, err := RenderValsSecret(context.Background(), sDef, c); err == nil {
+		t.Errorf("Expected an error for a vault reference without a token")
+	}
+}
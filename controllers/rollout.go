@@ -0,0 +1,265 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;patch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;patch
+//+kubebuilder:rbac:groups=argoproj.io,resources=rollouts,verbs=get;patch
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+
+// workloadRef is a workload restarted when a secret changes
+type workloadRef struct {
+	APIVersion   string
+	Kind         string
+	Name         string
+	TemplatePath string
+}
+
+// dbWorkloads returns the workloads listed in the rollout of a DbSecret or CertSecret
+func dbWorkloads(targets []digitalisiov1beta1.DbRolloutTarget) []workloadRef {
+	var refs []workloadRef
+	for _, t := range targets {
+		refs = append(refs, workloadRef{APIVersion: t.APIVersion, Kind: t.Kind, Name: t.Name, TemplatePath: t.TemplatePath})
+	}
+	return refs
+}
+
+// rolloutKind is a kind that can be restarted without an apiVersion
+type rolloutKind struct {
+	gvk schema.GroupVersionKind
+	// templatePath is the path to the pod template. When empty spec.restartAt
+	// is set instead, as done by kubectl argo rollouts restart
+	templatePath []string
+}
+
+var rolloutKinds = map[string]rolloutKind{
+	"deployment": {
+		gvk:          schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		templatePath: []string{"spec", "template"},
+	},
+	"statefulset": {
+		gvk:          schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		templatePath: []string{"spec", "template"},
+	},
+	"daemonset": {
+		gvk:          schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		templatePath: []string{"spec", "template"},
+	},
+	"cronjob": {
+		gvk:          schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"},
+		templatePath: []string{"spec", "jobTemplate", "spec", "template"},
+	},
+	"rollout": {
+		gvk: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"},
+	},
+}
+
+// permanentError is a restart failing the same way until the resource or the
+// workload is fixed, which is not worth retrying
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanentErrorf(format string, a ...interface{}) error {
+	return &permanentError{err: fmt.Errorf(format, a...)}
+}
+
+// resolve returns the GroupVersionKind of the workload and the path to its
+// pod template
+func (w workloadRef) resolve() (schema.GroupVersionKind, []string, error) {
+	if w.APIVersion == "" {
+		k, ok := rolloutKinds[strings.ToLower(w.Kind)]
+		if !ok {
+			return schema.GroupVersionKind{}, nil, permanentErrorf("%s kind is not supported without an apiVersion", w.Kind)
+		}
+		return k.gvk, k.templatePath, nil
+	}
+
+	gv, err := schema.ParseGroupVersion(w.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, nil, permanentErrorf("invalid apiVersion %q: %w", w.APIVersion, err)
+	}
+	templatePath := parseTemplatePath(w.TemplatePath)
+	if len(templatePath) == 0 {
+		templatePath = []string{"spec", "template"}
+	}
+	return gv.WithKind(w.Kind), templatePath, nil
+}
+
+// parseTemplatePath splits a path such as .spec.template or {.spec.template}
+func parseTemplatePath(p string) []string {
+	p = strings.Trim(strings.TrimSpace(p), "{}.")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, ".")
+}
+
+// restartWorkload is used to restart a workload by recording the hash of the
+// secrets on its pod template, which makes its controller replace the pods. A
+// Pod is evicted instead. Workloads not affected by the changes, or already
+// using these versions of the secrets, are left alone. Returns whether the
+// workload was restarted.
+func restartWorkload(ctx context.Context, c client.Client, log logr.Logger, namespace string, target workloadRef, changes ...*secretChange) (bool, error) {
+	if target.APIVersion == "" && strings.ToLower(target.Kind) == "pod" {
+		return restartPod(ctx, c, log, namespace, target.Name, changes...)
+	}
+	gvk, templatePath, err := target.resolve()
+	if err != nil {
+		return false, err
+	}
+
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+	clientObject := types.NamespacedName{
+		Namespace: namespace,
+		Name:      target.Name,
+	}
+	log.Info(fmt.Sprintf("Rolling restart %s/%s in namespace %s", target.Kind, target.Name, namespace))
+
+	err = c.Get(ctx, clientObject, object)
+	if errors.IsNotFound(err) {
+		log.Error(err, fmt.Sprintf("%s/%s in namespace %s not found", target.Kind, target.Name, namespace))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	specPath := []string{"spec", "template", "spec"}
+	if len(templatePath) > 0 {
+		specPath = append(append([]string{}, templatePath...), "spec")
+	}
+	if !affected(changes, object, specPath) {
+		log.Info(fmt.Sprintf("Skipping %s/%s in namespace %s, none of the keys it uses changed", target.Kind, target.Name, namespace))
+		return false, nil
+	}
+
+	// the hashes are kept on the object itself when restartAt is used
+	annotations := []string{"metadata", "annotations"}
+	if len(templatePath) > 0 {
+		if _, found, _ := unstructured.NestedMap(object.Object, templatePath...); !found {
+			return false, permanentErrorf("%s/%s has no pod template at .%s", target.Kind, target.Name, strings.Join(templatePath, "."))
+		}
+		annotations = append(append([]string{}, templatePath...), annotations...)
+	}
+	values := hashValues(changes, podSpecAt(object, specPath))
+	if len(values) == 0 {
+		values[restartedAnnotation] = time.Now().UTC().Format(timeLayout)
+	}
+	current, _, _ := unstructured.NestedStringMap(object.Object, annotations...)
+	upToDate := true
+	for k, v := range values {
+		if current[k] != v {
+			upToDate = false
+		}
+	}
+	if upToDate {
+		log.Info(fmt.Sprintf("Skipping %s/%s in namespace %s, already using this version of the secret", target.Kind, target.Name, namespace))
+		return false, nil
+	}
+
+	patch := client.MergeFrom(object.DeepCopy())
+	if len(templatePath) == 0 {
+		err = unstructured.SetNestedField(object.Object, time.Now().UTC().Format(time.RFC3339), "spec", "restartAt")
+		if err != nil {
+			return false, err
+		}
+	}
+	for k, v := range values {
+		if err = unstructured.SetNestedField(object.Object, v, append(annotations, k)...); err != nil {
+			return false, err
+		}
+	}
+	if err = c.Patch(ctx, object, patch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// affected reports whether any of the changes affects the workload
+func affected(changes []*secretChange, object *unstructured.Unstructured, specPath []string) bool {
+	if len(changes) == 0 {
+		return true
+	}
+	for _, change := range changes {
+		if change.affects(object, specPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// restartPod evicts a Pod so that its controller creates a new one. The
+// eviction honours the PodDisruptionBudgets of the Pod, and is retried later
+// when one of them blocks it. Pods without a controller would be lost and are
+// left alone.
+func restartPod(ctx context.Context, c client.Client, log logr.Logger, namespace string, name string, changes ...*secretChange) (bool, error) {
+	pod := &unstructured.Unstructured{}
+	pod.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Pod"))
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, pod)
+	if errors.IsNotFound(err) {
+		log.Error(err, fmt.Sprintf("Pod/%s in namespace %s not found", name, namespace))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !affected(changes, pod, []string{"spec"}) {
+		log.Info(fmt.Sprintf("Skipping Pod/%s in namespace %s, none of the keys it uses changed", name, namespace))
+		return false, nil
+	}
+	if metav1.GetControllerOfNoCopy(pod) == nil {
+		return false, permanentErrorf("Pod/%s has no controller to recreate it, delete it to use the new secret", name)
+	}
+	log.Info(fmt.Sprintf("Evicting Pod/%s in namespace %s", name, namespace))
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	err = c.SubResource("eviction").Create(ctx, &corev1.Pod{ObjectMeta: eviction.ObjectMeta}, eviction)
+	if errors.IsTooManyRequests(err) {
+		return false, fmt.Errorf("eviction of Pod/%s blocked by a PodDisruptionBudget: %w", name, err)
+	}
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
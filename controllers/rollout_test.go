@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestRestartWorkload(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	custom := func(apiVersion, kind string, spec map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetName("app")
+		u.SetNamespace("default")
+		return u
+	}
+	template := map[string]interface{}{"metadata": map[string]interface{}{}}
+	controller := true
+
+	tests := []struct {
+		name      string
+		target    workloadRef
+		expected  []string
+		expectErr bool
+	}{
+		{name: "Deployment", target: workloadRef{Kind: "Deployment", Name: "app"}, expected: []string{"spec", "template"}},
+		{name: "StatefulSet", target: workloadRef{Kind: "statefulset", Name: "app"}, expected: []string{"spec", "template"}},
+		{name: "DaemonSet", target: workloadRef{Kind: "DaemonSet", Name: "app"}, expected: []string{"spec", "template"}},
+		{name: "CronJob", target: workloadRef{Kind: "CronJob", Name: "app"}, expected: []string{"spec", "jobTemplate", "spec", "template"}},
+		{name: "Argo Rollout", target: workloadRef{Kind: "Rollout", Name: "app"}, expected: []string{"spec", "restartAt"}},
+		{name: "Custom resource", target: workloadRef{APIVersion: "example.com/v1", Kind: "Widget", Name: "app", TemplatePath: "{.spec.pods.template}"}, expected: []string{"spec", "pods", "template"}},
+		{name: "Custom resource with the default path", target: workloadRef{APIVersion: "example.com/v1", Kind: "Gadget", Name: "app"}, expected: []string{"spec", "template"}},
+		{name: "Custom resource without a pod template", target: workloadRef{APIVersion: "example.com/v1", Kind: "Widget", Name: "app"}, expectErr: true},
+		{name: "Unknown kind", target: workloadRef{Kind: "Service", Name: "app"}, expectErr: true},
+		{name: "Pod with a controller", target: workloadRef{Kind: "Pod", Name: "app"}},
+		{name: "Standalone Pod", target: workloadRef{Kind: "Pod", Name: "standalone"}, expectErr: true},
+		{name: "Missing workload", target: workloadRef{Kind: "Deployment", Name: "missing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&appsv1.Deployment{ObjectMeta: meta("app")},
+				&appsv1.StatefulSet{ObjectMeta: meta("app")},
+				&appsv1.DaemonSet{ObjectMeta: meta("app")},
+				&batchv1.CronJob{ObjectMeta: meta("app")},
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "example.com/v1", Kind: "Widget", Name: "app", UID: "1", Controller: &controller},
+				}}},
+				&corev1.Pod{ObjectMeta: meta("standalone")},
+				custom("argoproj.io/v1alpha1", "Rollout", map[string]interface{}{}),
+				custom("example.com/v1", "Widget", map[string]interface{}{"pods": map[string]interface{}{"template": template}}),
+				custom("example.com/v1", "Gadget", map[string]interface{}{"template": template}),
+			).Build()
+
+			ctx := context.Background()
+			_, err := restartWorkload(ctx, c, logr.Discard(), "default", tt.target)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.target.Kind == "Pod" {
+				pod := &corev1.Pod{}
+				if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: tt.target.Name}, pod); !apierrors.IsNotFound(err) {
+					t.Errorf("Expected the Pod to be evicted but got %v", err)
+				}
+				return
+			}
+			if tt.expected == nil {
+				return
+			}
+
+			gvk, _, _ := tt.target.resolve()
+			object := &unstructured.Unstructured{}
+			object.SetGroupVersionKind(gvk)
+			if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: tt.target.Name}, object); err != nil {
+				t.Fatal(err)
+			}
+			path := tt.expected
+			if path[len(path)-1] != "restartAt" {
+				path = append(path, "metadata", "annotations", restartedAnnotation)
+			}
+			if v, _, _ := unstructured.NestedString(object.Object, path...); v == "" {
+				t.Errorf("Expected %v to be set", path)
+			}
+		})
+	}
+}
+
+func TestRestartPodEviction(t *testing.T) {
+	controller := true
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", OwnerReferences: []metav1.OwnerReference{
+		{APIVersion: "example.com/v1", Kind: "Widget", Name: "app", UID: "1", Controller: &controller},
+	}}}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	blocked := true
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).WithInterceptorFuncs(interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+			if subResourceName != "eviction" {
+				t.Errorf("Expected an eviction but got %s", subResourceName)
+			}
+			if blocked {
+				return apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+			}
+			return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+		},
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if blocked {
+				t.Errorf("Expected the Pod not to be deleted")
+			}
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "app"}
+	if restarted, err := restartPod(ctx, c, logr.Discard(), "default", "app"); err == nil || restarted {
+		t.Errorf("Expected the eviction to be blocked but got %v", err)
+	}
+	if err := c.Get(ctx, key, &corev1.Pod{}); err != nil {
+		t.Errorf("Expected the Pod to be kept but got %v", err)
+	}
+
+	blocked = false
+	if restarted, err := restartPod(ctx, c, logr.Discard(), "default", "app"); err != nil || !restarted {
+		t.Errorf("Expected the Pod to be evicted but got %v", err)
+	}
+	if err := c.Get(ctx, key, &corev1.Pod{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected the Pod to be evicted but got %v", err)
+	}
+}
+
+func TestRestartWorkloadHash(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+	).Build()
+
+	ctx := context.Background()
+	target := workloadRef{Kind: "Deployment", Name: "app"}
+	get := func() *appsv1.Deployment {
+		d := &appsv1.Deployment{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "app"}, d); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		patched bool
+	}{
+		{name: "First version", data: map[string]string{"password": "one"}, patched: true},
+		{name: "Same version", data: map[string]string{"password": "one"}},
+		{name: "New version", data: map[string]string{"password": "two"}, patched: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make(map[string][]byte)
+			for k, v := range tt.data {
+				data[k] = []byte(v)
+			}
+			change := &secretChange{secret: "app", keys: []string{"password"}, hash: dataHash(data)}
+			before := get().ResourceVersion
+			if _, err := restartWorkload(ctx, c, logr.Discard(), "default", target, change); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			d := get()
+			if patched := d.ResourceVersion != before; patched != tt.patched {
+				t.Errorf("Expected patched=%v but got %v", tt.patched, patched)
+			}
+			if v := d.Spec.Template.Annotations[hashAnnotation("app")]; v != change.hash {
+				t.Errorf("Expected hash %s but got %s", change.hash, v)
+			}
+			if _, ok := d.Spec.Template.Annotations[restartedAnnotation]; ok {
+				t.Errorf("Expected no %s annotation", restartedAnnotation)
+			}
+		})
+	}
+}
@@ -0,0 +1,564 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/maintenance"
+)
+
+const (
+	defaultAvailableTimeout = 10 * time.Minute
+	defaultPollInterval     = 5 * time.Second
+	// failed restarts are retried after a backoff doubling up to maxRetryBackoff
+	defaultRetryBackoff = 5 * time.Second
+	maxRetryBackoff     = 5 * time.Minute
+	// maxRetries is how many times a failed restart is retried before it is
+	// dropped
+	maxRetries = 10
+)
+
+// rolloutPolicy is how the restarts made for one resource are staggered
+type rolloutPolicy struct {
+	// owner is the resource the restarts are made for
+	owner            string
+	maxConcurrent    int
+	waitForAvailable bool
+	minInterval      time.Duration
+	// reload annotates the running pods instead of restarting the workloads,
+	// calling endpoint on each of them when set
+	reload   bool
+	endpoint *reloadEndpoint
+	// windows hold the restarts until one of them opens
+	windows maintenance.Windows
+}
+
+// newRolloutPolicy returns the policy of a resource from its rolloutPolicy
+func newRolloutPolicy(owner string, maxConcurrent int, waitForAvailable bool, minInterval string) (rolloutPolicy, error) {
+	p := rolloutPolicy{owner: owner, maxConcurrent: maxConcurrent, waitForAvailable: waitForAvailable}
+	if minInterval != "" {
+		d, err := time.ParseDuration(minInterval)
+		if err != nil {
+			return p, fmt.Errorf("invalid rolloutPolicy.minInterval %q: %w", minInterval, err)
+		}
+		p.minInterval = d
+	}
+	return p, nil
+}
+
+// rolloutTask is a workload waiting to be restarted
+type rolloutTask struct {
+	key       string
+	namespace string
+	target    workloadRef
+	// changes of every secret the restart is for
+	changes []*secretChange
+	policy  rolloutPolicy
+	// owners of every change merged into the restart
+	owners map[string]bool
+	// failures is how many times the restart failed and notBefore when it
+	// may be retried
+	failures  int
+	notBefore time.Time
+}
+
+// merge adds the change of another secret, or replaces an older change of
+// the same one, so that a burst of changes restarts the workload once
+func (t *rolloutTask) merge(change *secretChange, policy rolloutPolicy) {
+	if !t.owners[policy.owner] {
+		// the restart waits for a window of any resource holding its changes
+		t.policy.windows = append(t.policy.windows, policy.windows...)
+	}
+	t.owners[policy.owner] = true
+	replaced := false
+	for i, c := range t.changes {
+		if c != nil && change != nil && c.secret == change.secret {
+			// keys changed earlier still have to be taken into account
+			t.changes[i] = &secretChange{secret: change.secret, keys: mergeKeys(c.keys, change.keys), hash: change.hash, hashes: change.hashes}
+			replaced = true
+		}
+	}
+	if !replaced {
+		t.changes = append(t.changes, change)
+	}
+	t.policy.waitForAvailable = t.policy.waitForAvailable || policy.waitForAvailable
+	if policy.minInterval > t.policy.minInterval {
+		t.policy.minInterval = policy.minInterval
+	}
+	// a restart also picks up the secrets of those only asking for a reload
+	t.policy.reload = t.policy.reload && policy.reload
+	if t.policy.endpoint == nil {
+		t.policy.endpoint = policy.endpoint
+	}
+}
+
+// hasChange reports whether the restart already carries a change of the
+// secret of change
+func (t *rolloutTask) hasChange(change *secretChange) bool {
+	for _, c := range t.changes {
+		if c == change || (c != nil && change != nil && c.secret == change.secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeKeys(a, b []string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, k := range append(append([]string{}, a...), b...) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// RolloutQueue restarts workloads in the background, limiting how many are
+// restarting at the same time and how often the same workload is restarted.
+// Restarts queued for a workload before it starts are merged, also across
+// secrets. The queue is kept in memory and only runs on the leader, so the
+// restarts lost with it are queued again by the recoveries when it starts.
+// Failed restarts are queued again with a backoff, up to maxRetries times,
+// unless retrying cannot help.
+type RolloutQueue struct {
+	client.Client
+	Log logr.Logger
+	// MaxConcurrent is how many workloads may be restarting at the same time
+	// across all secrets, unlimited when 0
+	MaxConcurrent int
+	// WaitForAvailable and MinInterval apply to every resource on top of its
+	// own rolloutPolicy
+	WaitForAvailable bool
+	MinInterval      time.Duration
+	// AvailableTimeout is how long a restart waits for the workload to become
+	// Available before moving on
+	AvailableTimeout time.Duration
+	// Reloader calls the reload endpoint of the pods when set
+	Reloader *PodReloader
+	// Recorder reports the restarts given up on the resources they are made
+	// for when set
+	Recorder record.EventRecorder
+
+	mu      sync.Mutex
+	pending []*rolloutTask
+	// running restarts by workload and by owner
+	running map[string]bool
+	owners  map[string]int
+	// busy counts the running restarts of every owner merged into them
+	busy map[string]int
+	last map[string]time.Time
+	wake chan struct{}
+	// pollInterval is how often availability is checked and retryBackoff the
+	// first delay before a failed restart is retried, shortened in tests
+	pollInterval time.Duration
+	retryBackoff time.Duration
+	// recoveries queue again the restarts lost when the operator stopped
+	recoveries []func(ctx context.Context)
+}
+
+// NewRolloutQueue returns an empty queue
+func NewRolloutQueue(c client.Client, log logr.Logger) *RolloutQueue {
+	return &RolloutQueue{
+		Client:           c,
+		Log:              log,
+		AvailableTimeout: defaultAvailableTimeout,
+		running:          make(map[string]bool),
+		owners:           make(map[string]int),
+		busy:             make(map[string]int),
+		last:             make(map[string]time.Time),
+		wake:             make(chan struct{}, 1),
+		pollInterval:     defaultPollInterval,
+		retryBackoff:     defaultRetryBackoff,
+	}
+}
+
+// NeedLeaderElection makes the manager only start the queue on the leader
+func (q *RolloutQueue) NeedLeaderElection() bool {
+	return true
+}
+
+// AddRecovery registers a function queueing again the restarts lost when the
+// operator stopped or the leader changed. It is called when the queue starts.
+func (q *RolloutQueue) AddRecovery(f func(ctx context.Context)) {
+	q.recoveries = append(q.recoveries, f)
+}
+
+// Start restarts the queued workloads until the context is cancelled
+func (q *RolloutQueue) Start(ctx context.Context) error {
+	for _, f := range q.recoveries {
+		f(ctx)
+	}
+	for {
+		next := q.dispatch(ctx)
+		var timer *time.Timer
+		var fired <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-q.wake:
+		case <-fired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Enqueue queues the restart of a workload
+func (q *RolloutQueue) Enqueue(namespace string, target workloadRef, change *secretChange, policy rolloutPolicy) {
+	key := strings.ToLower(namespace + "/" + target.APIVersion + "/" + target.Kind + "/" + target.Name)
+	policy.waitForAvailable = policy.waitForAvailable || q.WaitForAvailable
+	if policy.minInterval == 0 {
+		policy.minInterval = q.MinInterval
+	}
+	// waiting only staggers the restarts when they are limited
+	if policy.waitForAvailable && policy.maxConcurrent == 0 {
+		policy.maxConcurrent = 1
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.pending {
+		if t.key == key {
+			t.merge(change, policy)
+			q.notify()
+			return
+		}
+	}
+	q.pending = append(q.pending, &rolloutTask{
+		key:       key,
+		namespace: namespace,
+		target:    target,
+		changes:   []*secretChange{change},
+		policy:    policy,
+		owners:    map[string]bool{policy.owner: true},
+	})
+	q.notify()
+}
+
+// Pending returns how many restarts are waiting to start
+func (q *RolloutQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Busy reports whether restarts made for the owner are waiting or running
+func (q *RolloutQueue) Busy(owner string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.busy[owner] > 0 {
+		return true
+	}
+	for _, t := range q.pending {
+		if t.owners[owner] {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *RolloutQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch starts the queued restarts allowed by the limits and returns when
+// the next one held by its minimum interval, its backoff or a maintenance
+// window may start
+func (q *RolloutQueue) dispatch(ctx context.Context) time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	var waiting []*rolloutTask
+	for _, t := range q.pending {
+		switch {
+		case q.MaxConcurrent > 0 && len(q.running) >= q.MaxConcurrent,
+			q.running[t.key],
+			t.policy.maxConcurrent > 0 && q.owners[t.policy.owner] >= t.policy.maxConcurrent:
+			waiting = append(waiting, t)
+			continue
+		}
+		at := t.notBefore
+		if last, ok := q.last[t.key]; ok && last.Add(t.policy.minInterval).After(at) {
+			at = last.Add(t.policy.minInterval)
+		}
+		// a schedule that never matches must not hold the restart forever
+		if open, ok := t.policy.windows.NextOpen(now); ok && open.After(at) {
+			at = open
+		}
+		if now.Before(at) {
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+			waiting = append(waiting, t)
+			continue
+		}
+
+		q.running[t.key] = true
+		q.owners[t.policy.owner]++
+		for owner := range t.owners {
+			q.busy[owner]++
+		}
+		go q.run(ctx, t)
+	}
+	q.pending = waiting
+	return next
+}
+
+// run restarts or reloads the workload and waits for it to become Available
+// when asked
+func (q *RolloutQueue) run(ctx context.Context, t *rolloutTask) {
+	var restarted bool
+	var err error
+	if t.policy.reload {
+		restarted, err = reloadWorkload(ctx, q.Client, q.Reloader, q.Log, t.namespace, t.target, t.policy.endpoint, t.changes...)
+	} else {
+		restarted, err = restartWorkload(ctx, q.Client, q.Log, t.namespace, t.target, t.changes...)
+	}
+	if err != nil {
+		q.Log.Error(err, "Could not perform rollout",
+			"namespace", t.namespace,
+			"kind", t.target.Kind,
+			"name", t.target.Name)
+	}
+	// reloaded pods are not replaced so there is nothing to wait for
+	if restarted && t.policy.waitForAvailable && !t.policy.reload {
+		if err := q.waitAvailable(ctx, t); err != nil {
+			q.Log.Error(err, "Workload did not become available",
+				"namespace", t.namespace,
+				"kind", t.target.Kind,
+				"name", t.target.Name)
+		}
+	}
+
+	q.mu.Lock()
+	if restarted {
+		q.last[t.key] = time.Now()
+	}
+	if err != nil && ctx.Err() == nil {
+		if isPermanent(err) || t.failures >= maxRetries {
+			q.drop(ctx, t, err)
+		} else {
+			q.retry(t)
+		}
+	}
+	delete(q.running, t.key)
+	q.owners[t.policy.owner]--
+	if q.owners[t.policy.owner] <= 0 {
+		delete(q.owners, t.policy.owner)
+	}
+	for owner := range t.owners {
+		if q.busy[owner]--; q.busy[owner] <= 0 {
+			delete(q.busy, owner)
+		}
+	}
+	q.notify()
+	q.mu.Unlock()
+}
+
+// retry queues a failed restart again after a backoff, merging it into a
+// restart queued for the workload in the meantime. It is called with the lock
+// held.
+func (q *RolloutQueue) retry(t *rolloutTask) {
+	t.failures++
+	backoff := q.retryBackoff
+	for i := 1; i < t.failures && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	t.notBefore = time.Now().Add(backoff)
+	q.Log.Info("Retrying rollout",
+		"namespace", t.namespace,
+		"kind", t.target.Kind,
+		"name", t.target.Name,
+		"after", backoff.String())
+
+	for _, p := range q.pending {
+		if p.key != t.key {
+			continue
+		}
+		// the queued restart carries newer changes of the secrets it shares
+		for _, c := range t.changes {
+			if !p.hasChange(c) {
+				p.merge(c, t.policy)
+			}
+		}
+		for owner := range t.owners {
+			p.owners[owner] = true
+		}
+		p.failures = t.failures
+		return
+	}
+	q.pending = append(q.pending, t)
+}
+
+// drop gives up on a failed restart, reporting it on the resources it was made
+// for. It is called with the lock held.
+func (q *RolloutQueue) drop(ctx context.Context, t *rolloutTask, err error) {
+	q.Log.Info("Giving up on rollout",
+		"namespace", t.namespace,
+		"kind", t.target.Kind,
+		"name", t.target.Name,
+		"failures", t.failures+1)
+	if q.Recorder == nil {
+		return
+	}
+	message := fmt.Sprintf("Could not restart %s/%s: %v", t.target.Kind, t.target.Name, err)
+	for owner := range t.owners {
+		obj := ownerObject(owner)
+		if obj == nil || q.Get(ctx, client.ObjectKeyFromObject(obj), obj) != nil {
+			continue
+		}
+		q.Recorder.Event(obj, corev1.EventTypeWarning, "RolloutFailed", message)
+	}
+}
+
+// ownerObject returns the resource named by the owner of a restart, as
+// Kind/namespace/name
+func ownerObject(owner string) client.Object {
+	parts := strings.SplitN(owner, "/", 3)
+	if len(parts) != 3 {
+		return nil
+	}
+	meta := metav1.ObjectMeta{Namespace: parts[1], Name: parts[2]}
+	switch parts[0] {
+	case "ValsSecret":
+		return &secretv1.ValsSecret{ObjectMeta: meta}
+	case "DbSecret":
+		return &digitalisiov1beta1.DbSecret{ObjectMeta: meta}
+	case "CertSecret":
+		return &digitalisiov1beta1.CertSecret{ObjectMeta: meta}
+	}
+	return nil
+}
+
+// isPermanent reports whether retrying the restart cannot help
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// waitAvailable polls the workload until it is Available or the timeout
+// expires. Pods and CronJobs are not waited for.
+func (q *RolloutQueue) waitAvailable(ctx context.Context, t *rolloutTask) error {
+	switch strings.ToLower(t.target.Kind) {
+	case "pod", "cronjob":
+		if t.target.APIVersion == "" {
+			return nil
+		}
+	}
+	gvk, _, err := t.target.resolve()
+	if err != nil {
+		return err
+	}
+	timeout := q.AvailableTimeout
+	if timeout <= 0 {
+		timeout = defaultAvailableTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		object := &unstructured.Unstructured{}
+		object.SetGroupVersionKind(gvk)
+		err := q.Get(ctx, types.NamespacedName{Namespace: t.namespace, Name: t.target.Name}, object)
+		if err != nil {
+			return err
+		}
+		if workloadAvailable(object) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s/%s not available after %s", t.target.Kind, t.target.Name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// workloadAvailable reports whether the controller of the workload has rolled
+// out its latest spec and its pods are available, as kubectl rollout status
+// does. Other kinds use their Available condition when they have one.
+func workloadAvailable(object *unstructured.Unstructured) bool {
+	if observed, found, _ := unstructured.NestedInt64(object.Object, "status", "observedGeneration"); found && observed < object.GetGeneration() {
+		return false
+	}
+	status := func(field string) int64 {
+		v, _, _ := unstructured.NestedInt64(object.Object, "status", field)
+		return v
+	}
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+
+	switch object.GroupVersionKind().GroupKind().String() {
+	case "Deployment.apps":
+		return status("updatedReplicas") >= replicas &&
+			status("replicas") <= status("updatedReplicas") &&
+			status("availableReplicas") >= status("updatedReplicas")
+	case "StatefulSet.apps":
+		current, _, _ := unstructured.NestedString(object.Object, "status", "currentRevision")
+		update, _, _ := unstructured.NestedString(object.Object, "status", "updateRevision")
+		return status("readyReplicas") >= replicas && status("updatedReplicas") >= replicas && current == update
+	case "DaemonSet.apps":
+		desired := status("desiredNumberScheduled")
+		return status("updatedNumberScheduled") >= desired && status("numberAvailable") >= desired
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Available" {
+			return condition["status"] == "True"
+		}
+	}
+	return true
+}
@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	"digitalis.io/vals-operator/maintenance"
+)
+
+func testQueue(t *testing.T, objects ...client.Object) (*RolloutQueue, client.Client) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+	q := NewRolloutQueue(c, logr.Discard())
+	q.AvailableTimeout = 200 * time.Millisecond
+	q.pollInterval = 10 * time.Millisecond
+	return q, c
+}
+
+// idle waits for the running restarts to finish
+func idle(t *testing.T, q *RolloutQueue) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		q.mu.Lock()
+		running := len(q.running)
+		q.mu.Unlock()
+		if running == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Restarts did not finish")
+}
+
+func annotations(t *testing.T, c client.Client, name string) map[string]string {
+	d := &appsv1.Deployment{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, d); err != nil {
+		t.Fatal(err)
+	}
+	return d.Spec.Template.Annotations
+}
+
+func TestRolloutQueueMerge(t *testing.T) {
+	q, c := testQueue(t, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}})
+	target := workloadRef{Kind: "Deployment", Name: "app"}
+	policy := rolloutPolicy{owner: "ValsSecret/default/app"}
+
+	q.Enqueue("default", target, &secretChange{secret: "db", keys: []string{"password"}, hash: "1"}, policy)
+	q.Enqueue("default", target, &secretChange{secret: "api", keys: []string{"token"}, hash: "2"}, rolloutPolicy{owner: "ValsSecret/default/api"})
+	q.Enqueue("default", target, &secretChange{secret: "db", keys: []string{"username"}, hash: "3"}, policy)
+	if n := q.Pending(); n != 1 {
+		t.Fatalf("Expected 1 pending restart but got %d", n)
+	}
+
+	q.dispatch(context.Background())
+	idle(t, q)
+	got := annotations(t, c, "app")
+	for secret, hash := range map[string]string{"db": "3", "api": "2"} {
+		if v := got[hashAnnotation(secret)]; v != hash {
+			t.Errorf("Expected hash %s for %s but got %q", hash, secret, v)
+		}
+	}
+}
+
+func TestRolloutQueueLimits(t *testing.T) {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "default"}
+	}
+	available := appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		policy        rolloutPolicy
+		// pending restarts after the first dispatch
+		expected int
+	}{
+		{name: "Unlimited", expected: 0},
+		{name: "Operator limit", maxConcurrent: 1, expected: 2},
+		{name: "Resource limit", policy: rolloutPolicy{maxConcurrent: 2}, expected: 1},
+		{name: "Wait for available", policy: rolloutPolicy{waitForAvailable: true}, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, c := testQueue(t,
+				// never becomes available
+				&appsv1.Deployment{ObjectMeta: meta("a")},
+				&appsv1.Deployment{ObjectMeta: meta("b"), Status: available},
+				&appsv1.Deployment{ObjectMeta: meta("c"), Status: available},
+			)
+			q.MaxConcurrent = tt.maxConcurrent
+			policy := tt.policy
+			policy.owner = "ValsSecret/default/app"
+			for _, name := range []string{"a", "b", "c"} {
+				q.Enqueue("default", workloadRef{Kind: "Deployment", Name: name}, &secretChange{secret: "app", keys: []string{"password"}, hash: "1"}, policy)
+			}
+
+			ctx := context.Background()
+			q.dispatch(ctx)
+			if n := q.Pending(); n != tt.expected {
+				t.Errorf("Expected %d pending restarts but got %d", tt.expected, n)
+			}
+			for q.Pending() > 0 {
+				idle(t, q)
+				q.dispatch(ctx)
+			}
+			idle(t, q)
+			for _, name := range []string{"a", "b", "c"} {
+				if annotations(t, c, name)[hashAnnotation("app")] != "1" {
+					t.Errorf("Expected Deployment/%s to be restarted", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRolloutQueueMinInterval(t *testing.T) {
+	q, c := testQueue(t, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}})
+	target := workloadRef{Kind: "Deployment", Name: "app"}
+	policy := rolloutPolicy{owner: "ValsSecret/default/app", minInterval: time.Hour}
+	ctx := context.Background()
+
+	q.Enqueue("default", target, &secretChange{secret: "app", keys: []string{"password"}, hash: "1"}, policy)
+	q.dispatch(ctx)
+	idle(t, q)
+
+	q.Enqueue("default", target, &secretChange{secret: "app", keys: []string{"password"}, hash: "2"}, policy)
+	next := q.dispatch(ctx)
+	if n := q.Pending(); n != 1 {
+		t.Errorf("Expected the restart to wait but got %d pending", n)
+	}
+	if until := time.Until(next); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("Expected the next restart in an hour but got %s", until)
+	}
+	if v := annotations(t, c, "app")[hashAnnotation("app")]; v != "1" {
+		t.Errorf("Expected hash 1 but got %s", v)
+	}
+}
+
+func TestRolloutQueueMaintenanceWindow(t *testing.T) {
+	q, c := testQueue(t, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}})
+	target := workloadRef{Kind: "Deployment", Name: "app"}
+	opens := time.Now().UTC().Truncate(time.Hour).Add(2 * time.Hour)
+	closed, err := maintenance.NewWindow(fmt.Sprintf("0 %d * * *", opens.Hour()), "30m", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := rolloutPolicy{owner: "ValsSecret/default/app", windows: maintenance.Windows{closed}}
+	ctx := context.Background()
+
+	// queued, retried and recovered restarts all wait for the window
+	q.Enqueue("default", target, &secretChange{secret: "app", keys: []string{"password"}, hash: "1"}, policy)
+	next := q.dispatch(ctx)
+	if n := q.Pending(); n != 1 {
+		t.Errorf("Expected the restart to wait for the window but got %d pending", n)
+	}
+	if !next.Equal(opens) {
+		t.Errorf("Expected the next restart at %s but got %s", opens, next)
+	}
+	if v := annotations(t, c, "app")[hashAnnotation("app")]; v != "" {
+		t.Errorf("Expected no restart but got hash %s", v)
+	}
+
+	// a resource without windows merged into the restart waits as well
+	q.Enqueue("default", target, &secretChange{secret: "api", keys: []string{"token"}, hash: "2"}, rolloutPolicy{owner: "ValsSecret/default/api"})
+	if next := q.dispatch(ctx); !next.Equal(opens) {
+		t.Errorf("Expected the merged restart at %s but got %s", opens, next)
+	}
+
+	open, err := maintenance.NewWindow("* * * * *", "1h", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Enqueue("default", workloadRef{Kind: "Deployment", Name: "app"}, &secretChange{secret: "db", keys: []string{"password"}, hash: "3"}, rolloutPolicy{owner: "ValsSecret/default/db", windows: maintenance.Windows{open}})
+	q.dispatch(ctx)
+	idle(t, q)
+	if v := annotations(t, c, "app")[hashAnnotation("app")]; v != "1" {
+		t.Errorf("Expected the restart once a window is open but got hash %q", v)
+	}
+}
+
+func TestRolloutQueueRetry(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	failures := 2
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if failures > 0 {
+					failures--
+					return errors.New("conflict")
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	q := NewRolloutQueue(c, logr.Discard())
+	q.retryBackoff = 50 * time.Millisecond
+	target := workloadRef{Kind: "Deployment", Name: "app"}
+	policy := rolloutPolicy{owner: "ValsSecret/default/app"}
+	ctx := context.Background()
+
+	q.Enqueue("default", target, &secretChange{secret: "app", keys: []string{"password"}, hash: "1"}, policy)
+	q.dispatch(ctx)
+	idle(t, q)
+	if n := q.Pending(); n != 1 {
+		t.Fatalf("Expected the failed restart to be queued again but got %d pending", n)
+	}
+	if !q.Busy(policy.owner) {
+		t.Errorf("Expected the owner to be busy while the restart is retried")
+	}
+
+	// the retry waits for its backoff, doubled after the second failure
+	next := q.dispatch(ctx)
+	if until := time.Until(next); until <= 0 || until > 50*time.Millisecond {
+		t.Errorf("Expected the retry within 50ms but got %s", until)
+	}
+	time.Sleep(time.Until(next))
+	q.dispatch(ctx)
+	idle(t, q)
+	next = q.dispatch(ctx)
+	if until := time.Until(next); until <= 50*time.Millisecond || until > 100*time.Millisecond {
+		t.Errorf("Expected the second retry within 100ms but got %s", until)
+	}
+
+	// a change queued meanwhile is merged into the retry
+	q.Enqueue("default", target, &secretChange{secret: "api", keys: []string{"token"}, hash: "2"}, rolloutPolicy{owner: "ValsSecret/default/api"})
+	if n := q.Pending(); n != 1 {
+		t.Errorf("Expected 1 pending restart but got %d", n)
+	}
+	time.Sleep(time.Until(next))
+	q.dispatch(ctx)
+	idle(t, q)
+	if n := q.Pending(); n != 0 {
+		t.Errorf("Expected no pending restart but got %d", n)
+	}
+	got := annotations(t, c, "app")
+	for secret, hash := range map[string]string{"app": "1", "api": "2"} {
+		if v := got[hashAnnotation(secret)]; v != hash {
+			t.Errorf("Expected hash %s for %s but got %q", hash, secret, v)
+		}
+	}
+}
+
+func TestRolloutQueueGiveUp(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = secretv1.AddToScheme(scheme)
+	failing := errors.New("conflict")
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+			&secretv1.ValsSecret{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}},
+		).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				return failing
+			},
+		}).Build()
+	recorder := record.NewFakeRecorder(10)
+	q := NewRolloutQueue(c, logr.Discard())
+	q.Recorder = recorder
+	policy := rolloutPolicy{owner: "ValsSecret/default/app"}
+	ctx := context.Background()
+
+	// an unsupported kind cannot be restarted however often it is retried
+	q.Enqueue("default", workloadRef{Kind: "Service", Name: "app"}, &secretChange{secret: "app", hash: "1"}, policy)
+	q.dispatch(ctx)
+	idle(t, q)
+	if q.Busy(policy.owner) {
+		t.Errorf("Expected the restart to be dropped")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning RolloutFailed") {
+			t.Errorf("Expected a RolloutFailed warning but got %s", event)
+		}
+	default:
+		t.Errorf("Expected an event")
+	}
+
+	// transient failures are retried up to maxRetries times
+	q.Enqueue("default", workloadRef{Kind: "Deployment", Name: "app"}, &secretChange{secret: "app", hash: "1"}, policy)
+	q.mu.Lock()
+	q.pending[0].failures = maxRetries - 1
+	q.mu.Unlock()
+	q.dispatch(ctx)
+	idle(t, q)
+	if n := q.Pending(); n != 1 {
+		t.Fatalf("Expected the restart to be retried but got %d pending", n)
+	}
+	q.mu.Lock()
+	q.pending[0].notBefore = time.Time{}
+	q.mu.Unlock()
+	q.dispatch(ctx)
+	idle(t, q)
+	if n := q.Pending(); n != 0 {
+		t.Errorf("Expected the restart to be dropped but got %d pending", n)
+	}
+	if n := len(recorder.Events); n != 1 {
+		t.Errorf("Expected 1 event but got %d", n)
+	}
+}
+
+func TestRolloutQueueRecover(t *testing.T) {
+	data := map[string][]byte{"password": []byte("s3cr3t")}
+	changedAt := time.Now().Add(-time.Hour).UTC()
+	pod := func(deployment string, created time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: deployment + "-1", Namespace: "default", Labels: map[string]string{"app": deployment}, CreationTimestamp: metav1.NewTime(created)},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	deployment := func(name, hash string) *appsv1.Deployment {
+		d := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:    "app",
+						EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}}},
+					}}},
+				},
+			},
+		}
+		if hash != "" {
+			d.Spec.Template.Annotations = map[string]string{hashAnnotation("db"): hash}
+		}
+		return d
+	}
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = secretv1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&secretv1.ValsSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       secretv1.ValsSecretSpec{RolloutMode: rolloutModeAuto},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Annotations: map[string]string{dataChangedAnnotation: changedAt.Format(timeLayout)}},
+			Data:       data,
+		},
+		deployment("stale", "old"),
+		deployment("current", dataHash(data)),
+		deployment("never", ""), pod("never", changedAt.Add(time.Minute)),
+		deployment("failed", ""), pod("failed", changedAt.Add(-time.Minute)),
+	).Build()
+	q := NewRolloutQueue(c, logr.Discard())
+	r := &ValsSecretReconciler{Client: c, APIReader: c, Log: logr.Discard(), Rollouts: q}
+	q.AddRecovery(r.recoverRollouts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = q.Start(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for annotations(t, c, "stale")[hashAnnotation("db")] != dataHash(data) || annotations(t, c, "failed")[hashAnnotation("db")] != dataHash(data) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the lost restart to be queued again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	idle(t, q)
+	if got := annotations(t, c, "never"); len(got) != 0 {
+		t.Errorf("Expected a workload started after the change to be left alone but got %v", got)
+	}
+	if n := q.Pending(); n != 0 {
+		t.Errorf("Expected no pending restart but got %d", n)
+	}
+}
+
+func TestWorkloadAvailable(t *testing.T) {
+	object := func(apiVersion, kind string, generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec, "status": status}}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetGeneration(generation)
+		return u
+	}
+	condition := func(status string) map[string]interface{} {
+		return map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Available", "status": status}}}
+	}
+
+	tests := []struct {
+		name     string
+		object   *unstructured.Unstructured
+		expected bool
+	}{
+		{name: "Deployment rolled out", expected: true, object: object("apps/v1", "Deployment", 2, map[string]interface{}{"replicas": int64(2)},
+			map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)})},
+		{name: "Deployment not observed", object: object("apps/v1", "Deployment", 3, map[string]interface{}{"replicas": int64(2)},
+			map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)})},
+		{name: "Deployment with old replicas", object: object("apps/v1", "Deployment", 2, map[string]interface{}{"replicas": int64(2)},
+			map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(2), "availableReplicas": int64(2)})},
+		{name: "StatefulSet updating", object: object("apps/v1", "StatefulSet", 1, map[string]interface{}{"replicas": int64(1)},
+			map[string]interface{}{"readyReplicas": int64(1), "updatedReplicas": int64(1), "currentRevision": "a", "updateRevision": "b"})},
+		{name: "StatefulSet rolled out", expected: true, object: object("apps/v1", "StatefulSet", 1, map[string]interface{}{"replicas": int64(1)},
+			map[string]interface{}{"readyReplicas": int64(1), "updatedReplicas": int64(1), "currentRevision": "b", "updateRevision": "b"})},
+		{name: "DaemonSet updating", object: object("apps/v1", "DaemonSet", 1, map[string]interface{}{},
+			map[string]interface{}{"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(2), "numberAvailable": int64(3)})},
+		{name: "Custom resource available", expected: true, object: object("argoproj.io/v1alpha1", "Rollout", 1, map[string]interface{}{}, condition("True"))},
+		{name: "Custom resource unavailable", object: object("argoproj.io/v1alpha1", "Rollout", 1, map[string]interface{}{}, condition("False"))},
+		{name: "Custom resource without conditions", expected: true, object: object("example.com/v1", "Widget", 1, map[string]interface{}{}, map[string]interface{}{})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workloadAvailable(tt.object); got != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, got)
+			}
+		})
+	}
+}
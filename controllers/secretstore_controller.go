@@ -0,0 +1,58 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+// SecretStoreReconciler drops the clients cached for a SecretStore or
+// ClusterSecretStore when it is deleted or its spec changes, so that deleted
+// stores do not keep their tokens and changed ones log in again
+type SecretStoreReconciler struct {
+	Stores *SecretStores
+	Log    logr.Logger
+}
+
+// Reconcile forgets the client of the store. ClusterSecretStores are queued
+// without a namespace.
+func (r *SecretStoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	kind := secretStoreKind
+	if req.Namespace == "" {
+		kind = clusterSecretStoreKind
+	}
+	if r.Stores.Forget(kind, req.Namespace, req.Name) {
+		r.Log.Info("Secret store changed, dropping its client", "kind", kind, "name", req.Name, "namespace", req.Namespace)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *SecretStoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("secretstore").
+		For(&digitalisiov1beta1.SecretStore{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&digitalisiov1beta1.ClusterSecretStore{}, &handler.EnqueueRequestForObject{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
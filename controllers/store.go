@@ -0,0 +1,343 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+	"digitalis.io/vals-operator/policy"
+	"digitalis.io/vals-operator/vault"
+)
+
+const (
+	secretStoreKind        = "SecretStore"
+	clusterSecretStoreKind = "ClusterSecretStore"
+)
+
+//+kubebuilder:rbac:groups=digitalis.io,resources=secretstores;clustersecretstores,verbs=get;list;watch
+
+// SecretStores logs in to the servers declared by SecretStore and
+// ClusterSecretStore resources and keeps one authenticated client per store
+type SecretStores struct {
+	client client.Client
+	pool   *vault.ClientPool
+	// newClient creates the unauthenticated clients, replaced in tests
+	newClient func(cfg vault.ClientConfig) (vault.SecretsClient, error)
+}
+
+// NewSecretStores creates an empty pool of store clients
+func NewSecretStores(c client.Client) *SecretStores {
+	return &SecretStores{
+		client:    c,
+		pool:      vault.NewClientPool(),
+		newClient: vault.NewClient,
+	}
+}
+
+// storeName returns the kind and name of the store as recorded on secrets
+func storeName(kind, name string) string {
+	if kind == "" {
+		kind = secretStoreKind
+	}
+	return kind + "/" + name
+}
+
+// clientFor returns the client of the store referenced by a resource in the
+// given namespace
+func (s *SecretStores) clientFor(ctx context.Context, ref, namespace string) (vault.SecretsClient, error) {
+	kind, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid secret store reference %q", ref)
+	}
+	return s.Client(ctx, kind, name, namespace)
+}
+
+// Client returns a client logged in to the store. namespace is the namespace
+// of the resource referencing it, where a SecretStore is looked up.
+func (s *SecretStores) Client(ctx context.Context, kind, name, namespace string) (vault.SecretsClient, error) {
+	if s == nil {
+		return nil, fmt.Errorf("secret stores are not enabled")
+	}
+	l := &storeLogin{stores: s}
+	switch kind {
+	case "", secretStoreKind:
+		store := &digitalisiov1beta1.SecretStore{}
+		if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, store); err != nil {
+			return nil, fmt.Errorf("cannot get SecretStore %s/%s: %w", namespace, name, err)
+		}
+		l.spec, l.namespace, l.generation = store.Spec, namespace, store.Generation
+	case clusterSecretStoreKind:
+		store := &digitalisiov1beta1.ClusterSecretStore{}
+		if err := s.client.Get(ctx, types.NamespacedName{Name: name}, store); err != nil {
+			return nil, fmt.Errorf("cannot get ClusterSecretStore %s: %w", name, err)
+		}
+		if err := s.allowed(ctx, store, namespace); err != nil {
+			return nil, err
+		}
+		l.spec, l.generation = store.Spec.SecretStoreSpec, store.Generation
+	default:
+		return nil, fmt.Errorf("unknown secret store kind %s", kind)
+	}
+
+	cfg, err := l.config(ctx)
+	if err == nil {
+		err = l.readCredential(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", storeName(kind, name), err)
+	}
+	// the client logs in again when the store or any secret it reads changes
+	key := storeKey(kind, l.namespace, name)
+	return s.pool.Client(ctx, key, l.version(), func(ctx context.Context) (vault.SecretsClient, *vault.SecretResponse, error) {
+		c, err := s.newClient(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := l.login(ctx, c)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot login with %s: %w", key, err)
+		}
+		return c, resp, nil
+	})
+}
+
+// storeKey returns the key of the client of a store in the pool. namespace
+// is empty for a ClusterSecretStore.
+func storeKey(kind, namespace, name string) string {
+	if namespace != "" {
+		return storeName(kind, namespace+"/"+name)
+	}
+	return storeName(kind, name)
+}
+
+// Forget drops the client cached for the store and reports whether there was
+// one
+func (s *SecretStores) Forget(kind, namespace, name string) bool {
+	if s == nil {
+		return false
+	}
+	return s.pool.Forget(storeKey(kind, namespace, name))
+}
+
+// allowed returns an error unless the ClusterSecretStore may be used by
+// resources in the namespace
+func (s *SecretStores) allowed(ctx context.Context, store *digitalisiov1beta1.ClusterSecretStore, namespace string) error {
+	var nsLabels map[string]string
+	if store.Spec.NamespaceSelector != nil {
+		ns := &corev1.Namespace{}
+		if err := s.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return fmt.Errorf("cannot get namespace %s: %w", namespace, err)
+		}
+		nsLabels = ns.Labels
+	}
+	ok, err := policy.NamespaceMatches(store.Spec.Namespaces, store.Spec.NamespaceSelector, namespace, nsLabels)
+	if err != nil {
+		return fmt.Errorf("invalid ClusterSecretStore %s: %w", store.Name, err)
+	}
+	if !ok {
+		return fmt.Errorf("ClusterSecretStore %s may not be used in namespace %s", store.Name, namespace)
+	}
+	return nil
+}
+
+// storeLogin resolves the settings of one store
+type storeLogin struct {
+	stores *SecretStores
+	spec   digitalisiov1beta1.SecretStoreSpec
+	// namespace of a SecretStore, empty for a ClusterSecretStore
+	namespace  string
+	generation int64
+	// credential is the token, secret ID, password or JWT read from a secret
+	credential string
+	// resourceVersions of the secrets read, part of the version of the client
+	resourceVersions []string
+}
+
+func (l *storeLogin) version() string {
+	return strings.Join(append([]string{fmt.Sprintf("%d", l.generation)}, l.resourceVersions...), "/")
+}
+
+// secret reads a secret referenced by the store. A SecretStore can only read
+// secrets in its own namespace.
+func (l *storeLogin) secret(ctx context.Context, name, namespace string) (*corev1.Secret, error) {
+	if l.namespace != "" {
+		namespace = l.namespace
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace of secret %s is required in a ClusterSecretStore", name)
+	}
+	secret := &corev1.Secret{}
+	if err := l.stores.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, err
+	}
+	l.resourceVersions = append(l.resourceVersions, secret.ResourceVersion)
+	return secret, nil
+}
+
+func (l *storeLogin) secretKey(ctx context.Context, sel digitalisiov1beta1.SecretKeySelector) (string, error) {
+	secret, err := l.secret(ctx, sel.Name, sel.Namespace)
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s", sel.Key, sel.Name)
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+func (l *storeLogin) config(ctx context.Context) (vault.ClientConfig, error) {
+	cfg := vault.ClientConfig{
+		Backend:   vault.ParseBackend(l.spec.Backend),
+		Address:   l.spec.Address,
+		Namespace: l.spec.Namespace,
+	}
+	if l.spec.TLS == nil {
+		return cfg, nil
+	}
+
+	cfg.TLS = &tls.Config{
+		ServerName:         l.spec.TLS.ServerName,
+		InsecureSkipVerify: l.spec.TLS.InsecureSkipVerify,
+	}
+	if sel := l.spec.TLS.CASecretRef; sel != nil {
+		ca, err := l.secretKey(ctx, *sel)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.TLS.RootCAs = x509.NewCertPool()
+		if !cfg.TLS.RootCAs.AppendCertsFromPEM([]byte(ca)) {
+			return cfg, fmt.Errorf("no CA certificates found in secret %s", sel.Name)
+		}
+	}
+	if sel := l.spec.TLS.ClientCertSecretRef; sel != nil {
+		secret, err := l.secret(ctx, sel.Name, sel.Namespace)
+		if err != nil {
+			return cfg, err
+		}
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return cfg, fmt.Errorf("unable to load client certificate from secret %s: %w", sel.Name, err)
+		}
+		cfg.TLS.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// readCredential reads the secret the auth method of the store logs in with
+func (l *storeLogin) readCredential(ctx context.Context) error {
+	var sel *digitalisiov1beta1.SecretKeySelector
+	auth := l.spec.Auth
+	switch {
+	case auth.Token != nil:
+		sel = &auth.Token.SecretRef
+	case auth.AppRole != nil:
+		sel = &auth.AppRole.SecretRef
+	case auth.UserPass != nil:
+		sel = &auth.UserPass.SecretRef
+	case auth.JWT != nil:
+		sel = auth.JWT.SecretRef
+	}
+	if sel == nil {
+		return nil
+	}
+	var err error
+	l.credential, err = l.secretKey(ctx, *sel)
+	return err
+}
+
+// login logs the client in with the auth method of the store
+func (l *storeLogin) login(ctx context.Context, c vault.SecretsClient) (*vault.SecretResponse, error) {
+	auth := l.spec.Auth
+	switch {
+	case auth.Token != nil:
+		return &vault.SecretResponse{Auth: &vault.AuthInfo{ClientToken: l.credential}}, nil
+	case auth.Kubernetes != nil:
+		jwt, err := l.serviceAccountToken(ctx, auth.Kubernetes.ServiceAccountRef)
+		if err != nil {
+			return nil, err
+		}
+		return c.LoginKubernetes(ctx, auth.Kubernetes.Role, mountPath(auth.Kubernetes.MountPath, "kubernetes"), jwt)
+	case auth.AppRole != nil:
+		return c.Write(ctx, fmt.Sprintf("auth/%s/login", mountPath(auth.AppRole.MountPath, "approle")), map[string]interface{}{
+			"role_id":   auth.AppRole.RoleID,
+			"secret_id": l.credential,
+		})
+	case auth.UserPass != nil:
+		return c.Write(ctx, fmt.Sprintf("auth/%s/login/%s", mountPath(auth.UserPass.MountPath, "userpass"), auth.UserPass.Username), map[string]interface{}{
+			"password": l.credential,
+		})
+	case auth.JWT != nil:
+		jwt := l.credential
+		if auth.JWT.SecretRef == nil {
+			var err error
+			if jwt, err = l.serviceAccountToken(ctx, auth.JWT.ServiceAccountRef); err != nil {
+				return nil, err
+			}
+		}
+		return c.Write(ctx, fmt.Sprintf("auth/%s/login", mountPath(auth.JWT.MountPath, "jwt")), map[string]interface{}{
+			"role": auth.JWT.Role,
+			"jwt":  jwt,
+		})
+	case auth.Cert != nil:
+		if l.spec.TLS == nil || l.spec.TLS.ClientCertSecretRef == nil {
+			return nil, fmt.Errorf("tls.clientCertSecretRef is required for cert authentication")
+		}
+		return c.Write(ctx, fmt.Sprintf("auth/%s/login", mountPath(auth.Cert.MountPath, "cert")), map[string]interface{}{
+			"name": auth.Cert.Role,
+		})
+	default:
+		return nil, fmt.Errorf("no auth method configured")
+	}
+}
+
+// serviceAccountToken requests a token for the ServiceAccount. Without one, a
+// SecretStore uses the default ServiceAccount of its namespace. A
+// ClusterSecretStore must name one, as it would otherwise log in as the
+// operator.
+func (l *storeLogin) serviceAccountToken(ctx context.Context, sa *digitalisiov1beta1.ServiceAccountSelector) (string, error) {
+	if sa == nil && l.namespace == "" {
+		return "", fmt.Errorf("serviceAccountRef is required in a ClusterSecretStore")
+	}
+	if sa == nil {
+		sa = &digitalisiov1beta1.ServiceAccountSelector{Name: "default"}
+	}
+
+	namespace := sa.Namespace
+	if l.namespace != "" {
+		namespace = l.namespace
+	}
+	if namespace == "" {
+		return "", fmt.Errorf("namespace of service account %s is required in a ClusterSecretStore", sa.Name)
+	}
+	return requestToken(ctx, l.stores.client, namespace, sa.Name, sa.Audience, serviceAccountTokenTTL)
+}
+
+func mountPath(path, fallback string) string {
+	if path = strings.Trim(path, "/"); path != "" {
+		return path
+	}
+	return fallback
+}
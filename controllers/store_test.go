@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+func TestSecretStoreLogin(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   string
+		kind      string
+		secretNs  string
+		expectErr bool
+	}{
+		{name: "Vault SecretStore", backend: "vault", kind: "SecretStore"},
+		{name: "OpenBao SecretStore", backend: "openbao", kind: "SecretStore"},
+		{name: "Kind defaults to SecretStore", backend: "vault"},
+		{name: "SecretStore reads secrets in its own namespace", backend: "vault", kind: "SecretStore", secretNs: "other"},
+		{name: "ClusterSecretStore", backend: "openbao", kind: "ClusterSecretStore", secretNs: "team-a"},
+		{name: "ClusterSecretStore requires the secret namespace", backend: "openbao", kind: "ClusterSecretStore", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logins := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if r.URL.Path != "/v1/auth/apps/login" || body["role_id"] != "team-a" || body["secret_id"] != "s3cr3t" {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"errors":["permission denied"]}`)
+					return
+				}
+				logins++
+				fmt.Fprintf(w, `{"auth":{"client_token":"token-%d","lease_duration":3600,"renewable":true}}`, logins)
+			}))
+			defer server.Close()
+
+			spec := digitalisiov1beta1.SecretStoreSpec{
+				Backend: tt.backend,
+				Address: server.URL,
+				Auth: digitalisiov1beta1.SecretStoreAuth{
+					AppRole: &digitalisiov1beta1.AppRoleAuth{
+						RoleID:    "team-a",
+						MountPath: "/apps/",
+						SecretRef: digitalisiov1beta1.SecretKeySelector{Name: "approle", Namespace: tt.secretNs, Key: "secret-id"},
+					},
+				},
+			}
+			var store runtime.Object = &digitalisiov1beta1.SecretStore{
+				ObjectMeta: metav1.ObjectMeta{Name: "store", Namespace: "team-a"},
+				Spec:       spec,
+			}
+			if tt.kind == "ClusterSecretStore" {
+				store = &digitalisiov1beta1.ClusterSecretStore{
+					ObjectMeta: metav1.ObjectMeta{Name: "store"},
+					Spec:       digitalisiov1beta1.ClusterSecretStoreSpec{SecretStoreSpec: spec, Namespaces: []string{"team-*"}},
+				}
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "approle", Namespace: "team-a"},
+				Data:       map[string][]byte{"secret-id": []byte("s3cr3t\n")},
+			}
+
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = digitalisiov1beta1.AddToScheme(scheme)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(store, secret).Build()
+			stores := NewSecretStores(c)
+
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				_, err := stores.Client(ctx, tt.kind, "store", "team-a")
+				if tt.expectErr {
+					if err == nil {
+						t.Errorf("Expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if logins != 1 {
+				t.Errorf("Expected the client to be reused but got %d logins", logins)
+			}
+
+			// a new secret ID logs in again
+			secret.Data["secret-id"] = []byte("s3cr3t")
+			if err := c.Update(ctx, secret); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stores.Client(ctx, tt.kind, "store", "team-a"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if logins != 2 {
+				t.Errorf("Expected 2 logins but got %d", logins)
+			}
+
+			// a deleted or changed store drops its client
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "store"}}
+			if tt.kind == "ClusterSecretStore" {
+				req.Namespace = ""
+			}
+			r := &SecretStoreReconciler{Stores: stores, Log: logr.Discard()}
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stores.Client(ctx, tt.kind, "store", "team-a"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if logins != 3 {
+				t.Errorf("Expected the forgotten client to log in again but got %d logins", logins)
+			}
+		})
+	}
+}
+
+func TestSecretStoresDisabled(t *testing.T) {
+	var stores *SecretStores
+	if _, err := stores.Client(context.Background(), "SecretStore", "store", "team-a"); err == nil {
+		t.Errorf("Expected an error when secret stores are not enabled")
+	}
+}
+
+func TestClusterSecretStoreNamespaces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"auth":{"client_token":"token","lease_duration":3600,"renewable":true}}`)
+	}))
+	defer server.Close()
+
+	store := func(name string, spec digitalisiov1beta1.ClusterSecretStoreSpec) *digitalisiov1beta1.ClusterSecretStore {
+		spec.Backend = "vault"
+		spec.Address = server.URL
+		if spec.Auth.Kubernetes == nil {
+			spec.Auth.Token = &digitalisiov1beta1.TokenAuth{
+				SecretRef: digitalisiov1beta1.SecretKeySelector{Name: "token", Namespace: "vault", Key: "token"},
+			}
+		}
+		return &digitalisiov1beta1.ClusterSecretStore{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+	}
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bi", Labels: map[string]string{"vault": "shared"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "vault"}, Data: map[string][]byte{"token": []byte("t")}},
+		store("open", digitalisiov1beta1.ClusterSecretStoreSpec{}),
+		store("team-a", digitalisiov1beta1.ClusterSecretStoreSpec{Namespaces: []string{"team-a", "team-a-*"}}),
+		store("shared", digitalisiov1beta1.ClusterSecretStoreSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"vault": "shared"}},
+		}),
+		store("operator", digitalisiov1beta1.ClusterSecretStoreSpec{
+			Namespaces: []string{"*"},
+			SecretStoreSpec: digitalisiov1beta1.SecretStoreSpec{Auth: digitalisiov1beta1.SecretStoreAuth{
+				Kubernetes: &digitalisiov1beta1.KubernetesAuth{Role: "operator"},
+			}},
+		}),
+	).Build()
+	stores := NewSecretStores(c)
+
+	tests := []struct {
+		store     string
+		namespace string
+		expectErr bool
+	}{
+		{store: "open", namespace: "team-a", expectErr: true},
+		{store: "team-a", namespace: "team-a-dev"},
+		{store: "team-a", namespace: "team-b", expectErr: true},
+		{store: "shared", namespace: "bi"},
+		{store: "shared", namespace: "team-b", expectErr: true},
+		{store: "operator", namespace: "team-b", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.store+" in "+tt.namespace, func(t *testing.T) {
+			_, err := stores.Client(context.Background(), "ClusterSecretStore", tt.store, tt.namespace)
+			if tt.expectErr && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -17,27 +17,23 @@ limitations under the License.
 package controllers
 
 import (
-	"bytes"
 	"context"
-	b64 "encoding/base64"
 	"fmt"
 	"math"
 	"math/rand"
-	"regexp"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/helmfile/vals"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 
-	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -46,9 +42,10 @@ import (
 	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
 	valsDb "digitalis.io/vals-operator/db"
 	dbType "digitalis.io/vals-operator/db/types"
+	"digitalis.io/vals-operator/maintenance"
 	dmetrics "digitalis.io/vals-operator/metrics"
 	"digitalis.io/vals-operator/utils"
-	sprig "github.com/Masterminds/sprig/v3"
+	"digitalis.io/vals-operator/vault"
 )
 
 // ValsSecretReconciler reconciles a ValsSecret object
@@ -64,6 +61,16 @@ type ValsSecretReconciler struct {
 	DefaultTTL               time.Duration
 	DisableNamespaceSync     bool
 	AllowedNamespacesForSync map[string]bool // empty = all namespaces allowed
+	// Identities logs in with the ServiceAccount of the namespace when set
+	Identities *vault.IdentityPool
+	// Rollouts staggers the restarts of the workloads when set
+	Rollouts *RolloutQueue
+	// Stores logs in to the SecretStore or ClusterSecretStore of a ValsSecret
+	Stores *SecretStores
+	// MaintenanceWindows hold changes to secrets without windows of their own
+	MaintenanceWindows maintenance.Windows
+	// DryRun reports the changes instead of making them when set
+	DryRun *DryRun
 
 	errorCounts map[string]int
 	errMu       sync.Mutex
@@ -77,6 +84,9 @@ type ValsSecretReconciler struct {
 func (r *ValsSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("Secrets")
 	pred := predicate.GenerationChangedPredicate{}
+	if r.Rollouts != nil {
+		r.Rollouts.AddRecovery(r.recoverRollouts)
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&secretv1.ValsSecret{}).
@@ -90,6 +100,9 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	err := r.Get(ctx, req.NamespacedName, &secret)
 	if err != nil {
+		if errors.IsNotFound(err) {
+			r.DryRun.forget("ValsSecret", req.Namespace, req.Name)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
@@ -100,7 +113,8 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	//! [finalizer]
 	valsSecretFinalizerName := "vals.digitalis.io/finalizer"
 	if secret.ObjectMeta.DeletionTimestamp.IsZero() {
-		if !utils.ContainsString(secret.GetFinalizers(), valsSecretFinalizerName) {
+		// without the finalizer a deletion is left to garbage collection in dry-run mode
+		if !utils.ContainsString(secret.GetFinalizers(), valsSecretFinalizerName) && !r.DryRun.Enabled() {
 			secret.SetFinalizers(append(secret.GetFinalizers(), valsSecretFinalizerName))
 			if err := r.Update(context.Background(), &secret); err != nil {
 				return ctrl.Result{}, err
@@ -110,6 +124,14 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// The object is being deleted
 		r.clearErrorCount(&secret)
 		if utils.ContainsString(secret.GetFinalizers(), valsSecretFinalizerName) {
+			if r.DryRun.Enabled() {
+				name := secret.Name
+				if secret.Spec.Name != "" {
+					name = secret.Spec.Name
+				}
+				r.dryRun(&secret, dryRunDeleteSecret, fmt.Sprintf("Would delete secret %s/%s and remove the finalizer", secret.Namespace, name))
+				return ctrl.Result{}, nil
+			}
 			// our finalizer is present, so lets handle any external dependency
 			if err := r.deleteSecret(ctx, &secret); err != nil {
 				r.Log.Error(err, "Error deleting from Vals-Secret")
@@ -126,6 +148,7 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		// Stop reconciliation as the item is being deleted
 		r.Log.Info(fmt.Sprintf("Secret %s/%s deleted", secret.Namespace, secret.Name))
 		dmetrics.SecretInfo.WithLabelValues(secret.Name, secret.Namespace).Set(0)
+		dmetrics.StaleConsumers.DeleteLabelValues("ValsSecret", secret.Name, secret.Namespace)
 		return ctrl.Result{}, nil
 	}
 	//! [finalizer]
@@ -142,12 +165,46 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	if currentSecret != nil && currentSecret.Name != "" && !r.hasSecretExpired(secret, currentSecret) {
+		r.trackConsumers(ctx, &secret, false)
 		return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
 	}
+	if currentSecret != nil && currentSecret.Name != "" {
+		if until := stillHeld(&secret, secret.Status.PendingUntil, r.maintenanceWindows(&secret), time.Now()); !until.IsZero() {
+			return ctrl.Result{RequeueAfter: r.hold(ctx, &secret, until)}, nil
+		}
+	}
+
+	if r.usesOperatorToken(&secret) {
+		if err := backendUnavailable(r.Identities); err != nil {
+			r.Log.Info("Waiting for the secrets backend", "name", secret.Name, "namespace", secret.Namespace, "reason", err.Error())
+			return ctrl.Result{RequeueAfter: backendRetryPeriod}, nil
+		}
+	}
 
 	secretYaml := make(map[string]interface{})
+	resolved := make(map[string]interface{})
 	for k, v := range secret.Spec.Data {
-		if strings.HasPrefix(v.Ref, k8sSecretPrefix) {
+		if r.readsVaultRef(&secret, v.Ref) {
+			// vals only takes the token from the environment so read it with our own client
+			resolved[k], err = r.readVaultRef(ctx, &secret, v.Ref)
+			if err != nil {
+				dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
+				r.Log.Error(err, "Failed to get secrets from secrets store", "name", secret.Name)
+				if r.recordingEnabled(&secret) {
+					msg := fmt.Sprintf("Failed to get secrets from secrets store %v", err)
+					r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", msg)
+				}
+				return r.errorBackoff(&secret)
+			}
+		} else if err = r.valsRefError(v.Ref); err != nil {
+			dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
+			r.Log.Error(err, "Cannot read the reference with vals", "name", secret.Name)
+			if r.recordingEnabled(&secret) {
+				msg := fmt.Sprintf("Cannot read the reference with vals %v", err)
+				r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", msg)
+			}
+			return r.errorBackoff(&secret)
+		} else if strings.HasPrefix(v.Ref, k8sSecretPrefix) {
 			secretYaml[k], err = r.getKeyFromK8sSecret(v.Ref, secret.Namespace)
 			if err != nil {
 				if r.recordingEnabled(&secret) {
@@ -174,80 +231,57 @@ func (r *ValsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 		return r.errorBackoff(&secret)
 	}
+	if valsRendered == nil {
+		valsRendered = make(map[string]interface{})
+	}
+	for k, v := range resolved {
+		valsRendered[k] = v
+	}
 	dmetrics.SecretRetrieveTime.WithLabelValues(secret.GetName(), secret.GetNamespace()).Set(float64(elapsedPull))
 
-	data := make(map[string][]byte)
-	dataStr := make(map[string]string)
-	for k, v := range valsRendered {
-		if secret.Spec.Data[k].Encoding == "base64" && !strings.HasPrefix(secret.Spec.Data[k].Ref, k8sSecretPrefix) {
-			sDec, err := b64.StdEncoding.DecodeString(v.(string))
-			if err != nil {
-				dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
-				r.Log.Error(err, "Cannot b64 decode secret. Please check encoding configuration. Requeuing.", "name", secret.Name, "namespace", secret.Namespace)
-				if r.recordingEnabled(&secret) {
-					r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", "Base64 decoding failed")
-				}
-
-				return r.errorBackoff(&secret)
-			}
-			data[k] = sDec
-			dataStr[k] = string(sDec)
-		} else {
-			data[k] = []byte(v.(string))
-			dataStr[k] = v.(string)
+	data, dataStr, err := decodeData(&secret, valsRendered)
+	if err != nil {
+		dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
+		r.Log.Error(err, "Cannot b64 decode secret. Please check encoding configuration. Requeuing.", "name", secret.Name, "namespace", secret.Namespace)
+		if r.recordingEnabled(&secret) {
+			r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", "Base64 decoding failed")
 		}
+
+		return r.errorBackoff(&secret)
 	}
 
 	/* Render any template given */
-	for k, v := range secret.Spec.Template {
-		b := bytes.NewBuffer(nil)
-		t, err := template.New(k).Funcs(sprig.FuncMap()).Parse(v)
-		if err != nil {
-			dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
-			r.Log.Error(err, "Cannot parse template", "name", secret.Name, "namespace", secret.Namespace)
-			if r.recordingEnabled(&secret) {
-				msg := fmt.Sprintf("Template could not be parsed: %v", err)
-				r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", msg)
-			}
-			continue
-		}
-		if err := t.Execute(b, &dataStr); err != nil {
-			dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
-			r.Log.Error(err, "Cannot render template", "name", secret.Name, "namespace", secret.Namespace)
-			if r.recordingEnabled(&secret) {
-				msg := fmt.Sprintf("Template could not be rendered: %v", err)
-				r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", msg)
-			}
-			continue
+	for _, err := range renderTemplates(secret.Spec.Template, data, dataStr) {
+		dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
+		r.Log.Error(err, "Cannot render template", "name", secret.Name, "namespace", secret.Namespace)
+		if r.recordingEnabled(&secret) {
+			msg := fmt.Sprintf("Template could not be rendered: %v", err)
+			r.Recorder.Event(&secret, corev1.EventTypeNormal, "Failed", msg)
 		}
+	}
 
-		data[k] = b.Bytes()
+	if currentSecret != nil && currentSecret.Name != "" && !utils.ByteMapsMatch(currentSecret.Data, data) {
+		if until := heldUntil(&secret, r.maintenanceWindows(&secret), time.Now()); !until.IsZero() {
+			return ctrl.Result{RequeueAfter: r.hold(ctx, &secret, until)}, nil
+		}
 	}
 
-	updated, err := r.upsertSecret(&secret, data)
+	change, err := r.upsertSecret(&secret, data)
 	if err != nil {
 		r.Log.Error(err, "Failed to create secret", "name", secret.Name, "namespace", secret.Namespace)
 		return ctrl.Result{}, nil
 	}
+	releaseChanges(ctx, r.Client, r.Log, &secret, &secret.Status.PendingUntil)
 
 	elapsedProcess := time.Since(start).Milliseconds() // Calculate the elapsed time
 	dmetrics.SecretCreationTime.WithLabelValues(secret.GetName(), secret.GetNamespace()).Set(float64(elapsedProcess))
 	dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).Set(0)
 
 	/* Patching resources to force a rollout if required */
-	if updated {
-		for target := range secret.Spec.Rollout {
-			if secret.Spec.Rollout[target].Name != "" && secret.Spec.Rollout[target].Kind != "" {
-				if err := r.rollout(&secret, secret.Spec.Rollout[target]); err != nil {
-					r.Log.Error(err, "Could not perform rollout",
-						"name", secret.Name,
-						"namespace", secret.Namespace,
-						"kind", secret.Spec.Rollout[target].Kind,
-						"name", secret.Spec.Rollout[target].Name)
-				}
-			}
-		}
+	if change.changed() {
+		r.rollout(ctx, &secret, change)
 	}
+	r.trackConsumers(ctx, &secret, true)
 	r.clearErrorCount(&secret)
 	return ctrl.Result{RequeueAfter: r.ReconciliationPeriod}, nil
 }
@@ -274,8 +308,8 @@ func (r *ValsSecretReconciler) shouldExclude(sDefNamespace string) bool {
 	return false
 }
 
-// upsertSecret will create or update a secret. Returns boolean is update or error
-func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[string][]byte) (bool, error) {
+// upsertSecret will create or update a secret. Returns the change, nil when not updated, or error
+func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[string][]byte) (*secretChange, error) {
 	var secretName string
 	if sDef.Spec.Name != "" {
 		secretName = sDef.Spec.Name
@@ -285,15 +319,16 @@ func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[
 	secret, err := r.getSecret(secretName, sDef.GetNamespace())
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			return false, err
+			return nil, err
 		}
 		// secret not found, create a new empty one
 		secret = &corev1.Secret{}
 	}
+	exists := secret.Name != ""
 
 	// Do nothing if the secret does not need updating
 	if !r.secretNeedsUpdate(sDef, secret, data) {
-		return false, nil
+		return nil, nil
 	}
 
 	if sDef.Spec.Name != "" {
@@ -302,6 +337,9 @@ func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[
 		secret.Name = sDef.Name
 	}
 	secret.Namespace = sDef.Namespace
+	change := newSecretChange(secretName, secret.Data, data)
+	recordDataChange(secret, change)
+	diff := redactedDiff(secret.Data, data)
 	secret.Data = data
 	secret.Type = corev1.SecretType(sDef.Spec.Type)
 	if secret.ObjectMeta.Labels == nil {
@@ -319,7 +357,14 @@ func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[
 	secret.ResourceVersion = ""
 
 	if err = controllerutil.SetControllerReference(sDef, secret, r.Scheme()); err != nil {
-		return false, err
+		return nil, err
+	}
+	if r.DryRun.Enabled() {
+		r.dryRunSecret(sDef, secret, exists, diff)
+		if len(sDef.Spec.Databases) > 0 {
+			r.updateDatabases(sDef, secret)
+		}
+		return change, nil
 	}
 	err = r.Create(r.Ctx, secret)
 	if errors.IsAlreadyExists(err) {
@@ -333,14 +378,14 @@ func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[
 		}
 		dmetrics.SecretFailures.Inc()
 		dmetrics.SecretError.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
-		return false, err
+		return nil, err
 	}
 
 	/* Prometheus */
 	dmetrics.SecretInfo.WithLabelValues(secret.Name, secret.Namespace).SetToCurrentTime()
 
 	if r.recordingEnabled(sDef) {
-		r.Recorder.Event(sDef, corev1.EventTypeNormal, "Updated", "Secret created or updated")
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "Updated", "Secret created or updated"+change.message())
 	}
 	r.Log.Info("Updated secret", "name", secretName, "namespace", secret.Namespace)
 
@@ -348,11 +393,12 @@ func (r *ValsSecretReconciler) upsertSecret(sDef *secretv1.ValsSecret, data map[
 		r.updateDatabases(sDef, secret)
 	} // end DB section
 
-	return true, err
+	return change, err
 }
 
 func (r *ValsSecretReconciler) updateDatabases(sDef *secretv1.ValsSecret, secret *corev1.Secret) {
 	r.Log.Info("Syncing credentials to databases")
+	var planned []string
 	for db := range sDef.Spec.Databases {
 		if sDef.Spec.Databases[db].LoginCredentials.SecretName != "" {
 			namespace := sDef.Spec.Databases[db].LoginCredentials.Namespace
@@ -394,6 +440,10 @@ func (r *ValsSecretReconciler) updateDatabases(sDef *secretv1.ValsSecret, secret
 				Hosts:         sDef.Spec.Databases[db].Hosts,
 				Port:          sDef.Spec.Databases[db].Port,
 			}
+			if r.DryRun.Enabled() {
+				planned = append(planned, fmt.Sprintf("%s on %s", dbQuery.Driver, strings.Join(dbQuery.Hosts, ",")))
+				continue
+			}
 			if err := valsDb.UpdateUserPassword(dbQuery); err != nil {
 				r.Log.Error(err, "Cannot update DB password", "name", secret.Name, "namespace", secret.Namespace)
 				if r.recordingEnabled(sDef) {
@@ -402,6 +452,9 @@ func (r *ValsSecretReconciler) updateDatabases(sDef *secretv1.ValsSecret, secret
 			}
 		}
 	}
+	if len(planned) > 0 {
+		r.dryRun(sDef, dryRunUpdateDatabase, "Would update the password of the user in "+strings.Join(planned, ", "))
+	}
 }
 
 // secretNeedsUpdate Checks if the secret data or definition has changed from the current secret
@@ -462,20 +515,18 @@ func (r *ValsSecretReconciler) isNamespaceSyncAllowed(valsSecretNamespace, refer
 }
 
 func (r *ValsSecretReconciler) getKeyFromK8sSecret(secretRef, valsSecretNamespace string) (string, error) {
-	re := regexp.MustCompile(`ref\+k8s://(?P<namespace>\S+)/(?P<secretName>\S+)#(?P<key>\S+)`)
-	matchMap := utils.FindAllGroups(re, secretRef)
-
-	if !utils.K8sSecretFound(matchMap) {
-		return "", fmt.Errorf("the ref+k8s secret '%s' did not match the regular expression for ref+k8s://namespace/secret-name#key", secretRef)
+	namespace, name, key, err := parseK8sRef(secretRef)
+	if err != nil {
+		return "", err
 	}
-	if err := r.isNamespaceSyncAllowed(valsSecretNamespace, matchMap["namespace"]); err != nil {
+	if err := r.isNamespaceSyncAllowed(valsSecretNamespace, namespace); err != nil {
 		return "", err
 	}
-	secret, err := r.getSecret(matchMap["secretName"], matchMap["namespace"])
+	secret, err := r.getSecret(name, namespace)
 	if err != nil {
 		return "", err
 	}
-	return string(secret.Data[matchMap["key"]]), nil
+	return string(secret.Data[key]), nil
 }
 
 func (r *ValsSecretReconciler) hasSecretExpired(sDef secretv1.ValsSecret, secret *corev1.Secret) bool {
@@ -553,55 +604,227 @@ func (r *ValsSecretReconciler) clearErrorCount(valsSecret *secretv1.ValsSecret)
 	delete(r.errorCounts, errKey)
 }
 
-// rollout is used to restart the Deployment or StatefulSet
-func (r *ValsSecretReconciler) rollout(sDef *secretv1.ValsSecret, rolloutTarget secretv1.RolloutTarget) error {
-	var err error
-
-	clientObject := types.NamespacedName{
-		Namespace: sDef.Namespace,
-		Name:      rolloutTarget.Name,
-	}
-	r.Log.Info(fmt.Sprintf("Rolling restart %s/%s in namespace %s", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace))
-
-	if strings.ToLower(rolloutTarget.Kind) == "deployment" {
-		var object v1.Deployment
-		err = r.Get(r.Ctx, clientObject, &object)
-		if errors.IsNotFound(err) {
-			msg := fmt.Sprintf("%s/%s in namespace %s not found", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace)
-			r.Log.Error(err, msg)
-			return nil
+// rolloutPolicy returns how the restarts are staggered and whether the pods
+// are reloaded instead
+func (r *ValsSecretReconciler) rolloutPolicy(sDef *secretv1.ValsSecret) rolloutPolicy {
+	owner := "ValsSecret/" + sDef.Namespace + "/" + sDef.Name
+	policy := rolloutPolicy{owner: owner}
+	if p := sDef.Spec.RolloutPolicy; p != nil {
+		var err error
+		policy, err = newRolloutPolicy(owner, p.MaxConcurrent, p.WaitForAvailable, p.MinInterval)
+		if err != nil {
+			r.Log.Error(err, "Ignoring the minimum interval", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
+	}
+	policy.reload = sDef.Spec.RolloutStrategy == rolloutStrategyReload
+	if e := sDef.Spec.Reload; e != nil && policy.reload {
+		var err error
+		policy.endpoint, err = newReloadEndpoint(e.Port, e.Path, e.Method, e.Scheme, e.Delay)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Ignoring the reload delay", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
+	}
+	policy.windows = rolloutWindows(sDef, r.maintenanceWindows(sDef))
+	return policy
+}
 
-		if object.Spec.Template.Annotations == nil {
-			object.Spec.Template.Annotations = make(map[string]string)
+// trackConsumers records in the status how far the workloads restarted for
+// the secret have rolled out
+func (r *ValsSecretReconciler) trackConsumers(ctx context.Context, sDef *secretv1.ValsSecret, force bool) {
+	before := sDef.DeepCopy()
+	targets := valsWorkloads(sDef.Spec.Rollout)
+	if len(targets) == 0 && sDef.Spec.RolloutMode != rolloutModeAuto {
+		sDef.Status.Consumers = nil
+		meta.RemoveStatusCondition(&sDef.Status.Conditions, consumersConverged)
+		dmetrics.StaleConsumers.DeleteLabelValues("ValsSecret", sDef.Name, sDef.Namespace)
+	} else {
+		if !needsTracking(sDef.Status.Conditions, force) {
+			return
 		}
-		object.Spec.Template.Annotations[restartedAnnotation] = time.Now().UTC().Format(timeLayout)
-		err = r.Update(r.Ctx, &object)
+		secretName := sDef.Name
+		if sDef.Spec.Name != "" {
+			secretName = sDef.Spec.Name
+		}
+		policy := r.rolloutPolicy(sDef)
+		var skipped []string
+		targets, skipped = rolloutTargets(ctx, r.APIReader, r.Log, sDef.Namespace, sDef.Spec.RolloutMode, secretName, targets)
+		states, err := consumerStates(ctx, r.APIReader, sDef.Namespace, secretName, policy.reload, targets)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Cannot track the consumers", "name", sDef.Name, "namespace", sDef.Namespace)
 		}
-	} else if strings.ToLower(rolloutTarget.Kind) == "statefulset" {
-		var object v1.StatefulSet
-		err = r.Get(r.Ctx, clientObject, &object)
-		if errors.IsNotFound(err) {
-			r.Log.Error(err, fmt.Sprintf("%s/%s in namespace %s not found", rolloutTarget.Kind, rolloutTarget.Name, sDef.Namespace))
-			return nil
+		condition, stale := consumersCondition(states, skipped, r.Rollouts.Busy(policy.owner), sDef.Generation)
+		dmetrics.StaleConsumers.WithLabelValues("ValsSecret", sDef.Name, sDef.Namespace).Set(float64(stale))
+		sDef.Status.Consumers = nil
+		for _, s := range states {
+			sDef.Status.Consumers = append(sDef.Status.Consumers, secretv1.RolloutConsumer{
+				Kind:        s.target.Kind,
+				Name:        s.target.Name,
+				APIVersion:  s.target.APIVersion,
+				Hash:        s.hash,
+				Pods:        s.pods,
+				UpdatedPods: s.updated,
+				Converged:   s.converged(),
+			})
 		}
+		meta.SetStatusCondition(&sDef.Status.Conditions, condition)
+	}
+	if equality.Semantic.DeepEqual(before.Status, sDef.Status) {
+		return
+	}
+	if err := r.Status().Patch(ctx, sDef, client.MergeFrom(before)); err != nil {
+		r.Log.Error(err, "Cannot update status", "name", sDef.Name, "namespace", sDef.Namespace)
+	}
+}
+
+// maintenanceWindows returns the windows changes to the secret are held until
+func (r *ValsSecretReconciler) maintenanceWindows(sDef *secretv1.ValsSecret) maintenance.Windows {
+	if len(sDef.Spec.MaintenanceWindows) == 0 {
+		return r.MaintenanceWindows
+	}
+	var windows maintenance.Windows
+	for _, w := range sDef.Spec.MaintenanceWindows {
+		window, err := maintenance.NewWindow(w.Schedule, w.Duration, w.TimeZone)
 		if err != nil {
-			return err
+			r.Log.Error(err, "Ignoring the maintenance windows", "name", sDef.Name, "namespace", sDef.Namespace)
+			if r.recordingEnabled(sDef) {
+				r.Recorder.Event(sDef, corev1.EventTypeNormal, "Failed", fmt.Sprintf("Invalid maintenance window: %v", err))
+			}
+			return nil
 		}
+		windows = append(windows, window)
+	}
+	return windows
+}
 
-		object.Spec.Template.Annotations[restartedAnnotation] = time.Now().UTC().Format(timeLayout)
-		err = r.Update(r.Ctx, &object)
-		if err != nil {
-			return err
+// hold leaves the secret unchanged until the maintenance window opens
+func (r *ValsSecretReconciler) hold(ctx context.Context, sDef *secretv1.ValsSecret, until time.Time) time.Duration {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	return holdChanges(ctx, r.Client, r.Log, recorder, sDef, &sDef.Status.PendingUntil, until, r.ReconciliationPeriod)
+}
+
+// dryRun reports a change to the secret that is not made
+func (r *ValsSecretReconciler) dryRun(sDef *secretv1.ValsSecret, action, message string) {
+	var recorder record.EventRecorder
+	if r.recordingEnabled(sDef) {
+		recorder = r.Recorder
+	}
+	r.DryRun.report(recorder, sDef, "ValsSecret", action, message)
+}
+
+// dryRunSecret reports the keys that would be written to the secret
+func (r *ValsSecretReconciler) dryRunSecret(sDef *secretv1.ValsSecret, secret *corev1.Secret, exists bool, diff string) {
+	if !exists {
+		r.dryRun(sDef, dryRunCreateSecret, fmt.Sprintf("Would create secret %s/%s (%s)", secret.Namespace, secret.Name, diff))
+		return
+	}
+	if diff == "" {
+		diff = "labels or annotations"
+	}
+	r.dryRun(sDef, dryRunUpdateSecret, fmt.Sprintf("Would update secret %s/%s (%s)", secret.Namespace, secret.Name, diff))
+}
+
+// rollout is used to restart the workloads using the secret
+func (r *ValsSecretReconciler) rollout(ctx context.Context, sDef *secretv1.ValsSecret, change *secretChange) {
+	targets := valsWorkloads(sDef.Spec.Rollout)
+	if r.DryRun.Enabled() {
+		if message := plannedRollout(ctx, r.APIReader, r.Log, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, targets); message != "" {
+			r.dryRun(sDef, dryRunRollout, message)
 		}
-	} else {
-		return fmt.Errorf("%s kind is not supported", rolloutTarget.Kind)
+		return
 	}
+	skipped := rolloutSecret(ctx, r.Client, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, change, targets)
+	if len(skipped) > 0 && r.recordingEnabled(sDef) {
+		r.Recorder.Event(sDef, corev1.EventTypeNormal, "RolloutSkipped", skippedRollout(change.secret, skipped))
+	}
+}
 
-	return nil
+// recoverRollouts queues again the restarts lost when the operator stopped
+func (r *ValsSecretReconciler) recoverRollouts(ctx context.Context) {
+	if r.DryRun.Enabled() {
+		return
+	}
+	var list secretv1.ValsSecretList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Cannot list the ValsSecrets to recover their rollouts")
+		return
+	}
+	for i := range list.Items {
+		sDef := &list.Items[i]
+		if sDef.DeletionTimestamp != nil || r.shouldExclude(sDef.Namespace) {
+			continue
+		}
+		if len(sDef.Spec.Rollout) == 0 && sDef.Spec.RolloutMode != rolloutModeAuto {
+			continue
+		}
+		secretName := sDef.Name
+		if sDef.Spec.Name != "" {
+			secretName = sDef.Spec.Name
+		}
+		recoverRollout(ctx, r.APIReader, r.Log, r.Rollouts, r.rolloutPolicy(sDef), sDef.Namespace, sDef.Spec.RolloutMode, secretName, valsWorkloads(sDef.Spec.Rollout))
+	}
+}
+
+// valsWorkloads returns the workloads listed in the rollout of a ValsSecret
+func valsWorkloads(targets []secretv1.RolloutTarget) []workloadRef {
+	var refs []workloadRef
+	for _, t := range targets {
+		refs = append(refs, workloadRef{APIVersion: t.APIVersion, Kind: t.Kind, Name: t.Name, TemplatePath: t.TemplatePath})
+	}
+	return refs
+}
+
+// readsVaultRef reports whether the reference is read by the operator rather than
+// by vals. References with their own parameters are left to vals unless
+// per-namespace identity is enabled or the ValsSecret uses a secret store.
+func (r *ValsSecretReconciler) readsVaultRef(sDef *secretv1.ValsSecret, ref string) bool {
+	if !vault.IsVaultRef(ref) {
+		return false
+	}
+	if r.Identities != nil || sDef.Spec.StoreRef != nil {
+		return true
+	}
+	return vault.Started() && !vault.RefHasParams(ref)
+}
+
+// valsRefError returns why vals cannot read a Vault reference left to it. Once
+// the operator is logged in it no longer exports VAULT_TOKEN, so the reference
+// must bring its own credentials unless the pod sets a token of its own.
+func (r *ValsSecretReconciler) valsRefError(ref string) error {
+	if !vault.Started() {
+		return nil
+	}
+	return vault.CheckValsRef(ref)
+}
+
+// usesOperatorToken reports whether any reference is read with the operator's token
+func (r *ValsSecretReconciler) usesOperatorToken(sDef *secretv1.ValsSecret) bool {
+	if r.Identities != nil || sDef.Spec.StoreRef != nil {
+		return false
+	}
+	for _, v := range sDef.Spec.Data {
+		if r.readsVaultRef(sDef, v.Ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// readVaultRef reads a ref+vault:// reference with the secret store of the
+// ValsSecret, the operator's token or, when per-namespace identity is enabled,
+// as the ServiceAccount of the ValsSecret
+func (r *ValsSecretReconciler) readVaultRef(ctx context.Context, sDef *secretv1.ValsSecret, ref string) (string, error) {
+	var c vault.SecretsClient
+	var err error
+	if store := sDef.Spec.StoreRef; store != nil {
+		c, err = r.Stores.Client(ctx, store.Kind, store.Name, sDef.Namespace)
+	} else {
+		c, err = secretsClient(ctx, r.Identities, sDef.Namespace, sDef.Spec.ServiceAccountName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return vault.ReadRef(ctx, c, ref)
 }
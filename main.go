@@ -19,6 +19,7 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -33,13 +34,17 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
 	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
 	"digitalis.io/vals-operator/controllers"
+	"digitalis.io/vals-operator/maintenance"
 	dmetrics "digitalis.io/vals-operator/metrics"
+	"digitalis.io/vals-operator/policy"
+	"digitalis.io/vals-operator/render"
 	"digitalis.io/vals-operator/vault"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -69,15 +74,32 @@ func init() {
 		dmetrics.SecretInfo,
 		dmetrics.VaultError,
 		dmetrics.VaultTokenError,
+		dmetrics.VaultTokenTTL,
 		dmetrics.SecretRetrieveTime,
 		dmetrics.SecretCreationTime,
 		dmetrics.DbSecretRevokationError,
 		dmetrics.DbSecretDeletionError,
+		dmetrics.CertSecretFailures,
+		dmetrics.CertSecretError,
+		dmetrics.CertSecretExpireTime,
+		dmetrics.CertSecretRevokationError,
+		dmetrics.DbSecretPolicyDenied,
+		dmetrics.CertSecretPolicyDenied,
+		dmetrics.OrphanedLeases,
+		dmetrics.OrphanedLeasesRevoked,
+		dmetrics.LeaseAuditFailures,
+		dmetrics.LeaseAuditTime,
+		dmetrics.StaleConsumers,
+		dmetrics.DryRunChanges,
 	)
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		os.Exit(render.Run(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
@@ -88,6 +110,27 @@ func main() {
 	var defaultTTL time.Duration
 	var disableNamespaceSync bool
 	var allowedNamespacesForSync string
+	var enforceDbSecretPolicy bool
+	var enableWebhooks bool
+	var namespaceIdentity bool
+	var namespaceIdentityRole string
+	var namespaceIdentityMount string
+	var namespaceIdentityAudience string
+	var enableSecretStores bool
+	var backendTimeout time.Duration
+	var backend string
+	var leaseAuditInterval time.Duration
+	var leaseAuditMinAge time.Duration
+	var leaseAuditDryRun bool
+	var rolloutMaxConcurrent int
+	var rolloutWaitAvailable bool
+	var rolloutMinInterval time.Duration
+	var rolloutAvailableTimeout time.Duration
+	var maintenanceSchedule string
+	var maintenanceDuration string
+	var maintenanceTimeZone string
+	var dryRun bool
+	var hashKeySecret string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -101,6 +144,53 @@ func main() {
 		"Disable cross-namespace ref+k8s:// references. Refs targeting a different namespace than the ValsSecret are rejected.")
 	flag.StringVar(&allowedNamespacesForSync, "allowed-namespaces-for-sync", "",
 		"Comma-separated list of namespaces that may be referenced via ref+k8s://. Empty means all allowed (unless -disable-namespace-sync is set).")
+	flag.BoolVar(&enforceDbSecretPolicy, "enforce-db-secret-policy", false,
+		"Only issue DbSecret credentials and CertSecret certificates for the mounts and roles allowed to the namespace by a DbSecretPolicy.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the validating webhooks rejecting DbSecrets and CertSecrets not allowed by a DbSecretPolicy. Requires -enforce-db-secret-policy.")
+	flag.BoolVar(&namespaceIdentity, "namespace-identity", false,
+		"Log in to Vault/OpenBao with a token of the ServiceAccount of each resource instead of the operator's own identity.")
+	flag.StringVar(&namespaceIdentityRole, "namespace-identity-role", "{namespace}",
+		"Kubernetes auth role used with -namespace-identity. {namespace} and {serviceaccount} are replaced.")
+	flag.StringVar(&namespaceIdentityMount, "namespace-identity-mount", "",
+		"Kubernetes auth mount used with -namespace-identity. Defaults to VAULT_KUBERNETES_MOUNT_POINT or kubernetes.")
+	flag.StringVar(&namespaceIdentityAudience, "namespace-identity-audience", "",
+		"Audience of the ServiceAccount tokens requested with -namespace-identity. Defaults to the API server audience.")
+	flag.BoolVar(&enableSecretStores, "enable-secret-stores", false,
+		"Let ValsSecrets and DbSecrets read from the server of a SecretStore or ClusterSecretStore.")
+	flag.DurationVar(&backendTimeout, "backend-timeout", vault.DefaultRequestTimeout,
+		"How long a single call to Vault/OpenBao may take before it is cancelled. 0 disables the timeout.")
+	flag.StringVar(&backend, "backend", os.Getenv(vault.BackendEnv),
+		"Set to memory to use an in-memory secrets backend for development and tests instead of Vault/OpenBao. "+
+			"Defaults to "+vault.BackendEnv+".")
+	flag.DurationVar(&leaseAuditInterval, "lease-audit-interval", 0,
+		"How often to look for the database leases of DbSecret roles not recorded on any secret. 0 disables the audit.")
+	flag.DurationVar(&leaseAuditMinAge, "lease-audit-min-age", 10*time.Minute,
+		"Leases issued more recently are left alone by the lease audit.")
+	flag.BoolVar(&leaseAuditDryRun, "lease-audit-dry-run", true,
+		"Only report the orphaned leases found by the lease audit. Set to false to revoke them, "+
+			"which revokes every lease of the roles not recorded on a secret, whoever issued it.")
+	flag.IntVar(&rolloutMaxConcurrent, "rollout-max-concurrent", 0,
+		"How many workloads may be restarting at the same time across all secrets. 0 means unlimited.")
+	flag.BoolVar(&rolloutWaitAvailable, "rollout-wait-available", false,
+		"Wait for each restarted workload to become Available before restarting the next one.")
+	flag.DurationVar(&rolloutMinInterval, "rollout-min-interval", 0,
+		"Minimum time between two restarts of the same workload. Changes made in between are applied together.")
+	flag.DurationVar(&rolloutAvailableTimeout, "rollout-available-timeout", 10*time.Minute,
+		"How long to wait for a restarted workload to become Available before moving on.")
+	flag.StringVar(&maintenanceSchedule, "maintenance-schedule", "",
+		"Cron expression for when the maintenance window opens, such as \"0 2 * * sat\". "+
+			"Changes to secrets without maintenanceWindows of their own are held until then. Empty means changes are applied straight away.")
+	flag.StringVar(&maintenanceDuration, "maintenance-duration", "1h",
+		"How long the maintenance window stays open for.")
+	flag.StringVar(&maintenanceTimeZone, "maintenance-timezone", "UTC",
+		"Time zone of -maintenance-schedule, such as Europe/London.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Only log and record events for the changes the operator would make, with secret values redacted. "+
+			"Nothing is written to secrets, workloads, databases or Vault/OpenBao.")
+	flag.StringVar(&hashKeySecret, "hash-key-secret", "vals-operator-hash-key",
+		"Secret in the namespace of the operator holding the key of the secret hashes recorded on workloads. "+
+			"It is created with a random key when missing.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -188,8 +278,81 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	var identities *vault.IdentityPool
+	if namespaceIdentity {
+		setupLog.Info("Using the ServiceAccount of each resource to log in", "role", namespaceIdentityRole)
+		identities = vault.NewIdentityPool(vault.IdentityConfig{
+			Role:        namespaceIdentityRole,
+			Mount:       namespaceIdentityMount,
+			TokenSource: controllers.ServiceAccountTokenSource(mgr.GetClient(), namespaceIdentityAudience),
+		})
+	}
+
+	var stores *controllers.SecretStores
+	if enableSecretStores {
+		setupLog.Info("SecretStore and ClusterSecretStore resources enabled")
+		stores = controllers.NewSecretStores(mgr.GetClient())
+		if err = (&controllers.SecretStoreReconciler{
+			Stores: stores,
+			Log:    ctrl.Log.WithName("controllers").WithName("secretstore"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SecretStore")
+			os.Exit(1)
+		}
+	}
+
+	rollouts := controllers.NewRolloutQueue(mgr.GetClient(), ctrl.Log.WithName("rollouts"))
+	rollouts.MaxConcurrent = rolloutMaxConcurrent
+	rollouts.WaitForAvailable = rolloutWaitAvailable
+	rollouts.MinInterval = rolloutMinInterval
+	rollouts.AvailableTimeout = rolloutAvailableTimeout
+	rollouts.Recorder = mgr.GetEventRecorderFor("Secrets")
+	if rollouts.Reloader, err = controllers.NewPodReloader(mgr.GetConfig()); err != nil {
+		setupLog.Error(err, "unable to create the pod reloader")
+		os.Exit(1)
+	}
+	if err := mgr.Add(rollouts); err != nil {
+		setupLog.Error(err, "unable to add the rollout queue")
+		os.Exit(1)
+	}
+
+	var maintenanceWindows maintenance.Windows
+	if maintenanceSchedule != "" {
+		window, err := maintenance.NewWindow(maintenanceSchedule, maintenanceDuration, maintenanceTimeZone)
+		if err != nil {
+			setupLog.Error(err, "invalid maintenance window")
+			os.Exit(1)
+		}
+		setupLog.Info("Holding changes until the maintenance window opens", "schedule", maintenanceSchedule, "duration", maintenanceDuration, "timezone", maintenanceTimeZone)
+		maintenanceWindows = maintenance.Windows{window}
+	}
+
+	// in dry-run mode the reconcilers skip their changes and any other write
+	// they make is only validated by the API server
+	reconcilerClient := mgr.GetClient()
+	var dryRunner *controllers.DryRun
+	if dryRun {
+		setupLog.Info("Running in dry-run mode, changes are only reported")
+		reconcilerClient = client.NewDryRunClient(reconcilerClient)
+		dryRunner = controllers.NewDryRun(ctrl.Log.WithName("dry-run"))
+	}
+
+	var hashKey []byte
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		// the key is created even in dry-run mode so the hashes stay the same across restarts
+		hashKey, err = controllers.LoadHashKey(ctx, mgr.GetAPIReader(), mgr.GetClient(), namespace, hashKeySecret)
+	} else {
+		setupLog.Info("POD_NAMESPACE is not set, the secret hashes recorded on workloads are keyed with a random key that changes on every restart")
+		hashKey, err = controllers.NewHashKey()
+	}
+	if err != nil {
+		setupLog.Error(err, "unable to load the hash key")
+		os.Exit(1)
+	}
+	controllers.SetHashKey(hashKey)
+
 	if err = (&controllers.ValsSecretReconciler{
-		Client:                   mgr.GetClient(),
+		Client:                   reconcilerClient,
 		APIReader:                mgr.GetAPIReader(),
 		Ctx:                      ctx,
 		ReconciliationPeriod:     reconcilePeriod,
@@ -199,24 +362,90 @@ func main() {
 		Log:                      ctrl.Log.WithName("controllers").WithName("vals-operator"),
 		DisableNamespaceSync:     disableNamespaceSync,
 		AllowedNamespacesForSync: allowedSyncNs,
+		Identities:               identities,
+		Stores:                   stores,
+		Rollouts:                 rollouts,
+		MaintenanceWindows:       maintenanceWindows,
+		DryRun:                   dryRunner,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ValsSecret")
 		os.Exit(1)
 	}
+	var policyChecker *policy.Checker
+	if enforceDbSecretPolicy {
+		setupLog.Info("DbSecretPolicy enforcement enabled")
+		policyChecker = &policy.Checker{Reader: mgr.GetAPIReader()}
+		if enableWebhooks {
+			if err = (&policy.DbSecretValidator{Checker: policyChecker}).SetupWebhookWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "DbSecret")
+				os.Exit(1)
+			}
+			if err = (&policy.CertSecretValidator{Checker: policyChecker}).SetupWebhookWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "CertSecret")
+				os.Exit(1)
+			}
+		}
+	} else if enableWebhooks {
+		setupLog.Info("-enable-webhooks has no effect without -enforce-db-secret-policy")
+	}
+
 	if err = (&controllers.DbSecretReconciler{
 		Scheme:               scheme,
-		Client:               mgr.GetClient(),
+		Client:               reconcilerClient,
 		APIReader:            mgr.GetAPIReader(),
 		Ctx:                  ctx,
 		ReconciliationPeriod: reconcilePeriod,
 		ExcludeNamespaces:    excludeNs,
 		RecordChanges:        recordChanges,
 		DefaultTTL:           defaultTTL,
+		PolicyChecker:        policyChecker,
+		Identities:           identities,
+		Stores:               stores,
+		Rollouts:             rollouts,
+		MaintenanceWindows:   maintenanceWindows,
+		DryRun:               dryRunner,
 		Log:                  ctrl.Log.WithName("controllers").WithName("vals-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DbSecret")
 		os.Exit(1)
 	}
+	if err = (&controllers.CertSecretReconciler{
+		Scheme:               scheme,
+		Client:               reconcilerClient,
+		APIReader:            mgr.GetAPIReader(),
+		Ctx:                  ctx,
+		ReconciliationPeriod: reconcilePeriod,
+		ExcludeNamespaces:    excludeNs,
+		RecordChanges:        recordChanges,
+		PolicyChecker:        policyChecker,
+		Identities:           identities,
+		Rollouts:             rollouts,
+		MaintenanceWindows:   maintenanceWindows,
+		DryRun:               dryRunner,
+		Log:                  ctrl.Log.WithName("controllers").WithName("vals-operator"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CertSecret")
+		os.Exit(1)
+	}
+	if leaseAuditInterval > 0 {
+		// the secrets of other namespaces cannot be seen, so their leases would be revoked
+		if !leaseAuditDryRun && watchNamespaces != "" {
+			setupLog.Info("lease audit only reports orphaned leases when -watch-namespaces is set")
+			leaseAuditDryRun = true
+		}
+		if err := mgr.Add(&controllers.LeaseAuditor{
+			Client:            mgr.GetClient(),
+			Log:               ctrl.Log.WithName("lease-auditor"),
+			Interval:          leaseAuditInterval,
+			MinAge:            leaseAuditMinAge,
+			DryRun:            leaseAuditDryRun || dryRun,
+			ExcludeNamespaces: excludeNs,
+			Stores:            stores,
+		}); err != nil {
+			setupLog.Error(err, "unable to add the lease auditor")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -227,13 +456,23 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("secrets-backend", func(_ *http.Request) error { return vault.Ready() }); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
 
 	if os.Getenv("VAULT_AUTH_METHOD") != "" {
 		panic("Please remove the VAULT_AUTH_METHOD environment variable as it conflicts with `vals` backend engine")
 	}
 
+	vault.SetRequestTimeout(backendTimeout)
+
 	// Check if either Vault or OpenBao is configured
-	if os.Getenv("VAULT_ADDR") != "" || os.Getenv("BAO_ADDR") != "" {
+	if backend != "" {
+		os.Setenv(vault.BackendEnv, backend)
+	}
+	if os.Getenv("VAULT_ADDR") != "" || os.Getenv("BAO_ADDR") != "" || backend != "" {
+		vault.SetTokenRequester(controllers.OperatorTokenRequester(mgr.GetClient(), os.Getenv("POD_NAMESPACE"), os.Getenv("POD_SERVICE_ACCOUNT")))
 		if err := vault.Start(); err != nil {
 			setupLog.Error(err, "unable to authenticate with secrets backend")
 			os.Exit(1)
@@ -0,0 +1,87 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance implements the windows secret changes are held until
+package maintenance
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window opens on a cron schedule and stays open for a duration
+type Window struct {
+	schedule *Schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// NewWindow parses a window such as "0 2 * * 6" for 4h in Europe/London. The
+// time zone defaults to UTC.
+func NewWindow(schedule, duration, timeZone string) (*Window, error) {
+	s, err := ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q: %w", duration, err)
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("invalid duration %q: must be positive", duration)
+	}
+	location := time.UTC
+	if timeZone != "" {
+		if location, err = time.LoadLocation(timeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+		}
+	}
+	return &Window{schedule: s, duration: d, location: location}, nil
+}
+
+// Open reports whether the window is open at t
+func (w *Window) Open(t time.Time) bool {
+	start, ok := w.schedule.Next(t.Add(-w.duration).In(w.location))
+	return ok && !start.After(t)
+}
+
+// NextOpen returns t when the window is open, otherwise when it opens next.
+// ok is false when the schedule never matches.
+func (w *Window) NextOpen(t time.Time) (time.Time, bool) {
+	if w.Open(t) {
+		return t, true
+	}
+	return w.schedule.Next(t.In(w.location))
+}
+
+// Windows are open when any of them is
+type Windows []*Window
+
+// NextOpen returns t when changes are allowed at t, otherwise when the first
+// window opens. No windows means changes are always allowed.
+func (ws Windows) NextOpen(t time.Time) (time.Time, bool) {
+	if len(ws) == 0 {
+		return t, true
+	}
+	var next time.Time
+	for _, w := range ws {
+		at, ok := w.NextOpen(t)
+		if ok && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
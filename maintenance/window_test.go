@@ -0,0 +1,104 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2026, 3, 4, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		schedule  string
+		expected  string
+		expectErr bool
+	}{
+		{schedule: "*/15 * * * *", expected: "2026-03-04T10:45:00Z"},
+		{schedule: "0 2 * * *", expected: "2026-03-05T02:00:00Z"},
+		{schedule: "30 2 * * sat", expected: "2026-03-07T02:30:00Z"},
+		{schedule: "0 22 * * 1-5", expected: "2026-03-04T22:00:00Z"},
+		{schedule: "0 0 * * 7", expected: "2026-03-08T00:00:00Z"},
+		{schedule: "0 0 1 jan,jul *", expected: "2026-07-01T00:00:00Z"},
+		// either day field matches when both are set
+		{schedule: "0 0 15 * fri", expected: "2026-03-06T00:00:00Z"},
+		{schedule: "@monthly", expected: "2026-04-01T00:00:00Z"},
+		{schedule: "0 0 29 2 *", expected: "2028-02-29T00:00:00Z"},
+		{schedule: "0 0 30 2 *"},
+		{schedule: "0 2 * *", expectErr: true},
+		{schedule: "60 2 * * *", expectErr: true},
+		{schedule: "0 5-2 * * *", expectErr: true},
+		{schedule: "*/0 * * * *", expectErr: true},
+		{schedule: "0 0 * * someday", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			s, err := ParseSchedule(tt.schedule)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			next, ok := s.Next(from)
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("Expected no match but got %s", next)
+				}
+				return
+			}
+			if got := next.UTC().Format(time.RFC3339); got != tt.expected {
+				t.Errorf("Expected %s but got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	// Saturdays 02:00 to 06:00 in London, which is UTC+1 in summer
+	saturday, err := NewWindow("0 2 * * sat", "4h", "Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, err := NewWindow("0 12 * * *", "30m", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		windows  Windows
+		at       string
+		expected string
+	}{
+		{name: "No windows", at: "2026-06-03T10:00:00Z", expected: "2026-06-03T10:00:00Z"},
+		{name: "Before the window", windows: Windows{saturday}, at: "2026-06-03T10:00:00Z", expected: "2026-06-06T01:00:00Z"},
+		{name: "Window opening", windows: Windows{saturday}, at: "2026-06-06T01:00:00Z", expected: "2026-06-06T01:00:00Z"},
+		{name: "Inside the window", windows: Windows{saturday}, at: "2026-06-06T04:59:00Z", expected: "2026-06-06T04:59:00Z"},
+		{name: "Window closed", windows: Windows{saturday}, at: "2026-06-06T05:00:00Z", expected: "2026-06-13T01:00:00Z"},
+		{name: "First of several windows", windows: Windows{saturday, daily}, at: "2026-06-03T10:00:00Z", expected: "2026-06-03T12:00:00Z"},
+		{name: "Inside one of several windows", windows: Windows{saturday, daily}, at: "2026-06-03T12:10:00Z", expected: "2026-06-03T12:10:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			next, ok := tt.windows.NextOpen(at)
+			if !ok {
+				t.Fatalf("Expected the windows to open")
+			}
+			if got := next.UTC().Format(time.RFC3339); got != tt.expected {
+				t.Errorf("Expected %s but got %s", tt.expected, got)
+			}
+		})
+	}
+
+	for _, args := range [][3]string{{"0 2 * * *", "0s", ""}, {"0 2 * * *", "4h", "Mars/Olympus"}, {"0 2 * *", "4h", ""}} {
+		if _, err := NewWindow(args[0], args[1], args[2]); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
@@ -66,6 +66,11 @@ var (
 			Name: "vals_operator_vault_token_error",
 			Help: "Timestamp if Vault token is invalid or expired",
 		}, []string{"addr"})
+	VaultTokenTTL = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_vault_token_ttl_seconds",
+			Help: "Seconds left before the Vault token of the operator expires",
+		}, []string{"addr"})
 	SecretRetrieveTime = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "vals_operator_secret_retrieve_time",
@@ -86,4 +91,67 @@ var (
 			Name: "vals_operator_dbsecret_deletion_error",
 			Help: "Timestamp of when the secret could not be deleted",
 		}, []string{"secret", "namespace"})
+	CertSecretFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "vals_operator_certsecret_failures",
+			Help: "Number of errors issuing certificates",
+		},
+	)
+	CertSecretError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_certsecret_error",
+			Help: "Reports timestamp from when a certificate last failed to be issued",
+		}, []string{"secret", "namespace"})
+	CertSecretExpireTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_certsecret_expire_time",
+			Help: "Timestamp of when the current certificate expires",
+		}, []string{"secret", "namespace"})
+	CertSecretRevokationError = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_certsecret_revokation_error",
+			Help: "Timestamp of when the certificate could not be revoked",
+		}, []string{"secret", "namespace"})
+	DbSecretPolicyDenied = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_dbsecret_policy_denied",
+			Help: "Timestamp of when a DB secret was last denied by a DbSecretPolicy",
+		}, []string{"secret", "namespace"})
+	CertSecretPolicyDenied = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_certsecret_policy_denied",
+			Help: "Timestamp of when a CertSecret was last denied by a DbSecretPolicy",
+		}, []string{"secret", "namespace"})
+	OrphanedLeases = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_orphaned_leases",
+			Help: "Number of leases not recorded on any secret found by the last lease audit",
+		}, []string{"path"})
+	OrphanedLeasesRevoked = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "vals_operator_orphaned_leases_revoked",
+			Help: "Number of orphaned leases revoked by the lease auditor",
+		}, []string{"path"})
+	LeaseAuditFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "vals_operator_lease_audit_failures",
+			Help: "Number of errors auditing leases",
+		},
+	)
+	StaleConsumers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_stale_consumers",
+			Help: "Number of workloads with pods not running the version of the secret they were restarted for",
+		}, []string{"kind", "secret", "namespace"})
+	DryRunChanges = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "vals_operator_dry_run_changes",
+			Help: "Number of changes reported instead of made in dry-run mode",
+		}, []string{"kind", "action"})
+	LeaseAuditTime = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "vals_operator_lease_audit_time",
+			Help: "Timestamp of when the last lease audit completed",
+		},
+	)
 )
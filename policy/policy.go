@@ -0,0 +1,221 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+// ErrDenied is returned when no DbSecretPolicy allows the request
+var ErrDenied = errors.New("denied by DbSecretPolicy")
+
+// IsDenied reports whether err is a policy denial rather than a lookup failure
+func IsDenied(err error) bool {
+	return errors.Is(err, ErrDenied)
+}
+
+// Checker decides whether a DbSecret may use the database role it requests,
+// and whether a CertSecret may use the PKI role it requests
+type Checker struct {
+	Reader client.Reader
+}
+
+// Check returns an error wrapping ErrDenied when no DbSecretPolicy allows the
+// namespace of the DbSecret to use its mount and role
+func (c *Checker) Check(ctx context.Context, sDef *digitalisiov1beta1.DbSecret) error {
+	return c.check(ctx, sDef.Namespace, RequestOf(sDef), Allowed)
+}
+
+// CheckCertSecret returns an error wrapping ErrDenied when no DbSecretPolicy
+// allows the namespace of the CertSecret to issue certificates from its mount and role
+func (c *Checker) CheckCertSecret(ctx context.Context, sDef *digitalisiov1beta1.CertSecret) error {
+	return c.check(ctx, sDef.Namespace, CertRequestOf(sDef), CertificateAllowed)
+}
+
+func (c *Checker) check(ctx context.Context, namespace string, req Request,
+	allowed func([]digitalisiov1beta1.DbSecretPolicy, string, map[string]string, Request) (bool, error)) error {
+	var policies digitalisiov1beta1.DbSecretPolicyList
+	if err := c.Reader.List(ctx, &policies); err != nil {
+		return fmt.Errorf("cannot list DbSecretPolicies: %w", err)
+	}
+
+	var nsLabels map[string]string
+	for _, p := range policies.Items {
+		if p.Spec.NamespaceSelector != nil {
+			var ns corev1.Namespace
+			if err := c.Reader.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+				return fmt.Errorf("cannot get namespace %s: %w", namespace, err)
+			}
+			nsLabels = ns.Labels
+			break
+		}
+	}
+
+	ok, err := allowed(policies.Items, namespace, nsLabels, req)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: namespace %s may not use %s", ErrDenied, namespace, req)
+	}
+	return nil
+}
+
+// Request is the database role a DbSecret, or the PKI role a CertSecret, asks for
+type Request struct {
+	Mount string
+	Role  string
+	// VaultNamespace is empty for the namespace the operator is configured with
+	VaultNamespace string
+	// Store is the kind and name of the store, empty for the operator's server
+	Store string
+}
+
+// RequestOf returns the request of a DbSecret
+func RequestOf(sDef *digitalisiov1beta1.DbSecret) Request {
+	req := Request{
+		Mount:          strings.Trim(sDef.Spec.Vault.Mount, "/"),
+		Role:           sDef.Spec.Vault.Role,
+		VaultNamespace: strings.Trim(sDef.Spec.Vault.Namespace, "/"),
+	}
+	if ref := sDef.Spec.StoreRef; ref != nil {
+		kind := ref.Kind
+		if kind == "" {
+			kind = "SecretStore"
+		}
+		req.Store = kind + "/" + ref.Name
+	}
+	return req
+}
+
+// CertRequestOf returns the request of a CertSecret
+func CertRequestOf(sDef *digitalisiov1beta1.CertSecret) Request {
+	return Request{
+		Mount:          strings.Trim(sDef.Spec.Vault.Mount, "/"),
+		Role:           sDef.Spec.Vault.Role,
+		VaultNamespace: strings.Trim(sDef.Spec.Vault.Namespace, "/"),
+	}
+}
+
+func (r Request) String() string {
+	s := fmt.Sprintf("role %s on mount %s", r.Role, r.Mount)
+	if r.VaultNamespace != "" {
+		s += " in Vault namespace " + r.VaultNamespace
+	}
+	if r.Store != "" {
+		s += " through " + r.Store
+	}
+	return s
+}
+
+// Allowed reports whether any of the policies lets the namespace make the request
+func Allowed(policies []digitalisiov1beta1.DbSecretPolicy, namespace string, nsLabels map[string]string, req Request) (bool, error) {
+	return allowed(policies, namespace, nsLabels, req, func(spec digitalisiov1beta1.DbSecretPolicySpec) []digitalisiov1beta1.DbSecretPolicyRule {
+		return spec.Allow
+	})
+}
+
+// CertificateAllowed reports whether any of the policies lets the namespace
+// issue certificates as requested
+func CertificateAllowed(policies []digitalisiov1beta1.DbSecretPolicy, namespace string, nsLabels map[string]string, req Request) (bool, error) {
+	return allowed(policies, namespace, nsLabels, req, func(spec digitalisiov1beta1.DbSecretPolicySpec) []digitalisiov1beta1.DbSecretPolicyRule {
+		return spec.Certificates
+	})
+}
+
+func allowed(policies []digitalisiov1beta1.DbSecretPolicy, namespace string, nsLabels map[string]string, req Request,
+	rules func(digitalisiov1beta1.DbSecretPolicySpec) []digitalisiov1beta1.DbSecretPolicyRule) (bool, error) {
+	for _, p := range policies {
+		ok, err := appliesTo(p, namespace, nsLabels)
+		if err != nil {
+			return false, fmt.Errorf("invalid DbSecretPolicy %s: %w", p.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		for _, rule := range rules(p.Spec) {
+			ok, err := matches(rule, req)
+			if err != nil {
+				return false, fmt.Errorf("invalid DbSecretPolicy %s: %w", p.Name, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matches reports whether the rule allows the request. Empty patterns only
+// match empty values, so that rules written before a field existed do not
+// allow more than they did.
+func matches(rule digitalisiov1beta1.DbSecretPolicyRule, req Request) (bool, error) {
+	for _, m := range []struct{ pattern, value string }{
+		{strings.Trim(rule.Mount, "/"), strings.Trim(req.Mount, "/")},
+		{rule.Role, req.Role},
+		{strings.Trim(rule.VaultNamespace, "/"), strings.Trim(req.VaultNamespace, "/")},
+		{rule.Store, req.Store},
+	} {
+		ok, err := path.Match(m.pattern, m.value)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func appliesTo(p digitalisiov1beta1.DbSecretPolicy, namespace string, nsLabels map[string]string) (bool, error) {
+	return NamespaceMatches(p.Spec.Namespaces, p.Spec.NamespaceSelector, namespace, nsLabels)
+}
+
+// NamespaceMatches reports whether the namespace matches one of the patterns
+// or the selector. An empty selector matches no namespace.
+func NamespaceMatches(patterns []string, nsSelector *metav1.LabelSelector, namespace string, nsLabels map[string]string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, namespace)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	if nsSelector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(nsSelector)
+	if err != nil {
+		return false, err
+	}
+	// an empty selector would otherwise match every namespace
+	if selector.Empty() {
+		return false, nil
+	}
+	return selector.Matches(labels.Set(nsLabels)), nil
+}
@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+func TestAllowed(t *testing.T) {
+	policies := []digitalisiov1beta1.DbSecretPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: digitalisiov1beta1.DbSecretPolicySpec{
+				Namespaces: []string{"team-a", "team-a-*"},
+				Allow: []digitalisiov1beta1.DbSecretPolicyRule{
+					{Mount: "database", Role: "team-a-*"},
+					{Mount: "database", Role: "team-a-*", VaultNamespace: "team-a/*"},
+					{Mount: "database", Role: "team-a-*", Store: "SecretStore/*"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "reporting"},
+			Spec: digitalisiov1beta1.DbSecretPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"reporting": "true"}},
+				Allow: []digitalisiov1beta1.DbSecretPolicyRule{
+					{Mount: "/teams/*/", Role: "readonly"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "empty-selector"},
+			Spec: digitalisiov1beta1.DbSecretPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{},
+				Allow: []digitalisiov1beta1.DbSecretPolicyRule{
+					{Mount: "*", Role: "*"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		labels    map[string]string
+		mount     string
+		role      string
+		vaultNs   string
+		store     string
+		expected  bool
+	}{
+		{
+			name:      "Namespace and role match",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-a-rw",
+			expected:  true,
+		},
+		{
+			name:      "Namespace pattern matches",
+			namespace: "team-a-dev",
+			mount:     "/database/",
+			role:      "team-a-ro",
+			expected:  true,
+		},
+		{
+			name:      "Role of another team",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-b-rw",
+			expected:  false,
+		},
+		{
+			name:      "Namespace not covered",
+			namespace: "team-b",
+			mount:     "database",
+			role:      "team-a-rw",
+			expected:  false,
+		},
+		{
+			name:      "Vault namespace allowed",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-a-rw",
+			vaultNs:   "team-a/prod",
+			expected:  true,
+		},
+		{
+			name:      "Vault namespace not allowed",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-a-rw",
+			vaultNs:   "team-b",
+			expected:  false,
+		},
+		{
+			name:      "Rule without Vault namespace",
+			namespace: "bi",
+			labels:    map[string]string{"reporting": "true"},
+			mount:     "teams/db",
+			role:      "readonly",
+			vaultNs:   "team-b",
+			expected:  false,
+		},
+		{
+			name:      "Store allowed",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-a-rw",
+			store:     "SecretStore/team-a",
+			expected:  true,
+		},
+		{
+			name:      "Store not allowed",
+			namespace: "team-a",
+			mount:     "database",
+			role:      "team-a-rw",
+			store:     "ClusterSecretStore/shared",
+			expected:  false,
+		},
+		{
+			name:      "Namespace selected by label",
+			namespace: "bi",
+			labels:    map[string]string{"reporting": "true"},
+			mount:     "teams/db",
+			role:      "readonly",
+			expected:  true,
+		},
+		{
+			name:      "Mount pattern does not cross slashes",
+			namespace: "bi",
+			labels:    map[string]string{"reporting": "true"},
+			mount:     "teams/db/prod",
+			role:      "readonly",
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Allowed(policies, tt.namespace, tt.labels, Request{Mount: tt.mount, Role: tt.role, VaultNamespace: tt.vaultNs, Store: tt.store})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = digitalisiov1beta1.AddToScheme(scheme)
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+		&digitalisiov1beta1.DbSecretPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: digitalisiov1beta1.DbSecretPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				Allow:             []digitalisiov1beta1.DbSecretPolicyRule{{Mount: "database", Role: "team-a"}},
+			},
+		},
+	).Build()
+	v := &DbSecretValidator{Checker: &Checker{Reader: c}}
+
+	dbSecret := func(role string) *digitalisiov1beta1.DbSecret {
+		return &digitalisiov1beta1.DbSecret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "team-a"},
+			Spec: digitalisiov1beta1.DbSecretSpec{
+				Vault: digitalisiov1beta1.DbVaultConfig{Mount: "database", Role: role},
+			},
+		}
+	}
+
+	if _, err := v.ValidateCreate(context.Background(), dbSecret("team-a")); err != nil {
+		t.Errorf("Expected create to be allowed but got %v", err)
+	}
+	if _, err := v.ValidateCreate(context.Background(), dbSecret("admin")); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected create to be denied but got %v", err)
+	}
+	if _, err := v.ValidateUpdate(context.Background(), dbSecret("admin"), dbSecret("admin")); err != nil {
+		t.Errorf("Expected update without role change to be allowed but got %v", err)
+	}
+	if _, err := v.ValidateUpdate(context.Background(), dbSecret("team-a"), dbSecret("admin")); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected role change to be denied but got %v", err)
+	}
+	otherNamespace := dbSecret("team-a")
+	otherNamespace.Spec.Vault.Namespace = "team-b"
+	if _, err := v.ValidateUpdate(context.Background(), dbSecret("team-a"), otherNamespace); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected Vault namespace change to be denied but got %v", err)
+	}
+	withStore := dbSecret("team-a")
+	withStore.Spec.StoreRef = &digitalisiov1beta1.SecretStoreRef{Kind: "ClusterSecretStore", Name: "shared"}
+	if _, err := v.ValidateUpdate(context.Background(), dbSecret("team-a"), withStore); !errors.Is(err, ErrDenied) {
+		t.Errorf("Expected store change to be denied but got %v", err)
+	}
+}
+
+func TestCertificateAllowed(t *testing.T) {
+	policies := []digitalisiov1beta1.DbSecretPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: digitalisiov1beta1.DbSecretPolicySpec{
+				Namespaces:   []string{"team-a"},
+				Allow:        []digitalisiov1beta1.DbSecretPolicyRule{{Mount: "*", Role: "*"}},
+				Certificates: []digitalisiov1beta1.DbSecretPolicyRule{{Mount: "pki_int", Role: "team-a-*"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		mount     string
+		role      string
+		vaultNs   string
+		expected  bool
+	}{
+		{
+			name:      "Certificate rule matches",
+			namespace: "team-a",
+			mount:     "pki_int",
+			role:      "team-a-web",
+			expected:  true,
+		},
+		{
+			name:      "Database rules do not apply to certificates",
+			namespace: "team-a",
+			mount:     "pki",
+			role:      "admin",
+			expected:  false,
+		},
+		{
+			name:      "Other Vault namespace is denied",
+			namespace: "team-a",
+			mount:     "pki_int",
+			role:      "team-a-web",
+			vaultNs:   "team-b",
+			expected:  false,
+		},
+		{
+			name:      "Other namespace is denied",
+			namespace: "team-b",
+			mount:     "pki_int",
+			role:      "team-a-web",
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CertificateAllowed(policies, tt.namespace, nil, Request{Mount: tt.mount, Role: tt.role, VaultNamespace: tt.vaultNs})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	digitalisiov1beta1 "digitalis.io/vals-operator/apis/digitalis.io/v1beta1"
+)
+
+//+kubebuilder:webhook:path=/validate-digitalis-io-v1beta1-dbsecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=digitalis.io,resources=dbsecrets,verbs=create;update,versions=v1beta1,name=vdbsecret.digitalis.io,admissionReviewVersions=v1
+
+// DbSecretValidator rejects DbSecrets requesting a role their namespace is not allowed to use
+type DbSecretValidator struct {
+	Checker *Checker
+}
+
+var _ admission.Validator[*digitalisiov1beta1.DbSecret] = &DbSecretValidator{}
+
+// SetupWebhookWithManager registers the validating webhook
+func (v *DbSecretValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &digitalisiov1beta1.DbSecret{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate checks the policies for new DbSecrets
+func (v *DbSecretValidator) ValidateCreate(ctx context.Context, obj *digitalisiov1beta1.DbSecret) (admission.Warnings, error) {
+	return nil, v.Checker.Check(ctx, obj)
+}
+
+// ValidateUpdate checks the policies when the mount, role, Vault namespace or
+// store changes. Other updates, such as removing the finalizer, are always allowed
+func (v *DbSecretValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *digitalisiov1beta1.DbSecret) (admission.Warnings, error) {
+	if RequestOf(oldObj) == RequestOf(newObj) || !newObj.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return nil, v.Checker.Check(ctx, newObj)
+}
+
+// ValidateDelete always allows deletion
+func (v *DbSecretValidator) ValidateDelete(ctx context.Context, obj *digitalisiov1beta1.DbSecret) (admission.Warnings, error) {
+	return nil, nil
+}
+
+//+kubebuilder:webhook:path=/validate-digitalis-io-v1beta1-certsecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=digitalis.io,resources=certsecrets,verbs=create;update,versions=v1beta1,name=vcertsecret.digitalis.io,admissionReviewVersions=v1
+
+// CertSecretValidator rejects CertSecrets requesting a PKI role their namespace is not allowed to use
+type CertSecretValidator struct {
+	Checker *Checker
+}
+
+var _ admission.Validator[*digitalisiov1beta1.CertSecret] = &CertSecretValidator{}
+
+// SetupWebhookWithManager registers the validating webhook
+func (v *CertSecretValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &digitalisiov1beta1.CertSecret{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate checks the policies for new CertSecrets
+func (v *CertSecretValidator) ValidateCreate(ctx context.Context, obj *digitalisiov1beta1.CertSecret) (admission.Warnings, error) {
+	return nil, v.Checker.CheckCertSecret(ctx, obj)
+}
+
+// ValidateUpdate checks the policies when the mount, role or Vault namespace
+// changes. Other updates, such as removing the finalizer, are always allowed
+func (v *CertSecretValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *digitalisiov1beta1.CertSecret) (admission.Warnings, error) {
+	if CertRequestOf(oldObj) == CertRequestOf(newObj) || !newObj.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return nil, v.Checker.CheckCertSecret(ctx, newObj)
+}
+
+// ValidateDelete always allows deletion
+func (v *CertSecretValidator) ValidateDelete(ctx context.Context, obj *digitalisiov1beta1.CertSecret) (admission.Warnings, error) {
+	return nil, nil
+}
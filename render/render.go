@@ -0,0 +1,233 @@
+/*
+Copyright 2026 Digitalis.IO.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render implements the render command, which builds the secrets of
+// ValsSecret manifests locally to debug them without applying them
+package render
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	secretv1 "digitalis.io/vals-operator/apis/digitalis.io/v1"
+	"digitalis.io/vals-operator/controllers"
+)
+
+// Run renders the ValsSecrets of the manifest given with -f and prints their
+// secrets to stdout. It returns the exit code of the command.
+func Run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var file, secretsFile, kubeconfig string
+	var showValues bool
+	fs.StringVar(&file, "f", "", "File with the ValsSecret manifests to render, - for stdin. Secrets in it can be read with ref+k8s.")
+	fs.BoolVar(&showValues, "show-values", false, "Print the values of the secrets instead of masking them.")
+	fs.StringVar(&secretsFile, "secrets", "", "File with Secret manifests ref+k8s references are read from before the cluster.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Kubeconfig of the cluster ref+k8s references are read from. Defaults to KUBECONFIG or ~/.kube/config.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: vals-operator render -f valssecret.yaml [-show-values] [-secrets secrets.yaml] [-kubeconfig path]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if file == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	valsSecrets, local, err := readManifests(file)
+	if err == nil && secretsFile != "" {
+		var more localSecrets
+		_, more, err = readManifests(secretsFile)
+		for k, v := range more {
+			local[k] = v
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(valsSecrets) == 0 {
+		fmt.Fprintf(stderr, "Error: no ValsSecret found in %s\n", file)
+		return 1
+	}
+
+	reader := &secretReader{local: local, kubeconfig: kubeconfig}
+	code := 0
+	for i, sDef := range valsSecrets {
+		secret, templateErrs, err := controllers.RenderValsSecret(context.Background(), sDef, reader)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: ValsSecret %s: %v\n", sDef.Name, err)
+			code = 1
+			continue
+		}
+		for _, err := range templateErrs {
+			fmt.Fprintf(stderr, "Error: ValsSecret %s: template could not be rendered: %v\n", sDef.Name, err)
+			code = 1
+		}
+		out, err := yaml.Marshal(printable(secret, showValues))
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: ValsSecret %s: %v\n", sDef.Name, err)
+			code = 1
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(stdout, "---")
+		}
+		fmt.Fprint(stdout, string(out))
+	}
+	return code
+}
+
+// printable returns the secret as printed. Values are masked unless shown, in
+// which case they are printed as stringData when they are text.
+func printable(secret *corev1.Secret, showValues bool) *corev1.Secret {
+	out := secret.DeepCopy()
+	out.Data = nil
+	for k, v := range secret.Data {
+		if showValues && !utf8.Valid(v) {
+			if out.Data == nil {
+				out.Data = make(map[string][]byte)
+			}
+			out.Data[k] = v
+			continue
+		}
+		if out.StringData == nil {
+			out.StringData = make(map[string]string)
+		}
+		if showValues {
+			out.StringData[k] = string(v)
+		} else {
+			out.StringData[k] = fmt.Sprintf("<masked, %d bytes>", len(v))
+		}
+	}
+	return out
+}
+
+// readManifests returns the ValsSecrets and Secrets of a multi-document YAML
+// or JSON file. Other kinds are ignored.
+func readManifests(file string) ([]*secretv1.ValsSecret, localSecrets, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var valsSecrets []*secretv1.ValsSecret
+	secrets := make(localSecrets)
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var obj unstructured.Unstructured
+		err := decoder.Decode(&obj.Object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot read %s: %w", file, err)
+		}
+		if obj.Object == nil {
+			continue
+		}
+		gvk := obj.GroupVersionKind()
+		switch {
+		case gvk.Group == secretv1.GroupVersion.Group && gvk.Kind == "ValsSecret":
+			sDef := &secretv1.ValsSecret{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, sDef); err != nil {
+				return nil, nil, fmt.Errorf("invalid ValsSecret %s: %w", obj.GetName(), err)
+			}
+			if sDef.Namespace == "" {
+				sDef.Namespace = "default"
+			}
+			valsSecrets = append(valsSecrets, sDef)
+		case gvk.Group == "" && gvk.Kind == "Secret":
+			secret := &corev1.Secret{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, secret); err != nil {
+				return nil, nil, fmt.Errorf("invalid Secret %s: %w", obj.GetName(), err)
+			}
+			if secret.Namespace == "" {
+				secret.Namespace = "default"
+			}
+			// stringData is only merged into data by the API server
+			for k, v := range secret.StringData {
+				if secret.Data == nil {
+					secret.Data = make(map[string][]byte)
+				}
+				secret.Data[k] = []byte(v)
+			}
+			secrets[client.ObjectKeyFromObject(secret)] = secret
+		}
+	}
+	return valsSecrets, secrets, nil
+}
+
+// localSecrets are the secrets read from files
+type localSecrets map[client.ObjectKey]*corev1.Secret
+
+// secretReader reads the secrets of ref+k8s references from the files, then
+// from the cluster, which is only connected to when needed
+type secretReader struct {
+	local      localSecrets
+	kubeconfig string
+	cluster    client.Reader
+}
+
+// Get reads a secret
+func (s *secretReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return fmt.Errorf("only secrets can be read, not %T", obj)
+	}
+	if found, ok := s.local[key]; ok {
+		found.DeepCopyInto(secret)
+		return nil
+	}
+	if s.cluster == nil {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = s.kubeconfig
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("%w and no cluster to read it from: %v", apierrors.NewNotFound(corev1.Resource("secrets"), key.Name), err)
+		}
+		if s.cluster, err = client.New(config, client.Options{}); err != nil {
+			return err
+		}
+	}
+	return s.cluster.Get(ctx, key, obj, opts...)
+}
+
+// List is not needed to render secrets
+func (s *secretReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return fmt.Errorf("listing is not supported")
+}
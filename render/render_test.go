@@ -0,0 +1,80 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const manifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: other
+stringData:
+  password: hunter2
+---
+apiVersion: digitalis.io/v1
+kind: ValsSecret
+metadata:
+  name: app
+spec:
+  data:
+    user:
+      ref: admin
+    password:
+      ref: ref+k8s://other/db#password
+  template:
+    dsn: "postgres://{{ .user }}:{{ .password }}@db"
+`
+
+func TestRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valssecret.yaml")
+	if err := os.WriteFile(file, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		expected []string
+		hidden   []string
+	}{
+		{
+			name:     "Masked",
+			args:     []string{"-f", file},
+			expected: []string{"name: app", "namespace: default", "password: <masked, 7 bytes>"},
+			hidden:   []string{"hunter2", "admin"},
+		},
+		{
+			name:     "Show values",
+			args:     []string{"-f", file, "-show-values"},
+			expected: []string{"password: hunter2", "dsn: postgres://admin:hunter2@db"},
+		},
+		{name: "No file", args: []string{}, code: 2},
+		{name: "Missing file", args: []string{"-f", filepath.Join(t.TempDir(), "missing.yaml")}, code: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := Run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("Expected exit code %d but got %d: %s", tt.code, code, stderr.String())
+			}
+			out := stdout.String()
+			for _, s := range tt.expected {
+				if !strings.Contains(out, s) {
+					t.Errorf("Expected %q in the output but got %s", s, out)
+				}
+			}
+			for _, s := range tt.hidden {
+				if strings.Contains(out, s) {
+					t.Errorf("Expected %q not to be printed but got %s", s, out)
+				}
+			}
+		})
+	}
+}
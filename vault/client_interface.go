@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"sync"
 )
 
 // BackendType represents the secrets management backend in use
@@ -11,6 +12,8 @@ const (
 	BackendUnknown BackendType = iota
 	BackendVault
 	BackendOpenBao
+	// BackendMemory keeps everything in memory, for development and tests
+	BackendMemory
 )
 
 func (b BackendType) String() string {
@@ -19,28 +22,52 @@ func (b BackendType) String() string {
 		return "vault"
 	case BackendOpenBao:
 		return "openbao"
+	case BackendMemory:
+		return "memory"
 	default:
 		return "unknown"
 	}
 }
 
+// ParseBackend returns the backend named vault or openbao
+func ParseBackend(name string) BackendType {
+	switch name {
+	case "vault":
+		return BackendVault
+	case "openbao":
+		return BackendOpenBao
+	default:
+		return BackendUnknown
+	}
+}
+
 // SecretsClient is the unified interface for both Vault and OpenBao clients
 type SecretsClient interface {
 	// Authentication
 	Login(ctx context.Context) (*SecretResponse, error)
+	LoginKubernetes(ctx context.Context, role, mount, jwt string) (*SecretResponse, error)
 	SetToken(token string)
 
 	// Token Lifecycle
 	NewLifetimeWatcher(input *LifetimeWatcherInput) (LifetimeWatcher, error)
 
 	// Logical API
-	Read(path string) (*SecretResponse, error)
-	Write(path string, data map[string]interface{}) (*SecretResponse, error)
+	// Every call is bounded by the request timeout, see SetRequestTimeout
+	Read(ctx context.Context, path string) (*SecretResponse, error)
+	// ReadWithData sends data as the query parameters of the read
+	ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error)
+	Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error)
+	List(ctx context.Context, path string) (*SecretResponse, error)
 
 	// System API
-	Renew(leaseID string, increment int) (*SecretResponse, error)
-	Revoke(leaseID string) error
-	Lookup(leaseID string) (*SecretResponse, error)
+	Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error)
+	Revoke(ctx context.Context, leaseID string) error
+	Lookup(ctx context.Context, leaseID string) (*SecretResponse, error)
+
+	// Namespaces
+	// WithNamespace returns a client sending requests to the given namespace
+	// with the X-Vault-Namespace header. An empty namespace keeps the default.
+	WithNamespace(namespace string) SecretsClient
 
 	// Metadata
 	Backend() BackendType
@@ -58,8 +85,9 @@ type SecretResponse struct {
 
 // AuthInfo contains authentication information
 type AuthInfo struct {
-	ClientToken string
-	Renewable   bool
+	ClientToken   string
+	Renewable     bool
+	LeaseDuration int
 }
 
 // LifetimeWatcherInput contains parameters for token renewal
@@ -75,6 +103,49 @@ type LifetimeWatcher interface {
 	RenewCh() <-chan *RenewalInfo
 }
 
+// renewalForwarder converts the renewals of an SDK lifetime watcher. The
+// converted channel is created once, as every receive from a new one would
+// leave a goroutine behind taking renewals away from the caller.
+type renewalForwarder struct {
+	once    sync.Once
+	renewCh chan *RenewalInfo
+	stopCh  chan struct{}
+}
+
+func newRenewalForwarder() renewalForwarder {
+	return renewalForwarder{stopCh: make(chan struct{})}
+}
+
+// forward returns the converted channel, reading from in until stop is called
+func forward[T any](f *renewalForwarder, in <-chan T, convert func(T) *RenewalInfo) <-chan *RenewalInfo {
+	f.once.Do(func() {
+		f.renewCh = make(chan *RenewalInfo)
+		go func() {
+			for {
+				select {
+				case <-f.stopCh:
+					return
+				case renewal, ok := <-in:
+					if !ok {
+						close(f.renewCh)
+						return
+					}
+					select {
+					case f.renewCh <- convert(renewal):
+					case <-f.stopCh:
+						return
+					}
+				}
+			}
+		}()
+	})
+	return f.renewCh
+}
+
+func (f *renewalForwarder) stop() {
+	close(f.stopCh)
+}
+
 // RenewalInfo contains information about a successful renewal
 type RenewalInfo struct {
 	Secret *SecretResponse
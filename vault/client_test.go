@@ -1,8 +1,22 @@
 package vault
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestBackendDetection(t *testing.T) {
@@ -198,6 +212,32 @@ func TestAuthModeDetection(t *testing.T) {
 			},
 			expectedMode: AuthModeToken,
 		},
+		{
+			name:   "JWT auth detected for Vault",
+			prefix: "VAULT",
+			envVars: map[string]string{
+				"VAULT_JWT_ROLE": "vals-operator",
+			},
+			expectedMode: AuthModeJWT,
+		},
+		{
+			name:   "Cert auth detected for OpenBao",
+			prefix: "BAO",
+			envVars: map[string]string{
+				"BAO_CERT_ROLE": "vals-operator",
+			},
+			expectedMode: AuthModeCert,
+		},
+		{
+			name:   "AppRole takes precedence over JWT",
+			prefix: "BAO",
+			envVars: map[string]string{
+				"BAO_APP_ROLE":  "my-app-role",
+				"BAO_SECRET_ID": "secret-id",
+				"BAO_JWT_ROLE":  "vals-operator",
+			},
+			expectedMode: AuthModeAppRole,
+		},
 		{
 			name:         "Default to Kubernetes when nothing set",
 			prefix:       "VAULT",
@@ -225,6 +265,8 @@ func TestAuthModeDetection(t *testing.T) {
 				"BAO_SECRET_ID", "VAULT_SECRET_ID",
 				"BAO_LOGIN_USER", "VAULT_LOGIN_USER",
 				"BAO_LOGIN_PASSWORD", "VAULT_LOGIN_PASSWORD",
+				"BAO_JWT_ROLE", "VAULT_JWT_ROLE",
+				"BAO_CERT_ROLE", "VAULT_CERT_ROLE",
 			}
 			for _, key := range envKeys {
 				os.Unsetenv(key)
@@ -266,3 +308,335 @@ func TestBackendTypeString(t *testing.T) {
 		})
 	}
 }
+
+func TestJWTLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		mount   string
+		newFunc func() (SecretsClient, error)
+	}{
+		{name: "Vault with default mount", prefix: "VAULT", newFunc: NewVaultClient},
+		{name: "OpenBao with custom mount", prefix: "BAO", mount: "oidc/cluster", newFunc: NewOpenBaoClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectedPath := "/v1/auth/jwt/login"
+			if tt.mount != "" {
+				expectedPath = "/v1/auth/" + tt.mount + "/login"
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if r.URL.Path != expectedPath || body["role"] != "vals-operator" || body["jwt"] != "projected-token" {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"errors":["permission denied"]}`)
+					return
+				}
+				fmt.Fprint(w, `{"auth":{"client_token":"jwt-token","lease_duration":3600,"renewable":true}}`)
+			}))
+			defer server.Close()
+
+			jwtFile := filepath.Join(t.TempDir(), "token")
+			if err := os.WriteFile(jwtFile, []byte("projected-token\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"TOKEN", "APP_ROLE", "SECRET_ID", "LOGIN_USER", "LOGIN_PASSWORD"} {
+				t.Setenv("VAULT_"+key, "")
+				t.Setenv("BAO_"+key, "")
+			}
+			t.Setenv(tt.prefix+"_ADDR", server.URL)
+			t.Setenv(tt.prefix+"_JWT_ROLE", "vals-operator")
+			t.Setenv(tt.prefix+"_JWT_PATH", jwtFile)
+			t.Setenv(tt.prefix+"_JWT_MOUNT_PATH", tt.mount)
+
+			c, err := tt.newFunc()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp, err := c.Login(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.Auth.ClientToken != "jwt-token" || resp.Auth.LeaseDuration != 3600 {
+				t.Errorf("Expected token jwt-token valid for 3600s but got %s valid for %ds", resp.Auth.ClientToken, resp.Auth.LeaseDuration)
+			}
+		})
+	}
+}
+
+func TestJWTLoginMissingFile(t *testing.T) {
+	t.Setenv("VAULT_JWT_ROLE", "vals-operator")
+	t.Setenv("VAULT_JWT_PATH", filepath.Join(t.TempDir(), "missing"))
+
+	if _, _, err := jwtLogin("VAULT"); err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
+
+// writeClientCert creates a self-signed client certificate and returns the
+// paths to the certificate and key
+func writeClientCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertLogin(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if r.URL.Path != "/v1/auth/cert/login" || body["name"] != "vals-operator" || len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		fmt.Fprint(w, `{"auth":{"client_token":"cert-token","lease_duration":600,"renewable":true}}`)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writeClientCert(t)
+
+	tests := []struct {
+		name       string
+		prefix     string
+		serverName string
+		newFunc    func() (SecretsClient, error)
+		wantErr    bool
+	}{
+		{name: "Vault", prefix: "VAULT", serverName: "example.com", newFunc: NewVaultClient},
+		{name: "OpenBao", prefix: "BAO", serverName: "example.com", newFunc: NewOpenBaoClient},
+		{name: "Wrong server name", prefix: "VAULT", serverName: "vault.example.org", newFunc: NewVaultClient, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"ADDR", "TOKEN", "APP_ROLE", "SECRET_ID", "LOGIN_USER", "LOGIN_PASSWORD", "JWT_ROLE", "SKIP_VERIFY"} {
+				t.Setenv("VAULT_"+key, "")
+				t.Setenv("BAO_"+key, "")
+			}
+			t.Setenv(tt.prefix+"_ADDR", server.URL)
+			t.Setenv(tt.prefix+"_CACERT", caFile)
+			t.Setenv(tt.prefix+"_CLIENT_CERT", certFile)
+			t.Setenv(tt.prefix+"_CLIENT_KEY", keyFile)
+			t.Setenv(tt.prefix+"_TLS_SERVER_NAME", tt.serverName)
+			t.Setenv(tt.prefix+"_CERT_ROLE", "vals-operator")
+
+			c, err := tt.newFunc()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp, err := c.Login(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.Auth.ClientToken != "cert-token" {
+				t.Errorf("Expected cert-token but got %s", resp.Auth.ClientToken)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeClientCert(t)
+	caDir := t.TempDir()
+	caPem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(caDir, "ca.pem"), caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		envVars map[string]string
+		wantErr bool
+	}{
+		{name: "Defaults", envVars: map[string]string{}},
+		{name: "CA directory", envVars: map[string]string{"VAULT_CAPATH": caDir}},
+		{name: "Client certificate", envVars: map[string]string{"VAULT_CLIENT_CERT": certFile, "VAULT_CLIENT_KEY": keyFile}},
+		{name: "Client certificate without key", envVars: map[string]string{"VAULT_CLIENT_CERT": certFile}, wantErr: true},
+		{name: "Missing CA file", envVars: map[string]string{"VAULT_CACERT": filepath.Join(caDir, "missing.pem")}, wantErr: true},
+		{name: "CA file without certificates", envVars: map[string]string{"VAULT_CACERT": keyFile}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"CACERT", "CAPATH", "CLIENT_CERT", "CLIENT_KEY", "TLS_SERVER_NAME", "SKIP_VERIFY"} {
+				t.Setenv("VAULT_"+key, "")
+				t.Setenv("BAO_"+key, "")
+			}
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := tlsConfig("VAULT")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, ok := tt.envVars["VAULT_CAPATH"]; ok && cfg.RootCAs == nil {
+				t.Error("Expected the CA directory to be loaded")
+			}
+			if _, ok := tt.envVars["VAULT_CLIENT_CERT"]; ok && len(cfg.Certificates) != 1 {
+				t.Errorf("Expected 1 client certificate but got %d", len(cfg.Certificates))
+			}
+		})
+	}
+}
+
+func TestNamespaceHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		prefix     string
+		operatorNs string
+		namespace  string
+		expected   string
+		newFunc    func() (SecretsClient, error)
+	}{
+		{name: "No namespace", prefix: "VAULT", newFunc: NewVaultClient},
+		{name: "Operator default", prefix: "VAULT", operatorNs: "bu1", expected: "bu1", newFunc: NewVaultClient},
+		{name: "Resource namespace", prefix: "BAO", operatorNs: "bu1", namespace: "bu2/team-a", expected: "bu2/team-a", newFunc: NewOpenBaoClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, r.Header.Get("X-Vault-Namespace"))
+				fmt.Fprint(w, `{"data":{"password":"secret"}}`)
+			}))
+			defer server.Close()
+
+			for _, key := range []string{"ADDR", "TOKEN", "NAMESPACE"} {
+				t.Setenv("VAULT_"+key, "")
+				t.Setenv("BAO_"+key, "")
+			}
+			t.Setenv(tt.prefix+"_ADDR", server.URL)
+			t.Setenv(tt.prefix+"_TOKEN", "token")
+			t.Setenv(tt.prefix+"_NAMESPACE", tt.operatorNs)
+
+			c, err := tt.newFunc()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			nc := c.WithNamespace(tt.namespace)
+			if _, err := nc.Read(context.Background(), "secret/app"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := nc.Renew(context.Background(), "database/creds/app/abc", 60); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// the original client keeps its namespace
+			if _, err := c.Read(context.Background(), "secret/app"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expected := []string{tt.expected, tt.expected, tt.operatorNs}
+			for i := range expected {
+				if got[i] != expected[i] {
+					t.Errorf("Expected namespace %q on request %d but got %q", expected[i], i, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend BackendType
+		timeout time.Duration
+		cancel  bool
+	}{
+		{name: "Vault request timeout", backend: BackendVault, timeout: 100 * time.Millisecond},
+		{name: "OpenBao request timeout", backend: BackendOpenBao, timeout: 100 * time.Millisecond},
+		{name: "Cancelled context", backend: BackendVault, cancel: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			defer server.Close()
+			defer close(release)
+
+			SetRequestTimeout(tt.timeout)
+			t.Cleanup(func() { SetRequestTimeout(DefaultRequestTimeout) })
+
+			c, err := NewClient(ClientConfig{Backend: tt.backend, Address: server.URL})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(100*time.Millisecond, cancel)
+			}
+
+			start := time.Now()
+			if _, err := c.Read(ctx, "secret/app"); err == nil {
+				t.Errorf("Expected an error")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected the call to give up quickly but it took %v", elapsed)
+			}
+		})
+	}
+}
@@ -1,8 +1,15 @@
 package vault
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -16,8 +23,37 @@ const (
 	AuthModeAppRole
 	AuthModeUserPass
 	AuthModeToken
+	AuthModeJWT
+	AuthModeCert
 )
 
+// defaultJWTPath is the ServiceAccount token of the operator, which may be
+// replaced with a projected token for the audience expected by the JWT auth method
+const defaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// DefaultRequestTimeout bounds every call to Vault/OpenBao unless changed with SetRequestTimeout
+const DefaultRequestTimeout = 30 * time.Second
+
+var requestTimeout atomic.Int64
+
+func init() {
+	requestTimeout.Store(int64(DefaultRequestTimeout))
+}
+
+// SetRequestTimeout sets how long a single call to Vault/OpenBao may take,
+// including logins. 0 leaves calls bounded by their context only
+func SetRequestTimeout(d time.Duration) {
+	requestTimeout.Store(int64(d))
+}
+
+// withTimeout bounds a call to the backend by the request timeout
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := time.Duration(requestTimeout.Load()); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
 // getEnvWithPrefix gets environment variable with backend-specific prefix
 // Falls back to the other backend's variable if not found
 func getEnvWithPrefix(prefix, key, fallback string) string {
@@ -65,10 +101,45 @@ func detectAuthMode(prefix string) AuthMode {
 		return AuthModeAppRole
 	}
 
+	// Check for JWT/OIDC
+	if getEnvWithPrefix(prefix, "JWT_ROLE", "") != "" {
+		return AuthModeJWT
+	}
+
+	// Check for TLS certificate
+	if getEnvWithPrefix(prefix, "CERT_ROLE", "") != "" {
+		return AuthModeCert
+	}
+
 	// Default to Kubernetes
 	return AuthModeKubernetes
 }
 
+// ClientConfig describes a connection to a Vault or OpenBao server
+type ClientConfig struct {
+	Backend BackendType
+	Address string
+	// Namespace is the Vault Enterprise / OpenBao namespace
+	Namespace string
+	TLS       *tls.Config
+}
+
+// NewClient creates an unauthenticated client from the given configuration
+// instead of the environment
+func NewClient(cfg ClientConfig) (SecretsClient, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("address is not set")
+	}
+	switch cfg.Backend {
+	case BackendOpenBao:
+		return newOpenBaoClient(cfg)
+	case BackendVault:
+		return newVaultClient(cfg)
+	default:
+		return nil, fmt.Errorf("unknown backend type: %v", cfg.Backend)
+	}
+}
+
 // NewSecretsClient creates the appropriate client based on environment configuration
 func NewSecretsClient() (SecretsClient, error) {
 	backend, err := detectBackend()
@@ -82,12 +153,22 @@ func NewSecretsClient() (SecretsClient, error) {
 		return NewOpenBaoClient()
 	case BackendVault:
 		return NewVaultClient()
+	case BackendMemory:
+		return NewMemoryClient()
 	default:
 		return nil, fmt.Errorf("unknown backend type: %v", backend)
 	}
 }
 
 func detectBackend() (BackendType, error) {
+	switch name := os.Getenv(BackendEnv); name {
+	case "":
+	case "memory":
+		return BackendMemory, nil
+	default:
+		return BackendUnknown, fmt.Errorf("unknown %s %q", BackendEnv, name)
+	}
+
 	baoAddr := os.Getenv("BAO_ADDR")
 	vaultAddr := os.Getenv("VAULT_ADDR")
 
@@ -109,3 +190,96 @@ func detectBackend() (BackendType, error) {
 
 	return BackendUnknown, fmt.Errorf("no secrets backend configured: set either BAO_ADDR or VAULT_ADDR")
 }
+
+// jwtLogin returns the login path and request of the JWT auth method. The
+// token file is read on every login as projected tokens are rotated.
+func jwtLogin(prefix string) (string, map[string]interface{}, error) {
+	role := getEnvWithPrefix(prefix, "JWT_ROLE", "")
+	if role == "" {
+		return "", nil, fmt.Errorf("%s_JWT_ROLE is not defined", prefix)
+	}
+	jwtPath := getEnvWithPrefix(prefix, "JWT_PATH", defaultJWTPath)
+	jwt, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read JWT from %s: %w", jwtPath, err)
+	}
+	mount := strings.Trim(getEnvWithPrefix(prefix, "JWT_MOUNT_PATH", jwtMountPath), "/")
+
+	return fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+		"role": role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}, nil
+}
+
+// certLogin returns the login path and request of the TLS certificate auth
+// method. The certificate itself is presented by the HTTP transport.
+func certLogin(prefix string) (string, map[string]interface{}, error) {
+	if getEnvWithPrefix(prefix, "CLIENT_CERT", "") == "" || getEnvWithPrefix(prefix, "CLIENT_KEY", "") == "" {
+		return "", nil, fmt.Errorf("%s_CLIENT_CERT and %s_CLIENT_KEY are required for cert authentication", prefix, prefix)
+	}
+	mount := strings.Trim(getEnvWithPrefix(prefix, "CERT_MOUNT_PATH", certMountPath), "/")
+
+	return fmt.Sprintf("auth/%s/login", mount), map[string]interface{}{
+		"name": getEnvWithPrefix(prefix, "CERT_ROLE", ""),
+	}, nil
+}
+
+// tlsConfig builds the TLS settings of the client from the CACERT, CAPATH,
+// CLIENT_CERT, CLIENT_KEY, TLS_SERVER_NAME and SKIP_VERIFY variables
+func tlsConfig(prefix string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: getEnvWithPrefix(prefix, "SKIP_VERIFY", "false") == "true",
+		ServerName:         getEnvWithPrefix(prefix, "TLS_SERVER_NAME", ""),
+	}
+
+	caFile := getEnvWithPrefix(prefix, "CACERT", "")
+	caPath := getEnvWithPrefix(prefix, "CAPATH", "")
+	if caFile != "" || caPath != "" {
+		pool := x509.NewCertPool()
+		if caFile != "" {
+			if err := appendCAFile(pool, caFile); err != nil {
+				return nil, err
+			}
+		} else {
+			entries, err := os.ReadDir(caPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s_CAPATH: %w", prefix, err)
+			}
+			for _, e := range entries {
+				if e.IsDir() {
+					continue
+				}
+				if err := appendCAFile(pool, filepath.Join(caPath, e.Name())); err != nil {
+					return nil, err
+				}
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	certFile := getEnvWithPrefix(prefix, "CLIENT_CERT", "")
+	keyFile := getEnvWithPrefix(prefix, "CLIENT_KEY", "")
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both %s_CLIENT_CERT and %s_CLIENT_KEY must be set", prefix, prefix)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func appendCAFile(pool *x509.CertPool, file string) error {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read CA certificate: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no CA certificates found in %s", file)
+	}
+	return nil
+}
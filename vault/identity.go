@@ -0,0 +1,95 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TokenSource returns a ServiceAccount token for the given namespace and ServiceAccount
+type TokenSource func(ctx context.Context, namespace, serviceAccount string) (string, error)
+
+// IdentityConfig configures logging in with the ServiceAccount of the tenant
+// instead of the operator's own identity
+type IdentityConfig struct {
+	// Role is the Kubernetes auth role. {namespace} and {serviceaccount} are
+	// replaced with the namespace and ServiceAccount of the resource
+	Role string
+	// Mount is where the Kubernetes auth method is mounted
+	Mount string
+	// TokenSource issues the ServiceAccount tokens used to log in
+	TokenSource TokenSource
+	// NewClient creates the unauthenticated clients, such as those of a
+	// MemoryBackend. Defaults to NewSecretsClient
+	NewClient func() (SecretsClient, error)
+	// IdleTimeout is how long a client is kept without being used, so that
+	// the clients of deleted namespaces and ServiceAccounts are dropped.
+	// Defaults to 30 minutes
+	IdleTimeout time.Duration
+}
+
+// clients of the identity pool are dropped after this long without use
+const identityIdleTimeout = 30 * time.Minute
+
+// IdentityPool caches a logged in client per namespace and ServiceAccount.
+// Clients are dropped when they are idle or fail to log in
+type IdentityPool struct {
+	cfg  IdentityConfig
+	pool *ClientPool
+}
+
+// NewIdentityPool creates a pool of per-namespace clients
+func NewIdentityPool(cfg IdentityConfig) *IdentityPool {
+	if cfg.Mount == "" {
+		cfg.Mount = getEnvWithPrefix("VAULT", "KUBERNETES_MOUNT_POINT", kubernetesMountPath)
+	}
+	if cfg.Role == "" {
+		cfg.Role = "{namespace}"
+	}
+	if cfg.NewClient == nil {
+		cfg.NewClient = NewSecretsClient
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = identityIdleTimeout
+	}
+	pool := NewClientPool()
+	pool.idle = cfg.IdleTimeout
+	return &IdentityPool{
+		cfg:  cfg,
+		pool: pool,
+	}
+}
+
+// Client returns a client logged in as the ServiceAccount of the namespace
+func (p *IdentityPool) Client(ctx context.Context, namespace, serviceAccount string) (SecretsClient, error) {
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	key := namespace + "/" + serviceAccount
+
+	return p.pool.Client(ctx, key, "", func(ctx context.Context) (SecretsClient, *SecretResponse, error) {
+		jwt, err := p.cfg.TokenSource(ctx, namespace, serviceAccount)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot get token for service account %s: %w", key, err)
+		}
+
+		c, err := p.cfg.NewClient()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.SetToken("")
+		resp, err := c.LoginKubernetes(ctx, p.role(namespace, serviceAccount), p.cfg.Mount, jwt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot login as service account %s: %w", key, err)
+		}
+		return c, resp, nil
+	})
+}
+
+func (p *IdentityPool) role(namespace, serviceAccount string) string {
+	return strings.NewReplacer(
+		"{namespace}", namespace,
+		"{serviceaccount}", serviceAccount,
+	).Replace(p.cfg.Role)
+}
@@ -0,0 +1,209 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient serves reads from a map and counts logins
+type fakeClient struct {
+	data   map[string]map[string]interface{}
+	token  string
+	logins []string
+	ttl    int
+	// watcher is returned by NewLifetimeWatcher when set
+	watcher LifetimeWatcher
+
+	mu            sync.Mutex
+	loginFailures int
+	namespace     string
+}
+
+func (f *fakeClient) Login(ctx context.Context) (*SecretResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.loginFailures > 0 {
+		f.loginFailures--
+		return nil, fmt.Errorf("login failed")
+	}
+	f.logins = append(f.logins, "operator")
+	return &SecretResponse{Auth: &AuthInfo{ClientToken: "operator-token", LeaseDuration: f.ttl}}, nil
+}
+
+func (f *fakeClient) LoginKubernetes(ctx context.Context, role, mount, jwt string) (*SecretResponse, error) {
+	f.logins = append(f.logins, fmt.Sprintf("%s/%s/%s", mount, role, jwt))
+	return &SecretResponse{Auth: &AuthInfo{ClientToken: "token-" + role, LeaseDuration: f.ttl}}, nil
+}
+
+func (f *fakeClient) SetToken(token string) { f.token = token }
+
+func (f *fakeClient) NewLifetimeWatcher(input *LifetimeWatcherInput) (LifetimeWatcher, error) {
+	if f.watcher != nil {
+		return f.watcher, nil
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) Read(ctx context.Context, path string) (*SecretResponse, error) {
+	if f.namespace != "" {
+		path = f.namespace + "/" + path
+	}
+	d, ok := f.data[path]
+	if !ok {
+		return nil, nil
+	}
+	return &SecretResponse{Data: d}, nil
+}
+
+func (f *fakeClient) ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error) {
+	if len(data) > 0 {
+		path += "?" + url.Values(data).Encode()
+	}
+	return f.Read(ctx, path)
+}
+
+func (f *fakeClient) Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) List(ctx context.Context, path string) (*SecretResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) Revoke(ctx context.Context, leaseID string) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) Lookup(ctx context.Context, leaseID string) (*SecretResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (f *fakeClient) WithNamespace(namespace string) SecretsClient {
+	if namespace == "" {
+		return f
+	}
+	return &fakeClient{data: f.data, token: f.token, ttl: f.ttl, namespace: namespace}
+}
+
+func (f *fakeClient) Backend() BackendType { return BackendVault }
+
+func (f *fakeClient) Address() string { return "http://fake:8200" }
+
+func TestIdentityPool(t *testing.T) {
+	var created []*fakeClient
+	var tokenRequests int
+
+	pool := NewIdentityPool(IdentityConfig{
+		Role: "{namespace}-{serviceaccount}",
+		TokenSource: func(ctx context.Context, namespace, serviceAccount string) (string, error) {
+			tokenRequests++
+			return "jwt-" + namespace, nil
+		},
+		NewClient: func() (SecretsClient, error) {
+			c := &fakeClient{ttl: 3600}
+			created = append(created, c)
+			return c, nil
+		},
+	})
+
+	c1, err := pool.Client(context.Background(), "team-a", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c2, err := pool.Client(context.Background(), "team-a", "default")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c1 != c2 {
+		t.Error("Expected the cached client to be reused")
+	}
+	if _, err := pool.Client(context.Background(), "team-b", "app"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(created) != 2 || tokenRequests != 2 {
+		t.Fatalf("Expected 2 logins but got %d clients and %d token requests", len(created), tokenRequests)
+	}
+	if created[0].logins[0] != "kubernetes/team-a-default/jwt-team-a" {
+		t.Errorf("Expected login kubernetes/team-a-default/jwt-team-a but got %s", created[0].logins[0])
+	}
+	if created[1].token != "token-team-b-app" {
+		t.Errorf("Expected token token-team-b-app but got %s", created[1].token)
+	}
+}
+
+func TestIdentityPoolRelogin(t *testing.T) {
+	logins := 0
+	pool := NewIdentityPool(IdentityConfig{
+		TokenSource: func(ctx context.Context, namespace, serviceAccount string) (string, error) {
+			return "jwt", nil
+		},
+		NewClient: func() (SecretsClient, error) {
+			logins++
+			// shorter than the refresh margin
+			return &fakeClient{ttl: 30}, nil
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := pool.Client(context.Background(), "team-a", ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("Expected 2 logins but got %d", logins)
+	}
+}
+
+func TestIdentityPoolEviction(t *testing.T) {
+	logins := 0
+	fail := false
+	pool := NewIdentityPool(IdentityConfig{
+		TokenSource: func(ctx context.Context, namespace, serviceAccount string) (string, error) {
+			if fail {
+				return "", fmt.Errorf("serviceaccounts %q not found", serviceAccount)
+			}
+			return "jwt", nil
+		},
+		NewClient: func() (SecretsClient, error) {
+			logins++
+			return &fakeClient{ttl: 3600}, nil
+		},
+	})
+	ctx := context.Background()
+
+	for _, ns := range []string{"team-a", "team-b"} {
+		if _, err := pool.Client(ctx, ns, ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// team-a was not used within the idle timeout
+	pool.pool.clients["team-a/default"].used = time.Now().Add(-2 * identityIdleTimeout)
+	if _, err := pool.Client(ctx, "team-b", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := pool.pool.clients["team-a/default"]; ok {
+		t.Error("Expected the idle client to be dropped")
+	}
+	if logins != 2 {
+		t.Errorf("Expected the used client to be kept but got %d logins", logins)
+	}
+
+	// the ServiceAccount was deleted
+	fail = true
+	if _, err := pool.Client(ctx, "team-c", ""); err == nil {
+		t.Fatal("Expected the login to fail")
+	}
+	if _, ok := pool.pool.clients["team-c/default"]; ok {
+		t.Error("Expected the failed client to be dropped")
+	}
+}
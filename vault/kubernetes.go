@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// defaultKubernetesTokenExpiration is how long minted tokens are valid for,
+// the minimum accepted by the TokenRequest API
+const defaultKubernetesTokenExpiration = "600"
+
+// TokenRequester issues a token of the operator's own ServiceAccount for the
+// given audience with the TokenRequest API
+type TokenRequester func(ctx context.Context, audience string, expiration int64) (string, error)
+
+var tokenRequester TokenRequester
+
+// SetTokenRequester sets how the operator mints its own tokens when
+// KUBERNETES_TOKEN_AUDIENCE is set
+func SetTokenRequester(r TokenRequester) {
+	tokenRequester = r
+}
+
+// kubernetesToken returns a freshly minted token for the Kubernetes auth
+// method when an audience is configured. An empty token means the file given
+// by KUBERNETES_TOKEN_PATH, or the default ServiceAccount token, is used.
+func kubernetesToken(ctx context.Context, prefix string) (string, error) {
+	audience := getEnvWithPrefix(prefix, "KUBERNETES_TOKEN_AUDIENCE", "")
+	if audience == "" {
+		return "", nil
+	}
+	if tokenRequester == nil {
+		return "", fmt.Errorf("%s_KUBERNETES_TOKEN_AUDIENCE is set but tokens cannot be requested", prefix)
+	}
+
+	expiration, err := strconv.ParseInt(getEnvWithPrefix(prefix, "KUBERNETES_TOKEN_EXPIRATION", defaultKubernetesTokenExpiration), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s_KUBERNETES_TOKEN_EXPIRATION: %w", prefix, err)
+	}
+	token, err := tokenRequester(ctx, audience, expiration)
+	if err != nil {
+		return "", fmt.Errorf("unable to request a ServiceAccount token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKubernetesLoginTokenSource(t *testing.T) {
+	var requests int
+	defer SetTokenRequester(nil)
+	SetTokenRequester(func(ctx context.Context, audience string, expiration int64) (string, error) {
+		requests++
+		return fmt.Sprintf("%s-%d-%d", audience, expiration, requests), nil
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		file     string
+		expected []string
+	}{
+		{
+			name:     "Token file is read on every login",
+			envVars:  map[string]string{"VAULT_KUBERNETES_TOKEN_PATH": tokenFile},
+			file:     "file-token",
+			expected: []string{"file-token", "file-token-rotated"},
+		},
+		{
+			name:     "Token requested on every login",
+			envVars:  map[string]string{"VAULT_KUBERNETES_TOKEN_AUDIENCE": "vault", "VAULT_KUBERNETES_TOKEN_EXPIRATION": "900"},
+			expected: []string{"vault-900-1", "vault-900-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var jwts []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				jwts = append(jwts, body["jwt"])
+				fmt.Fprint(w, `{"auth":{"client_token":"kube-token","lease_duration":600,"renewable":true}}`)
+			}))
+			defer server.Close()
+
+			for _, key := range []string{"TOKEN", "APP_ROLE", "SECRET_ID", "LOGIN_USER", "LOGIN_PASSWORD", "JWT_ROLE", "CERT_ROLE",
+				"KUBERNETES_TOKEN_PATH", "KUBERNETES_TOKEN_AUDIENCE", "KUBERNETES_TOKEN_EXPIRATION"} {
+				t.Setenv("VAULT_"+key, "")
+				t.Setenv("BAO_"+key, "")
+			}
+			t.Setenv("VAULT_ADDR", server.URL)
+			t.Setenv("VAULT_ROLE_ID", "vals-operator")
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+			requests = 0
+
+			c, err := NewVaultClient()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for i := range tt.expected {
+				if tt.file != "" {
+					content := tt.file
+					if i > 0 {
+						content += "-rotated"
+					}
+					if err := os.WriteFile(tokenFile, []byte(content), 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := c.Login(context.Background()); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			if len(jwts) != len(tt.expected) {
+				t.Fatalf("Expected %d logins but got %d", len(tt.expected), len(jwts))
+			}
+			for i := range tt.expected {
+				if jwts[i] != tt.expected[i] {
+					t.Errorf("Expected %s but got %s", tt.expected[i], jwts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKubernetesTokenWithoutRequester(t *testing.T) {
+	t.Setenv("VAULT_KUBERNETES_TOKEN_AUDIENCE", "vault")
+
+	if _, err := kubernetesToken(context.Background(), "VAULT"); err == nil {
+		t.Error("Expected error but got nil")
+	}
+}
@@ -0,0 +1,225 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var refPrefixes = []string{"ref+vault://", "ref+openbao://"}
+
+// IsVaultRef reports whether the vals reference reads from Vault or OpenBao
+func IsVaultRef(ref string) bool {
+	for _, prefix := range refPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRefParams are the parameters handled by ReadRef
+var readRefParams = map[string]bool{"namespace": true, "version": true}
+
+// refParams returns the query parameters of the reference
+func refParams(ref string) (url.Values, error) {
+	if i := strings.Index(ref, "#"); i >= 0 {
+		ref = ref[:i]
+	}
+	i := strings.Index(ref, "?")
+	if i < 0 {
+		return nil, nil
+	}
+	return url.ParseQuery(ref[i+1:])
+}
+
+// RefHasParams reports whether the reference carries vals parameters such as
+// its own address or auth method. The namespace and version parameters are
+// handled by ReadRef.
+func RefHasParams(ref string) bool {
+	params, err := refParams(ref)
+	if err != nil {
+		return true
+	}
+	for k := range params {
+		if !readRefParams[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// valsEnv lists, for each reference prefix, the environment variables and
+// token file vals falls back to when the reference has no credentials
+var valsEnv = map[string]struct{ token, tokenFile, authMethod, homeFile string }{
+	"ref+vault://":   {"VAULT_TOKEN", "VAULT_TOKEN_FILE", "VAULT_AUTH_METHOD", ".vault-token"},
+	"ref+openbao://": {"BAO_TOKEN", "BAO_TOKEN_FILE", "BAO_AUTH_METHOD", ".bao-token"},
+}
+
+// envCredentials reports whether vals finds credentials for the reference in
+// the environment of the operator, as the operator itself never exports them
+func envCredentials(ref string) bool {
+	for prefix, env := range valsEnv {
+		if !strings.HasPrefix(ref, prefix) {
+			continue
+		}
+		if os.Getenv(env.token) != "" || os.Getenv(env.tokenFile) != "" {
+			return true
+		}
+		if method := os.Getenv(env.authMethod); method != "" && method != "token" {
+			return true
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			if _, err := os.Stat(filepath.Join(home, env.homeFile)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckValsRef returns an error for a reference vals cannot read: one without
+// credentials of its own when the environment has none either. The operator
+// does not export its token, but a token set on the pod, such as VAULT_TOKEN,
+// is still used by vals.
+func CheckValsRef(ref string) error {
+	if !IsVaultRef(ref) {
+		return nil
+	}
+	params, err := refParams(ref)
+	if err != nil {
+		return fmt.Errorf("invalid parameters in vault reference: %w", err)
+	}
+	if env := params.Get("token_env"); env != "" {
+		if os.Getenv(env) == "" {
+			return fmt.Errorf("%s reads the token from %s, which is not set", ref, env)
+		}
+		return nil
+	}
+	if params.Get("token_file") != "" {
+		return nil
+	}
+	if method := params.Get("auth_method"); method != "" && method != "token" {
+		return nil
+	}
+	if envCredentials(ref) {
+		return nil
+	}
+	return fmt.Errorf("%s is read by vals, which finds no token in the environment: set auth_method, token_env or token_file, or only use the namespace and version parameters", ref)
+}
+
+// ReadRef resolves a ref+vault:// or ref+openbao:// reference with the given
+// client instead of the token vals would read from the environment. As with
+// vals, ref+vault://kv/app#/password reads the password key from kv/app and
+// ref+vault://kv/app/password reads the same key. KV version 2 mounts are
+// detected automatically, ?namespace= reads from another Vault namespace and
+// ?version= reads an older version of a KV version 2 secret.
+func ReadRef(ctx context.Context, c SecretsClient, ref string) (string, error) {
+	var p string
+	for _, prefix := range refPrefixes {
+		if strings.HasPrefix(ref, prefix) {
+			p = strings.TrimPrefix(ref, prefix)
+		}
+	}
+	if p == "" {
+		return "", fmt.Errorf("not a vault reference: %s", ref)
+	}
+
+	var fragment, version string
+	if i := strings.Index(p, "#"); i >= 0 {
+		p, fragment = p[:i], p[i+1:]
+	}
+	if i := strings.Index(p, "?"); i >= 0 {
+		params, err := url.ParseQuery(p[i+1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid parameters in vault reference: %w", err)
+		}
+		for k := range params {
+			if !readRefParams[k] {
+				return "", fmt.Errorf("parameter %q is not supported when reading with the operator's client", k)
+			}
+		}
+		c = c.WithNamespace(params.Get("namespace"))
+		version = params.Get("version")
+		p = p[:i]
+	}
+	p = strings.Trim(p, "/")
+
+	var keys []string
+	if fragment != "" {
+		keys = strings.Split(strings.Trim(fragment, "/"), "/")
+	} else {
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return "", fmt.Errorf("missing key in vault reference: %s", ref)
+		}
+		p, keys = p[:i], []string{p[i+1:]}
+	}
+
+	data, err := readKV(ctx, c, p, version)
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{} = data
+	for _, k := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %q does not exist in %q", strings.Join(keys, "/"), p)
+		}
+		value, ok = m[k]
+		if !ok {
+			return "", fmt.Errorf("key %q does not exist in %q", strings.Join(keys, "/"), p)
+		}
+	}
+	if _, ok := value.(map[string]interface{}); ok {
+		return "", fmt.Errorf("key %q in %q is not a string", strings.Join(keys, "/"), p)
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// readKV reads a secret from a KV mount of either version. version selects a
+// version of a KV version 2 secret, the latest when empty.
+func readKV(ctx context.Context, c SecretsClient, p, version string) (map[string]interface{}, error) {
+	readPath := p
+	v2 := false
+
+	mount, err := c.Read(ctx, "sys/internal/ui/mounts/"+p)
+	if err != nil {
+		return nil, err
+	}
+	if mount != nil && mount.Data != nil {
+		if options, ok := mount.Data["options"].(map[string]interface{}); ok && options["version"] == "2" {
+			mountPath, _ := mount.Data["path"].(string)
+			mountPath = strings.Trim(mountPath, "/")
+			v2 = true
+			readPath = mountPath + "/data/" + strings.TrimPrefix(strings.TrimPrefix(p, mountPath), "/")
+		}
+	}
+
+	var query map[string][]string
+	if version != "" {
+		if !v2 {
+			return nil, fmt.Errorf("version of %q requested but it is not in a KV version 2 mount", p)
+		}
+		query = map[string][]string{"version": {version}}
+	}
+	s, err := c.ReadWithData(ctx, readPath, query)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.Data == nil {
+		return nil, fmt.Errorf("no secret found for path %q", readPath)
+	}
+	if v2 {
+		data, ok := s.Data["data"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no secret found for path %q", readPath)
+		}
+		return data, nil
+	}
+	return s.Data, nil
+}
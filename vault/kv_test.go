@@ -0,0 +1,155 @@
+package vault
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadRef(t *testing.T) {
+	c := &fakeClient{
+		data: map[string]map[string]interface{}{
+			"sys/internal/ui/mounts/kv2/app": {
+				"path":    "kv2/",
+				"options": map[string]interface{}{"version": "2"},
+			},
+			"kv2/data/app": {
+				"data": map[string]interface{}{
+					"password": "v2-secret",
+					"nested":   map[string]interface{}{"key": "nested-value"},
+				},
+				"metadata": map[string]interface{}{"version": 3},
+			},
+			"kv2/data/app?version=2": {
+				"data":     map[string]interface{}{"password": "v2-old-secret"},
+				"metadata": map[string]interface{}{"version": 2},
+			},
+			"sys/internal/ui/mounts/secret/app": {
+				"path":    "secret/",
+				"options": map[string]interface{}{"version": "1"},
+			},
+			"secret/app": {
+				"password": "v1-secret",
+			},
+			"team-a/sys/internal/ui/mounts/secret/app": {
+				"path":    "secret/",
+				"options": map[string]interface{}{"version": "1"},
+			},
+			"team-a/secret/app": {
+				"password": "team-a-secret",
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+		wantErr  bool
+	}{
+		{name: "KV v2 with fragment", ref: "ref+vault://kv2/app#/password", expected: "v2-secret"},
+		{name: "KV v2 nested fragment", ref: "ref+vault://kv2/app#/nested/key", expected: "nested-value"},
+		{name: "KV v2 key in path", ref: "ref+openbao://kv2/app/password", expected: "v2-secret"},
+		{name: "KV v1", ref: "ref+vault://secret/app#/password", expected: "v1-secret"},
+		{name: "Missing key", ref: "ref+vault://secret/app#/username", wantErr: true},
+		{name: "Map is not a string", ref: "ref+vault://kv2/app#/nested", wantErr: true},
+		{name: "Namespace parameter", ref: "ref+vault://secret/app?namespace=team-a#/password", expected: "team-a-secret"},
+		{name: "KV v2 version parameter", ref: "ref+vault://kv2/app?version=2#/password", expected: "v2-old-secret"},
+		{name: "Version of KV v1", ref: "ref+vault://secret/app?version=2#/password", wantErr: true},
+		{name: "Parameters not supported", ref: "ref+vault://kv2/app?address=http://other#/password", wantErr: true},
+		{name: "Missing secret", ref: "ref+vault://secret/missing#/password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ReadRef(context.Background(), c, tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got %s", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %s but got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRefHasParams(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected bool
+	}{
+		{ref: "ref+vault://kv/app#/password", expected: false},
+		{ref: "ref+vault://kv/app?address=http://other:8200#/password", expected: true},
+		{ref: "ref+vault://kv/app#/pass?word", expected: false},
+		{ref: "ref+vault://kv/app?namespace=team-a#/password", expected: false},
+		{ref: "ref+vault://kv/app?namespace=team-a&version=2#/password", expected: false},
+		{ref: "ref+vault://kv/app?version=2&auth_method=approle#/password", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if result := RefHasParams(tt.ref); result != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCheckValsRef(t *testing.T) {
+	home := t.TempDir()
+	tests := []struct {
+		name    string
+		ref     string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "other provider", ref: "ref+awssecrets://app#/password", wantErr: false},
+		{name: "no token", ref: "ref+vault://kv/app?address=http://other:8200#/password", wantErr: true},
+		{name: "token auth without token", ref: "ref+vault://kv/app?auth_method=token#/password", wantErr: true},
+		{name: "token file", ref: "ref+vault://kv/app?address=http://other:8200&token_file=/var/run/token#/password", wantErr: false},
+		{name: "token env", ref: "ref+openbao://kv/app?token_env=OTHER_TOKEN#/password", env: map[string]string{"OTHER_TOKEN": "s.other"}, wantErr: false},
+		{name: "token env not set", ref: "ref+openbao://kv/app?token_env=OTHER_TOKEN#/password", wantErr: true},
+		{name: "approle", ref: "ref+vault://kv/app?auth_method=approle&role_id=app#/password", wantErr: false},
+		{name: "pod token", ref: "ref+vault://kv/app?address=http://other:8200#/password", env: map[string]string{"VAULT_TOKEN": "s.pod"}, wantErr: false},
+		{name: "pod token file", ref: "ref+vault://kv/app?address=http://other:8200#/password", env: map[string]string{"VAULT_TOKEN_FILE": "/var/run/token"}, wantErr: false},
+		{name: "pod auth method", ref: "ref+openbao://kv/app?address=http://other:8200#/password", env: map[string]string{"BAO_AUTH_METHOD": "kubernetes"}, wantErr: false},
+		{name: "token of the other backend", ref: "ref+openbao://kv/app?address=http://other:8200#/password", env: map[string]string{"VAULT_TOKEN": "s.pod"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			for _, k := range []string{"VAULT_TOKEN", "VAULT_TOKEN_FILE", "VAULT_AUTH_METHOD", "BAO_TOKEN", "BAO_TOKEN_FILE", "BAO_AUTH_METHOD", "OTHER_TOKEN"} {
+				t.Setenv(k, tt.env[k])
+			}
+			if err := CheckValsRef(tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckValsRefHomeToken(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	t.Setenv("VAULT_AUTH_METHOD", "")
+	ref := "ref+vault://kv/app?address=http://other:8200#/password"
+	if err := CheckValsRef(ref); err == nil {
+		t.Errorf("Expected an error without ~/.vault-token")
+	}
+	if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte("s.home"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckValsRef(ref); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
@@ -0,0 +1,457 @@
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// BackendEnv selects the in-memory backend when set to memory
+	BackendEnv = "VALS_OPERATOR_BACKEND"
+	// MemorySeedEnv names a YAML or JSON file with the paths and data the
+	// in-memory backend starts with
+	MemorySeedEnv = "VALS_OPERATOR_MEMORY_SEED"
+
+	memoryDefaultTTL    = time.Hour
+	memoryDefaultMaxTTL = 24 * time.Hour
+)
+
+var credsPath = regexp.MustCompile(`^(.+)/creds/([^/]+)$`)
+
+// MemoryBackend is an in-memory stand-in for Vault/OpenBao meant for local
+// development and tests. Writes store data at a path and reads return it.
+// Reading <mount>/creds/<role> issues database credentials with a lease, whose
+// TTL and max TTL are the default_ttl and max_ttl seconds stored at
+// <mount>/roles/<role> (one and 24 hours if not set).
+type MemoryBackend struct {
+	mu       sync.Mutex
+	data     map[string]map[string]interface{}
+	leases   map[string]*memoryLease
+	failures []memoryFailure
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type memoryLease struct {
+	ttl        time.Duration
+	issued     time.Time
+	expires    time.Time
+	maxExpires time.Time
+}
+
+type memoryFailure struct {
+	op    string
+	count int
+	err   error
+}
+
+// NewMemoryBackend creates an empty backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		data:   make(map[string]map[string]interface{}),
+		leases: make(map[string]*memoryLease),
+		now:    time.Now,
+	}
+}
+
+var (
+	sharedMemoryOnce sync.Once
+	sharedMemory     *MemoryBackend
+	sharedMemoryErr  error
+)
+
+// SharedMemoryBackend returns the backend used by the clients created from the
+// environment, seeded from VALS_OPERATOR_MEMORY_SEED
+func SharedMemoryBackend() (*MemoryBackend, error) {
+	sharedMemoryOnce.Do(func() {
+		sharedMemory = NewMemoryBackend()
+		if seed := os.Getenv(MemorySeedEnv); seed != "" {
+			sharedMemoryErr = sharedMemory.LoadFile(seed)
+		}
+	})
+	return sharedMemory, sharedMemoryErr
+}
+
+// LoadFile writes every path of a YAML or JSON file mapping paths to their data
+func (b *MemoryBackend) LoadFile(file string) error {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", file, err)
+	}
+	var seed map[string]map[string]interface{}
+	if err := yaml.Unmarshal(raw, &seed); err != nil {
+		return fmt.Errorf("unable to parse %s: %w", file, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for p, data := range seed {
+		b.data[strings.Trim(p, "/")] = data
+	}
+	return nil
+}
+
+// Fail makes the next count calls of an operation fail with err. The
+// operation is one of login, read, write, list, renew, revoke or lookup, or empty
+// for any of them. A negative count fails every call until Reset.
+func (b *MemoryBackend) Fail(op string, count int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = append(b.failures, memoryFailure{op: op, count: count, err: err})
+}
+
+// Reset removes the injected failures
+func (b *MemoryBackend) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = nil
+}
+
+// Leases returns the IDs, prefixed with their namespace, of the leases that
+// have not expired or been revoked
+func (b *MemoryBackend) Leases() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ids []string
+	for id := range b.leases {
+		if b.lease(id) != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Client returns a client of the backend
+func (b *MemoryBackend) Client() SecretsClient {
+	return &MemoryClient{backend: b}
+}
+
+// injected returns the error to fail the operation with. Callers hold the lock
+func (b *MemoryBackend) injected(op string) error {
+	for i := range b.failures {
+		f := &b.failures[i]
+		if f.count == 0 || (f.op != "" && f.op != op) {
+			continue
+		}
+		if f.count > 0 {
+			f.count--
+		}
+		return f.err
+	}
+	return nil
+}
+
+// lease returns an active lease, dropping it once expired. Callers hold the lock
+func (b *MemoryBackend) lease(id string) *memoryLease {
+	l, ok := b.leases[id]
+	if !ok {
+		return nil
+	}
+	if !b.now().Before(l.expires) {
+		delete(b.leases, id)
+		return nil
+	}
+	return l
+}
+
+// issueCreds creates database credentials for the role. key is the path
+// prefixed with the namespace. Callers hold the lock
+func (b *MemoryBackend) issueCreds(key, path, mount, role string) *SecretResponse {
+	ttl, maxTTL := memoryDefaultTTL, memoryDefaultMaxTTL
+	if cfg, ok := b.data[mount+"/roles/"+role]; ok {
+		if d, ok := seconds(cfg["default_ttl"]); ok {
+			ttl = d
+		}
+		if d, ok := seconds(cfg["max_ttl"]); ok {
+			maxTTL = d
+		}
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	id := randomID()
+	now := b.now()
+	leaseID := strings.Trim(path, "/") + "/" + id
+	b.leases[key+"/"+id] = &memoryLease{
+		ttl:        ttl,
+		issued:     now,
+		expires:    now.Add(ttl),
+		maxExpires: now.Add(maxTTL),
+	}
+	return &SecretResponse{
+		LeaseID:       leaseID,
+		LeaseDuration: int(ttl.Seconds()),
+		Renewable:     true,
+		Data: map[string]interface{}{
+			"username": fmt.Sprintf("v-%s-%s", role, id[:8]),
+			"password": randomID(),
+		},
+	}
+}
+
+// seconds reads a TTL given in seconds or as a duration such as 1h
+func seconds(v interface{}) (time.Duration, bool) {
+	switch t := v.(type) {
+	case int:
+		return time.Duration(t) * time.Second, true
+	case int64:
+		return time.Duration(t) * time.Second, true
+	case float64:
+		return time.Duration(t) * time.Second, true
+	case json.Number:
+		n, err := t.Int64()
+		return time.Duration(n) * time.Second, err == nil
+	case string:
+		d, err := time.ParseDuration(t)
+		return d, err == nil
+	}
+	return 0, false
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryClient is a SecretsClient backed by a MemoryBackend. Namespaces are
+// kept apart by prefixing every path and lease with the namespace.
+type MemoryClient struct {
+	backend   *MemoryBackend
+	namespace string
+	token     string
+}
+
+// NewMemoryClient returns a client of the backend shared by the operator
+func NewMemoryClient() (SecretsClient, error) {
+	b, err := SharedMemoryBackend()
+	if err != nil {
+		return nil, err
+	}
+	return b.Client(), nil
+}
+
+func (m *MemoryClient) key(path string) string {
+	return strings.Trim(strings.Trim(m.namespace, "/")+"/"+strings.Trim(path, "/"), "/")
+}
+
+func (m *MemoryClient) login() (*SecretResponse, error) {
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("login"); err != nil {
+		return nil, err
+	}
+	return &SecretResponse{Auth: &AuthInfo{ClientToken: "memory-" + randomID()}}, nil
+}
+
+func (m *MemoryClient) Login(ctx context.Context) (*SecretResponse, error) {
+	return m.login()
+}
+
+func (m *MemoryClient) LoginKubernetes(ctx context.Context, role, mount, jwt string) (*SecretResponse, error) {
+	return m.login()
+}
+
+func (m *MemoryClient) SetToken(token string) {
+	m.token = token
+}
+
+func (m *MemoryClient) NewLifetimeWatcher(input *LifetimeWatcherInput) (LifetimeWatcher, error) {
+	return nil, fmt.Errorf("the memory backend issues tokens that do not expire")
+}
+
+func (m *MemoryClient) Read(ctx context.Context, path string) (*SecretResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("read"); err != nil {
+		return nil, err
+	}
+
+	key := m.key(path)
+	if data, ok := m.backend.data[key]; ok {
+		return &SecretResponse{Data: copyData(data)}, nil
+	}
+	if match := credsPath.FindStringSubmatch(key); match != nil {
+		return m.backend.issueCreds(key, path, match[1], match[2]), nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryClient) ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error) {
+	if len(data) > 0 {
+		return nil, fmt.Errorf("query parameters are not supported by the memory backend")
+	}
+	return m.Read(ctx, path)
+}
+
+func (m *MemoryClient) Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("write"); err != nil {
+		return nil, err
+	}
+	m.backend.data[m.key(path)] = copyData(data)
+	return nil, nil
+}
+
+// List returns the keys under a path, or the leases under a prefix when the
+// path starts with sys/leases/lookup/. Keys with children end with a slash.
+func (m *MemoryClient) List(ctx context.Context, path string) (*SecretResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("list"); err != nil {
+		return nil, err
+	}
+
+	var stored []string
+	if p, ok := strings.CutPrefix(strings.Trim(path, "/"), "sys/leases/lookup/"); ok {
+		path = p
+		for id := range m.backend.leases {
+			if m.backend.lease(id) != nil {
+				stored = append(stored, id)
+			}
+		}
+	} else {
+		for k := range m.backend.data {
+			stored = append(stored, k)
+		}
+	}
+
+	prefix := m.key(path) + "/"
+	seen := make(map[string]bool)
+	var keys []interface{}
+	for _, k := range stored {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i+1]
+		}
+		if !seen[rest] {
+			seen[rest] = true
+			keys = append(keys, rest)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+	return &SecretResponse{Data: map[string]interface{}{"keys": keys}}, nil
+}
+
+func (m *MemoryClient) Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("renew"); err != nil {
+		return nil, err
+	}
+
+	key := m.key(leaseID)
+	l := m.backend.lease(key)
+	if l == nil {
+		return nil, fmt.Errorf("lease not found or lease is not renewable")
+	}
+	ttl := l.ttl
+	if increment > 0 {
+		ttl = time.Duration(increment) * time.Second
+	}
+	now := m.backend.now()
+	if left := l.maxExpires.Sub(now); ttl > left {
+		ttl = left
+	}
+	l.expires = now.Add(ttl)
+	return &SecretResponse{
+		LeaseID:       leaseID,
+		LeaseDuration: int(ttl.Seconds()),
+		Renewable:     true,
+	}, nil
+}
+
+func (m *MemoryClient) Revoke(ctx context.Context, leaseID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("revoke"); err != nil {
+		return err
+	}
+	delete(m.backend.leases, m.key(leaseID))
+	return nil
+}
+
+func (m *MemoryClient) Lookup(ctx context.Context, leaseID string) (*SecretResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.backend.mu.Lock()
+	defer m.backend.mu.Unlock()
+	if err := m.backend.injected("lookup"); err != nil {
+		return nil, err
+	}
+
+	l := m.backend.lease(m.key(leaseID))
+	if l == nil {
+		return nil, fmt.Errorf("invalid lease")
+	}
+	return &SecretResponse{
+		Data: map[string]interface{}{
+			"id":          leaseID,
+			"issue_time":  l.issued.Format(time.RFC3339Nano),
+			"expire_time": l.expires.Format(time.RFC3339Nano),
+			"ttl":         int(l.expires.Sub(m.backend.now()).Seconds()),
+			"renewable":   true,
+		},
+	}, nil
+}
+
+// WithNamespace returns a client for the given namespace
+func (m *MemoryClient) WithNamespace(namespace string) SecretsClient {
+	if namespace == "" {
+		return m
+	}
+	c := *m
+	c.namespace = namespace
+	return &c
+}
+
+func (m *MemoryClient) Backend() BackendType {
+	return BackendMemory
+}
+
+func (m *MemoryClient) Address() string {
+	return "memory"
+}
+
+// copyData copies the top level of the data so callers cannot change what is stored
+func copyData(data map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,216 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryDbCredentials(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	c := b.Client()
+
+	if _, err := c.Write(ctx, "database/roles/app", map[string]interface{}{"default_ttl": 60, "max_ttl": "5m"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	creds, err := GetDbCredentials(ctx, c, "app", "database")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.Username == "" || creds.Password == "" || creds.LeaseDuration != 60 {
+		t.Errorf("Expected credentials valid for 60s but got %+v", creds)
+	}
+	if !IsLeaseValid(ctx, c, creds.LeaseId) {
+		t.Errorf("Expected lease %s to be valid", creds.LeaseId)
+	}
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		increment int
+		expected  int
+		expectErr bool
+	}{
+		{name: "Renew with the role TTL", advance: 30 * time.Second, expected: 60},
+		{name: "Renew with an increment", advance: 30 * time.Second, increment: 120, expected: 120},
+		{name: "Renew capped at the max TTL", advance: 90 * time.Second, increment: 300, expected: 150},
+		{name: "Expired lease", advance: 3 * time.Minute, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			resp, err := c.Renew(ctx, creds.LeaseId, tt.increment)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp.LeaseDuration != tt.expected {
+				t.Errorf("Expected %d but got %d", tt.expected, resp.LeaseDuration)
+			}
+		})
+	}
+	if IsLeaseValid(ctx, c, creds.LeaseId) {
+		t.Errorf("Expected lease %s to have expired", creds.LeaseId)
+	}
+
+	creds, err = GetDbCredentials(ctx, c, "app", "database")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := RevokeDbCredentials(ctx, c, creds.LeaseId); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if IsLeaseValid(ctx, c, creds.LeaseId) || len(b.Leases()) != 0 {
+		t.Errorf("Expected lease %s to be revoked", creds.LeaseId)
+	}
+}
+
+func TestMemoryNamespaces(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryBackend().Client()
+	teamA := c.WithNamespace("team-a")
+
+	if _, err := teamA.Write(ctx, "secret/app", map[string]interface{}{"password": "a"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, err := ReadRef(ctx, c, "ref+vault://secret/app?namespace=team-a#password"); err != nil || v != "a" {
+		t.Errorf("Expected a but got %q (%v)", v, err)
+	}
+	if _, err := ReadRef(ctx, c, "ref+vault://secret/app#password"); err == nil {
+		t.Errorf("Expected secrets of another namespace to be hidden")
+	}
+
+	creds, err := GetDbCredentials(ctx, teamA, "app", "database")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if IsLeaseValid(ctx, c, creds.LeaseId) {
+		t.Errorf("Expected the lease to only be visible in its namespace")
+	}
+	if !IsLeaseValid(ctx, teamA, creds.LeaseId) {
+		t.Errorf("Expected lease %s to be valid", creds.LeaseId)
+	}
+}
+
+func TestMemoryFailures(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	c := b.Client()
+	injected := fmt.Errorf("injected")
+
+	b.Fail("read", 2, injected)
+	for i := 0; i < 2; i++ {
+		if _, err := GetDbCredentials(ctx, c, "app", "database"); err != injected {
+			t.Errorf("Expected the injected error but got %v", err)
+		}
+	}
+	if _, err := GetDbCredentials(ctx, c, "app", "database"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	b.Fail("", -1, injected)
+	if _, err := c.Login(ctx); err != injected {
+		t.Errorf("Expected the injected error but got %v", err)
+	}
+	if err := c.Revoke(ctx, "database/creds/app/abc"); err != injected {
+		t.Errorf("Expected the injected error but got %v", err)
+	}
+	b.Reset()
+	if _, err := c.Login(ctx); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Read(cancelled, "secret/app"); err == nil {
+		t.Errorf("Expected an error with a cancelled context")
+	}
+}
+
+func TestMemorySeed(t *testing.T) {
+	seed := filepath.Join(t.TempDir(), "seed.yaml")
+	if err := os.WriteFile(seed, []byte(`
+secret/app:
+  password: s3cr3t
+/database/roles/app/:
+  default_ttl: 30
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewMemoryBackend()
+	if err := b.LoadFile(seed); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	if v, err := ReadRef(ctx, b.Client(), "ref+vault://secret/app#password"); err != nil || v != "s3cr3t" {
+		t.Errorf("Expected s3cr3t but got %q (%v)", v, err)
+	}
+	creds, err := GetDbCredentials(ctx, b.Client(), "app", "database")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if creds.LeaseDuration != 30 {
+		t.Errorf("Expected a lease of 30s but got %d", creds.LeaseDuration)
+	}
+}
+
+func TestMemoryBackendDetection(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "http://vault:8200")
+	t.Setenv(BackendEnv, "memory")
+	backend, err := detectBackend()
+	if err != nil || backend != BackendMemory {
+		t.Errorf("Expected %v but got %v (%v)", BackendMemory, backend, err)
+	}
+
+	t.Setenv(BackendEnv, "consul")
+	if _, err := detectBackend(); err == nil {
+		t.Errorf("Expected an error for an unknown backend")
+	}
+}
+
+func TestListLeases(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryBackend().Client()
+	teamA := c.WithNamespace("team-a")
+
+	creds, err := GetDbCredentials(ctx, c, "app", "database")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, role := range []string{"app-ro", "app"} {
+		if _, err := GetDbCredentials(ctx, teamA, role, "database"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	ids, err := ListLeases(ctx, c, "/database/creds/app/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != creds.LeaseId {
+		t.Errorf("Expected [%s] but got %v", creds.LeaseId, ids)
+	}
+	if ids, _ := ListLeases(ctx, teamA, "database/creds/app"); len(ids) != 1 {
+		t.Errorf("Expected one lease in the namespace but got %v", ids)
+	}
+	if ids, _ := ListLeases(ctx, c, "database/creds/none"); len(ids) != 0 {
+		t.Errorf("Expected no leases but got %v", ids)
+	}
+
+	issued, err := LeaseIssueTime(ctx, c, creds.LeaseId)
+	if err != nil || time.Since(issued) > time.Minute {
+		t.Errorf("Expected the lease to have just been issued but got %v (%v)", issued, err)
+	}
+}
@@ -2,7 +2,6 @@ package vault
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 
@@ -27,36 +26,63 @@ func NewOpenBaoClient() (SecretsClient, error) {
 		return nil, fmt.Errorf("BAO_ADDR is not set")
 	}
 
-	skipVerify := getEnvWithPrefix("BAO", "SKIP_VERIFY", "false") == "true"
+	tlsCfg, err := tlsConfig("BAO")
+	if err != nil {
+		return nil, err
+	}
 
+	c, err := newOpenBaoClient(ClientConfig{
+		Address:   baoAddr,
+		Namespace: getEnvWithPrefix("BAO", "NAMESPACE", ""),
+		TLS:       tlsCfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token if available
+	token := getEnvWithPrefix("BAO", "TOKEN", "")
+	if token != "" {
+		c.client.SetToken(token)
+	}
+	c.authMode = detectAuthMode("BAO")
+
+	return c, nil
+}
+
+// newOpenBaoClient creates an unauthenticated client from the given configuration
+func newOpenBaoClient(cfg ClientConfig) (*OpenBaoClient, error) {
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipVerify},
+		TLSClientConfig: cfg.TLS,
 	}
 
 	httpClient := &http.Client{Transport: tr}
 	client, err := openbao.NewClient(&openbao.Config{
-		Address:    baoAddr,
+		Address:    cfg.Address,
 		HttpClient: httpClient,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create openbao client: %w", err)
 	}
 
-	// Set token if available
-	token := getEnvWithPrefix("BAO", "TOKEN", "")
-	if token != "" {
-		client.SetToken(token)
+	// the library picks up the token and namespace from the environment
+	client.ClearToken()
+	client.ClearNamespace()
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
 	}
 
 	return &OpenBaoClient{
-		client:   client,
-		backend:  BackendOpenBao,
-		address:  baoAddr,
-		authMode: detectAuthMode("BAO"),
+		client:  client,
+		backend: BackendOpenBao,
+		address: cfg.Address,
 	}, nil
 }
 
 func (o *OpenBaoClient) Login(ctx context.Context) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var secret *openbao.Secret
 	var err error
 
@@ -67,6 +93,10 @@ func (o *OpenBaoClient) Login(ctx context.Context) (*SecretResponse, error) {
 		secret, err = o.loginAppRole(ctx)
 	case AuthModeUserPass:
 		secret, err = o.loginUserPass(ctx)
+	case AuthModeJWT:
+		secret, err = o.loginJWT(ctx)
+	case AuthModeCert:
+		secret, err = o.loginCert(ctx)
 	case AuthModeToken:
 		// Token auth doesn't require login
 		return &SecretResponse{
@@ -92,8 +122,21 @@ func (o *OpenBaoClient) loginKubernetes(ctx context.Context) (*openbao.Secret, e
 		return nil, fmt.Errorf("BAO_ROLE_ID is not defined")
 	}
 
-	kubeAuth, err := openbaoKube.NewKubernetesAuth(roleID,
-		openbaoKube.WithMountPath(getEnvWithPrefix("BAO", "KUBERNETES_MOUNT_POINT", kubernetesMountPath)))
+	opts := []openbaoKube.LoginOption{
+		openbaoKube.WithMountPath(getEnvWithPrefix("BAO", "KUBERNETES_MOUNT_POINT", kubernetesMountPath)),
+	}
+	// a new token is read or requested on every login
+	jwt, err := kubernetesToken(ctx, "BAO")
+	if err != nil {
+		return nil, err
+	}
+	if jwt != "" {
+		opts = append(opts, openbaoKube.WithServiceAccountToken(jwt))
+	} else if tokenPath := getEnvWithPrefix("BAO", "KUBERNETES_TOKEN_PATH", ""); tokenPath != "" {
+		opts = append(opts, openbaoKube.WithServiceAccountTokenPath(tokenPath))
+	}
+
+	kubeAuth, err := openbaoKube.NewKubernetesAuth(roleID, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +194,63 @@ func (o *OpenBaoClient) loginUserPass(ctx context.Context) (*openbao.Secret, err
 	return authInfo, nil
 }
 
+func (o *OpenBaoClient) loginJWT(ctx context.Context) (*openbao.Secret, error) {
+	path, data, err := jwtLogin("BAO")
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := o.client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to jwt auth method: %w", err)
+	}
+	if authInfo == nil || authInfo.Auth == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return authInfo, nil
+}
+
+func (o *OpenBaoClient) loginCert(ctx context.Context) (*openbao.Secret, error) {
+	path, data, err := certLogin("BAO")
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := o.client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to cert auth method: %w", err)
+	}
+	if authInfo == nil || authInfo.Auth == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return authInfo, nil
+}
+
+// LoginKubernetes logs in to the Kubernetes auth method with the given ServiceAccount token
+func (o *OpenBaoClient) LoginKubernetes(ctx context.Context, role, mount, jwt string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	kubeAuth, err := openbaoKube.NewKubernetesAuth(role,
+		openbaoKube.WithMountPath(mount),
+		openbaoKube.WithServiceAccountToken(jwt))
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := o.client.Auth().Login(ctx, kubeAuth)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to kubernetes auth method: %w", err)
+	}
+	if authInfo == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return convertOpenBaoSecret(authInfo), nil
+}
+
 func (o *OpenBaoClient) SetToken(token string) {
 	o.client.SetToken(token)
 }
@@ -165,39 +265,69 @@ func (o *OpenBaoClient) NewLifetimeWatcher(input *LifetimeWatcherInput) (Lifetim
 		return nil, err
 	}
 
-	return &OpenBaoLifetimeWatcher{watcher: watcher}, nil
+	return &OpenBaoLifetimeWatcher{watcher: watcher, renewals: newRenewalForwarder()}, nil
+}
+
+func (o *OpenBaoClient) Read(ctx context.Context, path string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return convertOpenBaoSecret(secret), nil
+}
+
+func (o *OpenBaoClient) ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Logical().ReadWithDataWithContext(ctx, path, data)
+	if err != nil {
+		return nil, err
+	}
+	return convertOpenBaoSecret(secret), nil
 }
 
-func (o *OpenBaoClient) Read(path string) (*SecretResponse, error) {
-	secret, err := o.client.Logical().Read(path)
+func (o *OpenBaoClient) Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Logical().WriteWithContext(ctx, path, data)
 	if err != nil {
 		return nil, err
 	}
 	return convertOpenBaoSecret(secret), nil
 }
 
-func (o *OpenBaoClient) Write(path string, data map[string]interface{}) (*SecretResponse, error) {
-	secret, err := o.client.Logical().Write(path, data)
+func (o *OpenBaoClient) List(ctx context.Context, path string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Logical().ListWithContext(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 	return convertOpenBaoSecret(secret), nil
 }
 
-func (o *OpenBaoClient) Renew(leaseID string, increment int) (*SecretResponse, error) {
-	secret, err := o.client.Sys().Renew(leaseID, increment)
+func (o *OpenBaoClient) Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Sys().RenewWithContext(ctx, leaseID, increment)
 	if err != nil {
 		return nil, err
 	}
 	return convertOpenBaoSecret(secret), nil
 }
 
-func (o *OpenBaoClient) Revoke(leaseID string) error {
-	return o.client.Sys().Revoke(leaseID)
+func (o *OpenBaoClient) Revoke(ctx context.Context, leaseID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return o.client.Sys().RevokeWithContext(ctx, leaseID)
 }
 
-func (o *OpenBaoClient) Lookup(leaseID string) (*SecretResponse, error) {
-	secret, err := o.client.Sys().Lookup(leaseID)
+func (o *OpenBaoClient) Lookup(ctx context.Context, leaseID string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := o.client.Sys().LookupWithContext(ctx, leaseID)
 	if err != nil {
 		return nil, err
 	}
@@ -208,13 +338,24 @@ func (o *OpenBaoClient) Backend() BackendType {
 	return o.backend
 }
 
+// WithNamespace returns a copy of the client for the given namespace
+func (o *OpenBaoClient) WithNamespace(namespace string) SecretsClient {
+	if namespace == "" {
+		return o
+	}
+	c := *o
+	c.client = o.client.WithNamespace(namespace)
+	return &c
+}
+
 func (o *OpenBaoClient) Address() string {
 	return o.address
 }
 
 // OpenBaoLifetimeWatcher wraps openbao.LifetimeWatcher
 type OpenBaoLifetimeWatcher struct {
-	watcher *openbao.LifetimeWatcher
+	watcher  *openbao.LifetimeWatcher
+	renewals renewalForwarder
 }
 
 func (w *OpenBaoLifetimeWatcher) Start() {
@@ -223,6 +364,7 @@ func (w *OpenBaoLifetimeWatcher) Start() {
 
 func (w *OpenBaoLifetimeWatcher) Stop() {
 	w.watcher.Stop()
+	w.renewals.stop()
 }
 
 func (w *OpenBaoLifetimeWatcher) DoneCh() <-chan error {
@@ -230,16 +372,9 @@ func (w *OpenBaoLifetimeWatcher) DoneCh() <-chan error {
 }
 
 func (w *OpenBaoLifetimeWatcher) RenewCh() <-chan *RenewalInfo {
-	ch := make(chan *RenewalInfo)
-	go func() {
-		for renewal := range w.watcher.RenewCh() {
-			ch <- &RenewalInfo{
-				Secret: convertOpenBaoSecret(renewal.Secret),
-			}
-		}
-		close(ch)
-	}()
-	return ch
+	return forward(&w.renewals, w.watcher.RenewCh(), func(renewal *openbao.RenewOutput) *RenewalInfo {
+		return &RenewalInfo{Secret: convertOpenBaoSecret(renewal.Secret)}
+	})
 }
 
 // Helper function to convert OpenBao secret to unified SecretResponse
@@ -257,8 +392,9 @@ func convertOpenBaoSecret(s *openbao.Secret) *SecretResponse {
 
 	if s.Auth != nil {
 		resp.Auth = &AuthInfo{
-			ClientToken: s.Auth.ClientToken,
-			Renewable:   s.Auth.Renewable,
+			ClientToken:   s.Auth.ClientToken,
+			Renewable:     s.Auth.Renewable,
+			LeaseDuration: s.Auth.LeaseDuration,
 		}
 	}
 
@@ -280,8 +416,9 @@ func convertToOpenBaoSecret(s *SecretResponse) *openbao.Secret {
 
 	if s.Auth != nil {
 		secret.Auth = &openbao.SecretAuth{
-			ClientToken: s.Auth.ClientToken,
-			Renewable:   s.Auth.Renewable,
+			ClientToken:   s.Auth.ClientToken,
+			Renewable:     s.Auth.Renewable,
+			LeaseDuration: s.Auth.LeaseDuration,
 		}
 	}
 
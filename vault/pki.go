@@ -0,0 +1,95 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VaultCertificate represents a certificate issued by the Vault/OpenBao PKI engine
+type VaultCertificate struct {
+	Certificate  string
+	PrivateKey   string
+	IssuingCA    string
+	CAChain      []string
+	SerialNumber string
+	// Expiration is the unix timestamp after which the certificate is no longer valid
+	Expiration int64
+}
+
+// IssueCertificate requests a new certificate from <mount>/issue/<role>
+func IssueCertificate(ctx context.Context, c SecretsClient, role string, mount string, params map[string]interface{}) (VaultCertificate, error) {
+	var cert VaultCertificate
+	var err error
+
+	path := fmt.Sprintf("%s/issue/%s", mount, role)
+	s, err := c.Write(ctx, path, params)
+	if err != nil {
+		return cert, err
+	}
+	if s == nil || s.Data == nil {
+		return cert, fmt.Errorf("backend did not return a certificate for %s", path)
+	}
+
+	cert.Certificate, _ = s.Data["certificate"].(string)
+	cert.PrivateKey, _ = s.Data["private_key"].(string)
+	cert.IssuingCA, _ = s.Data["issuing_ca"].(string)
+	cert.SerialNumber, _ = s.Data["serial_number"].(string)
+	if chain, ok := s.Data["ca_chain"].([]interface{}); ok {
+		for _, ca := range chain {
+			if pem, ok := ca.(string); ok {
+				cert.CAChain = append(cert.CAChain, pem)
+			}
+		}
+	}
+	if cert.Certificate == "" || cert.PrivateKey == "" || cert.SerialNumber == "" {
+		return cert, fmt.Errorf("backend returned an incomplete certificate for %s", path)
+	}
+
+	cert.Expiration, err = toUnixTime(s.Data["expiration"])
+	if err != nil {
+		return cert, fmt.Errorf("cannot read certificate expiration: %w", err)
+	}
+
+	return cert, nil
+}
+
+// RevokeCertificate revokes the certificate with the given serial number
+func RevokeCertificate(ctx context.Context, c SecretsClient, mount string, serial string) error {
+	if serial == "" {
+		return fmt.Errorf("missing serial number")
+	}
+
+	_, err := c.Write(ctx, fmt.Sprintf("%s/revoke", mount), map[string]interface{}{
+		"serial_number": serial,
+	})
+	return err
+}
+
+// FullChain returns the certificate followed by the CA chain as a PEM bundle
+func (c VaultCertificate) FullChain() string {
+	bundle := []string{strings.TrimSpace(c.Certificate)}
+	for _, ca := range c.CAChain {
+		bundle = append(bundle, strings.TrimSpace(ca))
+	}
+	return strings.Join(bundle, "\n") + "\n"
+}
+
+func toUnixTime(v interface{}) (int64, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return t.Int64()
+	case float64:
+		return int64(t), nil
+	case int64:
+		return t, nil
+	case int:
+		return int64(t), nil
+	case string:
+		return strconv.ParseInt(t, 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
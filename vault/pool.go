@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginFunc creates a client and logs it in
+type LoginFunc func(ctx context.Context) (SecretsClient, *SecretResponse, error)
+
+// ClientPool caches one logged in client per key and logs in again shortly
+// before its token expires or when the version of its configuration changes.
+// A client whose request is denied or whose login fails is dropped, so that
+// the next one logs in again in case its token was revoked or its policies
+// changed. With an idle timeout, clients not used for that long are dropped too.
+type ClientPool struct {
+	mu      sync.Mutex
+	clients map[string]*pooledClient
+	idle    time.Duration
+}
+
+type pooledClient struct {
+	mu      sync.Mutex
+	client  SecretsClient
+	version string
+	expires time.Time
+	used    time.Time
+}
+
+// tokens are renewed by logging in again once they are this close to expiring
+const poolRefreshMargin = time.Minute
+
+// NewClientPool creates an empty pool
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: make(map[string]*pooledClient)}
+}
+
+// Client returns the cached client for key, calling login when there is none,
+// its token is about to expire or it was created for another version
+func (p *ClientPool) Client(ctx context.Context, key, version string, login LoginFunc) (SecretsClient, error) {
+	p.mu.Lock()
+	now := time.Now()
+	p.evictIdle(now)
+	pc, ok := p.clients[key]
+	if !ok {
+		pc = &pooledClient{}
+		p.clients[key] = pc
+	}
+	pc.used = now
+	p.mu.Unlock()
+
+	// logins for different keys can run in parallel
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client != nil && pc.version == version && time.Now().Add(poolRefreshMargin).Before(pc.expires) {
+		return pc.client, nil
+	}
+
+	c, resp, err := login(ctx)
+	if err == nil && (resp == nil || resp.Auth == nil) {
+		err = fmt.Errorf("no auth info was returned after login for %s", key)
+	}
+	if err != nil {
+		// the namespace or ServiceAccount may be gone, do not keep its entry
+		p.drop(key, pc)
+		return nil, err
+	}
+	c.SetToken(resp.Auth.ClientToken)
+
+	pc.client = p.wrap(key, pc, c)
+	pc.version = version
+	if resp.Auth.LeaseDuration > 0 {
+		pc.expires = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second)
+	} else {
+		// the token does not expire
+		pc.expires = time.Now().AddDate(100, 0, 0)
+	}
+	return pc.client, nil
+}
+
+// evictIdle drops the clients not used within the idle timeout. p.mu must be held
+func (p *ClientPool) evictIdle(now time.Time) {
+	if p.idle <= 0 {
+		return
+	}
+	for key, pc := range p.clients {
+		if now.Sub(pc.used) > p.idle {
+			delete(p.clients, key)
+		}
+	}
+}
+
+// drop removes pc from the pool unless it was already replaced
+func (p *ClientPool) drop(key string, pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.clients[key] == pc {
+		delete(p.clients, key)
+	}
+}
+
+// wrap returns the client forgetting itself when one of its requests is denied
+func (p *ClientPool) wrap(key string, pc *pooledClient, c SecretsClient) SecretsClient {
+	return &poolClient{SecretsClient: c, denied: func() { p.drop(key, pc) }}
+}
+
+// poolClient is a client of the pool, dropped from it when a request is denied
+type poolClient struct {
+	SecretsClient
+	denied func()
+}
+
+// check drops the client when err is a permission denied response
+func (c *poolClient) check(err error) error {
+	if IsPermissionDenied(err) {
+		c.denied()
+	}
+	return err
+}
+
+func (c *poolClient) Read(ctx context.Context, path string) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.Read(ctx, path)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.ReadWithData(ctx, path, data)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.Write(ctx, path, data)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) List(ctx context.Context, path string) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.List(ctx, path)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.Renew(ctx, leaseID, increment)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) Revoke(ctx context.Context, leaseID string) error {
+	return c.check(c.SecretsClient.Revoke(ctx, leaseID))
+}
+
+func (c *poolClient) Lookup(ctx context.Context, leaseID string) (*SecretResponse, error) {
+	resp, err := c.SecretsClient.Lookup(ctx, leaseID)
+	return resp, c.check(err)
+}
+
+func (c *poolClient) WithNamespace(namespace string) SecretsClient {
+	return &poolClient{SecretsClient: c.SecretsClient.WithNamespace(namespace), denied: c.denied}
+}
+
+// IsPermissionDenied reports whether err is a 403 response of Vault/OpenBao,
+// as returned for a revoked or expired token
+func IsPermissionDenied(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "permission denied")
+}
+
+// Forget drops the client cached for key and reports whether there was one
+func (p *ClientPool) Forget(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.clients[key]
+	delete(p.clients, key)
+	return ok
+}
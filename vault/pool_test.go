@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestClientPoolVersion(t *testing.T) {
+	pool := NewClientPool()
+	logins := 0
+	login := func(ctx context.Context) (SecretsClient, *SecretResponse, error) {
+		logins++
+		return &fakeClient{}, &SecretResponse{Auth: &AuthInfo{ClientToken: "token", LeaseDuration: 3600}}, nil
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		version  string
+		expected int
+	}{
+		{name: "First login", key: "store", version: "1", expected: 1},
+		{name: "Cached", key: "store", version: "1", expected: 1},
+		{name: "Configuration changed", key: "store", version: "2", expected: 2},
+		{name: "Another key", key: "other", version: "2", expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := pool.Client(context.Background(), tt.key, tt.version, login)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if c.(*poolClient).SecretsClient.(*fakeClient).token != "token" {
+				t.Errorf("Expected the client to be logged in")
+			}
+			if logins != tt.expected {
+				t.Errorf("Expected %d logins but got %d", tt.expected, logins)
+			}
+		})
+	}
+
+	pool.Forget("store")
+	if _, err := pool.Client(context.Background(), "store", "2", login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if logins != 4 {
+		t.Errorf("Expected 4 logins but got %d", logins)
+	}
+}
+
+func TestClientPoolPermissionDenied(t *testing.T) {
+	pool := NewClientPool()
+	backend := NewMemoryBackend()
+	logins := 0
+	login := func(ctx context.Context) (SecretsClient, *SecretResponse, error) {
+		logins++
+		return backend.Client(), &SecretResponse{Auth: &AuthInfo{ClientToken: "token", LeaseDuration: 3600}}, nil
+	}
+	ctx := context.Background()
+
+	c, err := pool.Client(ctx, "store", "1", login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Fail("read", 1, fmt.Errorf("Code: 403. Errors:\n\n* permission denied"))
+	if _, err := c.WithNamespace("team").Read(ctx, "secret/app"); !IsPermissionDenied(err) {
+		t.Fatalf("Expected a permission denied error but got %v", err)
+	}
+	if _, err := pool.Client(ctx, "store", "1", login); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 2 {
+		t.Errorf("Expected the denied client to be dropped and logged in again but got %d logins", logins)
+	}
+
+	// other errors keep the client
+	backend.Fail("read", 1, fmt.Errorf("connection refused"))
+	c, _ = pool.Client(ctx, "store", "1", login)
+	_, _ = c.Read(ctx, "secret/app")
+	if _, err := pool.Client(ctx, "store", "1", login); err != nil || logins != 2 {
+		t.Errorf("Expected the client to be kept but got %d logins and %v", logins, err)
+	}
+}
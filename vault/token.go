@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	dmetrics "digitalis.io/vals-operator/metrics"
+)
+
+// ErrNotAuthenticated is returned while the operator has no valid token
+var ErrNotAuthenticated = errors.New("not authenticated with the secrets backend")
+
+// TokenProvider holds the current token of the operator in memory. Logins and
+// renewals replace the token and its expiry together and hand it straight to
+// the client, so it never has to go through the process environment.
+type TokenProvider struct {
+	mu      sync.RWMutex
+	c       SecretsClient
+	token   string
+	expires time.Time
+	err     error
+
+	// lookupMu serializes the lookups confirming the token has expired
+	lookupMu  sync.Mutex
+	lookedUp  time.Time
+	lookupErr error
+}
+
+// tokenLookupInterval is how often the backend is asked whether a token
+// past its expiry is still valid
+var tokenLookupInterval = 10 * time.Second
+
+// tokenLookupTimeout bounds the lookup of the token
+const tokenLookupTimeout = 10 * time.Second
+
+// NewTokenProvider creates a provider feeding tokens to the given client. It
+// reports ErrNotAuthenticated until the first token is set.
+func NewTokenProvider(c SecretsClient) *TokenProvider {
+	return &TokenProvider{c: c, err: ErrNotAuthenticated}
+}
+
+// Set replaces the current token. A ttl of 0 means the token does not expire
+func (p *TokenProvider) Set(token string, ttl int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.token = token
+	p.err = nil
+	if ttl > 0 {
+		p.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+	} else {
+		p.expires = time.Time{}
+	}
+	p.c.SetToken(token)
+	p.reportTTL()
+}
+
+// Fail records why the token could not be obtained or renewed
+func (p *TokenProvider) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = fmt.Errorf("%w: %v", ErrNotAuthenticated, err)
+}
+
+// Err returns an error wrapping ErrNotAuthenticated when the last login failed
+// or the token has expired. The local expiry may be behind renewals, so a
+// token past it is only reported once the backend no longer knows it.
+func (p *TokenProvider) Err() error {
+	p.mu.RLock()
+	err, expired := p.err, !p.expires.IsZero() && time.Now().After(p.expires)
+	p.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return nil
+	}
+	return p.lookup()
+}
+
+// lookup asks the backend for the TTL of the token, at most once every
+// tokenLookupInterval, and moves the expiry to it
+func (p *TokenProvider) lookup() error {
+	p.lookupMu.Lock()
+	defer p.lookupMu.Unlock()
+	if time.Since(p.lookedUp) < tokenLookupInterval {
+		return p.lookupErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenLookupTimeout)
+	defer cancel()
+	s, err := p.c.Read(ctx, "auth/token/lookup-self")
+	p.lookedUp = time.Now()
+	if err == nil && s == nil {
+		err = fmt.Errorf("empty response")
+	}
+	if err != nil {
+		p.lookupErr = fmt.Errorf("%w: token expired: lookup failed: %v", ErrNotAuthenticated, err)
+		return p.lookupErr
+	}
+	p.lookupErr = nil
+
+	// a token without a TTL does not expire
+	ttl, _ := seconds(s.Data["ttl"])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ttl > 0 {
+		p.expires = time.Now().Add(ttl)
+	} else {
+		p.expires = time.Time{}
+	}
+	p.reportTTL()
+	return nil
+}
+
+// Token returns the current token
+func (p *TokenProvider) Token() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.token
+}
+
+// TTL returns how long the current token is valid for, 0 if it does not expire
+func (p *TokenProvider) TTL() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ttl()
+}
+
+// ReportTTL updates the token TTL metric
+func (p *TokenProvider) ReportTTL() {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	p.reportTTL()
+}
+
+func (p *TokenProvider) ttl() time.Duration {
+	if p.expires.IsZero() {
+		return 0
+	}
+	if ttl := time.Until(p.expires); ttl > 0 {
+		return ttl
+	}
+	return 0
+}
+
+func (p *TokenProvider) reportTTL() {
+	dmetrics.VaultTokenTTL.WithLabelValues(p.c.Address()).Set(p.ttl().Seconds())
+}
@@ -0,0 +1,201 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestTokenProvider(t *testing.T) {
+	c := &fakeClient{}
+	p := NewTokenProvider(c)
+
+	p.Set("first", 3600)
+	if c.token != "first" || p.Token() != "first" {
+		t.Errorf("Expected token first but got %s and %s", c.token, p.Token())
+	}
+	if ttl := p.TTL(); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected a TTL of about 1h but got %v", ttl)
+	}
+
+	p.Set("second", 0)
+	if p.Token() != "second" {
+		t.Errorf("Expected token second but got %s", p.Token())
+	}
+	if ttl := p.TTL(); ttl != 0 {
+		t.Errorf("Expected no TTL but got %v", ttl)
+	}
+}
+
+func TestTokenProviderConcurrent(t *testing.T) {
+	p := NewTokenProvider(&fakeClient{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p.Set("token", 60)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = p.Token()
+			_ = p.TTL()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTokenProviderErr(t *testing.T) {
+	p := NewTokenProvider(&fakeClient{})
+	if !errors.Is(p.Err(), ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated before login but got %v", p.Err())
+	}
+
+	p.Set("token", 60)
+	if err := p.Err(); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	p.Fail(fmt.Errorf("permission denied"))
+	if !errors.Is(p.Err(), ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated after a failed login but got %v", p.Err())
+	}
+	if p.Token() != "token" {
+		t.Errorf("Expected the last token to be kept but got %s", p.Token())
+	}
+}
+
+func TestTokenRenewerRetries(t *testing.T) {
+	log = ctrl.Log.WithName("test")
+	loginBackoff = func() wait.Backoff {
+		return wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 10, Cap: 10 * time.Millisecond}
+	}
+
+	c := &fakeClient{loginFailures: 3, ttl: 3600}
+	p := NewTokenProvider(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tokenRenewer(ctx, p)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Err() != nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if err := p.Err(); err != nil {
+		t.Fatalf("Expected the renewer to recover but got %v", err)
+	}
+	if p.Token() != "operator-token" {
+		t.Errorf("Expected token operator-token but got %s", p.Token())
+	}
+	if c.loginFailures != 0 {
+		t.Errorf("Expected all failed logins to be retried but %d are left", c.loginFailures)
+	}
+}
+
+// fakeWatcher hands out a new forwarding channel on every call to RenewCh,
+// so renewals are lost when it is called more than once
+type fakeWatcher struct {
+	renewals chan *RenewalInfo
+	done     chan error
+}
+
+func (w *fakeWatcher) Start()               {}
+func (w *fakeWatcher) Stop()                {}
+func (w *fakeWatcher) DoneCh() <-chan error { return w.done }
+func (w *fakeWatcher) RenewCh() <-chan *RenewalInfo {
+	ch := make(chan *RenewalInfo)
+	go func() {
+		for renewal := range w.renewals {
+			ch <- renewal
+		}
+	}()
+	return ch
+}
+
+func TestManageTokenLifecycleRenewals(t *testing.T) {
+	log = ctrl.Log.WithName("test")
+	interval := tokenTTLReportInterval
+	tokenTTLReportInterval = time.Millisecond
+	defer func() { tokenTTLReportInterval = interval }()
+
+	w := &fakeWatcher{renewals: make(chan *RenewalInfo), done: make(chan error)}
+	p := NewTokenProvider(&fakeClient{watcher: w})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- manageTokenLifecycle(ctx, p, &SecretResponse{Auth: &AuthInfo{ClientToken: "token-0", Renewable: true}})
+	}()
+
+	for i := 1; i <= 5; i++ {
+		// let the TTL be reported a few times between renewals
+		time.Sleep(10 * time.Millisecond)
+		expected := fmt.Sprintf("token-%d", i)
+		w.renewals <- &RenewalInfo{Secret: &SecretResponse{Auth: &AuthInfo{ClientToken: expected, LeaseDuration: 60}}}
+		deadline := time.Now().Add(time.Second)
+		for p.Token() != expected && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if p.Token() != expected {
+			t.Fatalf("Expected renewal %d to set token %s but got %q", i, expected, p.Token())
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestLifetimeWatcherRenewCh(t *testing.T) {
+	c, err := NewClient(ClientConfig{Backend: BackendVault, Address: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.NewLifetimeWatcher(&LifetimeWatcherInput{Secret: &SecretResponse{Auth: &AuthInfo{ClientToken: "token", Renewable: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if w.RenewCh() != w.RenewCh() {
+		t.Errorf("Expected RenewCh to return the same channel on every call")
+	}
+}
+
+func TestTokenProviderLookup(t *testing.T) {
+	interval := tokenLookupInterval
+	tokenLookupInterval = 0
+	defer func() { tokenLookupInterval = interval }()
+
+	c := &fakeClient{data: map[string]map[string]interface{}{
+		"auth/token/lookup-self": {"ttl": json.Number("120")},
+	}}
+	p := NewTokenProvider(c)
+	p.Set("token", 60)
+	p.expires = time.Now().Add(-time.Second)
+
+	if err := p.Err(); err != nil {
+		t.Errorf("Expected a token renewed in the backend to be valid but got %v", err)
+	}
+	if ttl := p.TTL(); ttl <= 110*time.Second || ttl > 120*time.Second {
+		t.Errorf("Expected the TTL of the lookup but got %v", ttl)
+	}
+
+	delete(c.data, "auth/token/lookup-self")
+	p.expires = time.Now().Add(-time.Second)
+	if !errors.Is(p.Err(), ErrNotAuthenticated) {
+		t.Errorf("Expected ErrNotAuthenticated once the token is gone but got %v", p.Err())
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"time"
 
 	dmetrics "digitalis.io/vals-operator/metrics"
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -17,11 +19,17 @@ const (
 	kubernetesMountPath   = "kubernetes"
 	approleMountPath      = "approle"
 	userpassRoleMountPath = "userpass"
+	jwtMountPath          = "jwt"
+	certMountPath         = "cert"
 )
 
 var log logr.Logger
 var client SecretsClient
 var backendType BackendType
+var token *TokenProvider
+
+// tokenTTLReportInterval is how often the remaining token TTL is reported
+var tokenTTLReportInterval = 30 * time.Second
 
 func getEnv(key string, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
@@ -38,53 +46,73 @@ type VaultDbSecret struct {
 	Password      string `json:"password"`
 	Hosts         string `json:"hosts"`
 	ConnectionURL string `json:"connection_url"`
+	// ConnectionURLTemplate is the connection_url before the credentials are filled in
+	ConnectionURLTemplate string `json:"-"`
 }
 
-func tokenRenewer(c SecretsClient) {
+// loginBackoff is how long to wait between failed login attempts
+var loginBackoff = func() wait.Backoff {
+	return wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.2,
+		Steps:    math.MaxInt32,
+		Cap:      5 * time.Minute,
+	}
+}
+
+// tokenRenewer keeps the operator logged in until the context is cancelled.
+// Failed logins are retried forever with exponential backoff.
+func tokenRenewer(ctx context.Context, p *TokenProvider) {
+	c := p.c
+	backoff := loginBackoff()
 	for {
-		loginResp, err := c.Login(context.TODO())
-		if err != nil {
-			dmetrics.VaultTokenError.WithLabelValues(c.Address()).SetToCurrentTime()
-			log.Error(err, "unable to authenticate", "backend", c.Backend())
-			return
+		loginResp, err := c.Login(ctx)
+		if err == nil && (loginResp == nil || loginResp.Auth == nil) {
+			err = fmt.Errorf("login returned no token")
+		}
+		if err == nil {
+			p.Set(loginResp.Auth.ClientToken, loginResp.Auth.LeaseDuration)
+			err = manageTokenLifecycle(ctx, p, loginResp)
 		}
-
-		// Set token in environment for compatibility
-		tokenEnvVar := fmt.Sprintf("%s_TOKEN", strings.ToUpper(c.Backend().String()))
-		err = os.Setenv(tokenEnvVar, loginResp.Auth.ClientToken)
 		if err != nil {
 			dmetrics.VaultTokenError.WithLabelValues(c.Address()).SetToCurrentTime()
-			log.Error(err, "Cannot set token env variable", "backend", c.Backend())
-			return
-		}
-
-		// Also set VAULT_TOKEN when using OpenBao for vals library compatibility
-		if c.Backend() == BackendOpenBao {
-			err = os.Setenv("VAULT_TOKEN", loginResp.Auth.ClientToken)
-			if err != nil {
-				dmetrics.VaultTokenError.WithLabelValues(c.Address()).SetToCurrentTime()
-				log.Error(err, "Cannot set VAULT_TOKEN for vals library compatibility")
+			p.Fail(err)
+			delay := backoff.Step()
+			log.Error(err, "unable to authenticate, retrying", "backend", c.Backend(), "retry", delay.String())
+			if !sleep(ctx, delay) {
 				return
 			}
+			continue
 		}
 
-		c.SetToken(loginResp.Auth.ClientToken)
-
-		tokenErr := manageTokenLifecycle(c, loginResp)
-		if tokenErr != nil {
-			dmetrics.VaultTokenError.WithLabelValues(c.Address()).SetToCurrentTime()
-			log.Error(tokenErr, "unable to start managing token lifecycle")
+		backoff = loginBackoff()
+		dmetrics.VaultTokenError.WithLabelValues(c.Address()).Set(0)
+		if !loginResp.Auth.Renewable && !sleep(ctx, 60*time.Second) {
+			return
+		}
+		if ctx.Err() != nil {
 			return
 		}
+	}
+}
 
-		dmetrics.VaultTokenError.WithLabelValues(c.Address()).Set(0)
-		time.Sleep(60 * time.Second)
+// sleep waits for d and returns false if the context is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
 	}
 }
 
 // Starts token lifecycle management. Returns only fatal errors as errors,
 // otherwise returns nil so we can attempt login again.
-func manageTokenLifecycle(c SecretsClient, token *SecretResponse) error {
+func manageTokenLifecycle(ctx context.Context, p *TokenProvider, token *SecretResponse) error {
+	c := p.c
 	renew := token.Auth.Renewable
 	if !renew {
 		log.Info("Token is not configured to be renewable. Re-attempting login.")
@@ -101,8 +129,15 @@ func manageTokenLifecycle(c SecretsClient, token *SecretResponse) error {
 	watcher.Start()
 	defer watcher.Stop()
 
+	renewCh := watcher.RenewCh()
+	ticker := time.NewTicker(tokenTTLReportInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ctx.Done():
+			return nil
+
 		case err := <-watcher.DoneCh():
 			if err != nil {
 				log.Error(err, "Failed to renew token")
@@ -113,87 +148,112 @@ func manageTokenLifecycle(c SecretsClient, token *SecretResponse) error {
 			return nil
 
 		// Successfully completed renewal
-		case renewal := <-watcher.RenewCh():
+		case renewal := <-renewCh:
 			log.Info("Successfully renewed token", "backend", c.Backend())
-			tokenEnvVar := fmt.Sprintf("%s_TOKEN", strings.ToUpper(c.Backend().String()))
-			err = os.Setenv(tokenEnvVar, renewal.Secret.Auth.ClientToken)
-			if err != nil {
-				return err
-			}
-			// Also set VAULT_TOKEN when using OpenBao for vals library compatibility
-			if c.Backend() == BackendOpenBao {
-				err = os.Setenv("VAULT_TOKEN", renewal.Secret.Auth.ClientToken)
-				if err != nil {
-					return err
-				}
-			}
+			p.Set(renewal.Secret.Auth.ClientToken, renewal.Secret.Auth.LeaseDuration)
+
+		case <-ticker.C:
+			p.ReportTTL()
 		}
 	}
 }
 
-func RenewDbCredentials(leaseId string, increment int) error {
+// Started reports whether Start has set up the operator's own identity
+func Started() bool {
+	return token != nil
+}
+
+// Ready returns an error while the operator is not logged in. It is always nil
+// when no secrets backend is configured.
+func Ready() error {
+	if token == nil {
+		return nil
+	}
+	return token.Err()
+}
+
+// DefaultClient returns the client using the operator's own identity
+func DefaultClient() (SecretsClient, error) {
 	if client == nil {
 		var err error
 		client, err = NewSecretsClient()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
+	return client, nil
+}
 
+func RenewDbCredentials(ctx context.Context, c SecretsClient, leaseId string, increment int) error {
 	if leaseId == "" {
 		return fmt.Errorf("missing lease id")
 	}
 
-	_, err := client.Renew(leaseId, increment)
+	_, err := c.Renew(ctx, leaseId, increment)
 	return err
 }
 
-func IsLeaseValid(leaseId string) bool {
-	if client == nil {
-		var err error
-		client, err = NewSecretsClient()
-		if err != nil {
-			return false
-		}
-	}
-
+func IsLeaseValid(ctx context.Context, c SecretsClient, leaseId string) bool {
 	if leaseId == "" {
 		return false
 	}
 
-	_, err := client.Lookup(leaseId)
+	_, err := c.Lookup(ctx, leaseId)
 	return err == nil
 }
 
-func RevokeDbCredentials(leaseId string) error {
-	if client == nil {
-		var err error
-		client, err = NewSecretsClient()
-		if err != nil {
-			return err
-		}
-	}
-
+func RevokeDbCredentials(ctx context.Context, c SecretsClient, leaseId string) error {
 	if leaseId == "" {
 		return fmt.Errorf("missing lease id")
 	}
 
-	return client.Revoke(leaseId)
+	return c.Revoke(ctx, leaseId)
 }
 
-func GetDbCredentials(role string, mount string) (VaultDbSecret, error) {
-	var dbSecret VaultDbSecret
-	var err error
-
-	if client == nil {
-		client, err = NewSecretsClient()
-		if err != nil {
-			return dbSecret, err
+// ListLeases returns the IDs of the leases issued under a prefix such as
+// database/creds/app. Listing leases needs sudo on sys/leases/lookup.
+func ListLeases(ctx context.Context, c SecretsClient, prefix string) ([]string, error) {
+	prefix = strings.Trim(prefix, "/")
+	resp, err := c.List(ctx, "sys/leases/lookup/"+prefix+"/")
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, nil
+	}
+	keys, _ := resp.Data["keys"].([]interface{})
+	var ids []string
+	for _, k := range keys {
+		if key, ok := k.(string); ok && key != "" && !strings.HasSuffix(key, "/") {
+			ids = append(ids, prefix+"/"+key)
 		}
 	}
+	return ids, nil
+}
+
+// LeaseIssueTime returns when a lease was issued
+func LeaseIssueTime(ctx context.Context, c SecretsClient, leaseId string) (time.Time, error) {
+	resp, err := c.Lookup(ctx, leaseId)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if resp == nil || resp.Data == nil {
+		return time.Time{}, fmt.Errorf("lease %s not found", leaseId)
+	}
+	issued, _ := resp.Data["issue_time"].(string)
+	t, err := time.Parse(time.RFC3339Nano, issued)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid issue time of lease %s: %w", leaseId, err)
+	}
+	return t, nil
+}
+
+func GetDbCredentials(ctx context.Context, c SecretsClient, role string, mount string) (VaultDbSecret, error) {
+	var dbSecret VaultDbSecret
+	var err error
 
 	path := fmt.Sprintf("%s/creds/%s", mount, role)
-	s, err := client.Read(path)
+	s, err := c.Read(ctx, path)
 	if err != nil {
 		return dbSecret, err
 	}
@@ -206,11 +266,12 @@ func GetDbCredentials(role string, mount string) (VaultDbSecret, error) {
 
 	// Get connection URL or hosts list
 	var connectionURL string
+	var connectionURLTemplate string
 	var hosts string
 	var port string
 
 	path = fmt.Sprintf("%s/config/%s", mount, mount)
-	cfg, err2 := client.Read(path)
+	cfg, err2 := c.Read(ctx, path)
 	if err2 != nil {
 		log.Info("Could not get access details for the database", "error", err2)
 	} else if cfg != nil && cfg.Data != nil {
@@ -224,9 +285,9 @@ func GetDbCredentials(role string, mount string) (VaultDbSecret, error) {
 			hosts = h
 		}
 
-		c, ok := conn["connection_url"].(string)
+		u, ok := conn["connection_url"].(string)
 		if ok {
-			connectionURL = c
+			connectionURL = u
 		}
 
 		n, ok := conn["port"].(json.Number)
@@ -234,6 +295,7 @@ func GetDbCredentials(role string, mount string) (VaultDbSecret, error) {
 			port = n.String()
 		}
 
+		connectionURLTemplate = connectionURL
 		if connectionURL != "" {
 			connectionURL = strings.Replace(connectionURL, "{{username}}", s.Data["username"].(string), 1)
 			connectionURL = strings.Replace(connectionURL, "{{password}}", s.Data["password"].(string), 1)
@@ -252,6 +314,8 @@ func GetDbCredentials(role string, mount string) (VaultDbSecret, error) {
 		Password:      s.Data["password"].(string),
 		Hosts:         hosts,
 		ConnectionURL: connectionURL,
+
+		ConnectionURLTemplate: connectionURLTemplate,
 	}
 
 	return dbSecret, nil
@@ -272,32 +336,31 @@ func Start() error {
 	backendType = client.Backend()
 	log.Info("Using secrets backend", "backend", backendType, "address", client.Address())
 
-	// Workaround: Set VAULT_ variables for vals library when using OpenBao
-	// The vals library doesn't have native OpenBao support, so it requires VAULT_ variables
-	if backendType == BackendOpenBao {
-		// If BAO_ADDR is set but VAULT_ADDR is not, copy BAO_ADDR to VAULT_ADDR for vals compatibility
-		if os.Getenv("BAO_ADDR") != "" && os.Getenv("VAULT_ADDR") == "" {
-			log.Info("Setting VAULT_ADDR for vals library compatibility", "address", os.Getenv("BAO_ADDR"))
-			os.Setenv("VAULT_ADDR", os.Getenv("BAO_ADDR"))
-		}
-		// Copy BAO_TOKEN to VAULT_TOKEN if needed (will be set later after login if not already set)
-		if os.Getenv("BAO_TOKEN") != "" && os.Getenv("VAULT_TOKEN") == "" {
-			log.Info("Setting VAULT_TOKEN for vals library compatibility")
-			os.Setenv("VAULT_TOKEN", os.Getenv("BAO_TOKEN"))
-		}
+	// The vals library doesn't have native OpenBao support, references it
+	// resolves itself need VAULT_ADDR. The token is never exported.
+	if backendType == BackendOpenBao && os.Getenv("BAO_ADDR") != "" && os.Getenv("VAULT_ADDR") == "" {
+		log.Info("Setting VAULT_ADDR for vals library compatibility", "address", os.Getenv("BAO_ADDR"))
+		os.Setenv("VAULT_ADDR", os.Getenv("BAO_ADDR"))
+	}
+
+	token = NewTokenProvider(client)
+
+	if backendType == BackendMemory {
+		log.Info("Using the in-memory backend, secrets are lost on restart")
+		token.Set("memory", 0)
+		return nil
 	}
 
 	// Check if using token-only auth
-	tokenEnvVar := fmt.Sprintf("%s_TOKEN", strings.ToUpper(backendType.String()))
-	if os.Getenv(tokenEnvVar) != "" && detectAuthMode(strings.ToUpper(backendType.String())) == AuthModeToken {
+	if detectAuthMode(strings.ToUpper(backendType.String())) == AuthModeToken {
 		log.Info("Using token-only authentication, skipping token renewal")
-		client.SetToken(os.Getenv(tokenEnvVar))
+		token.Set(getEnvWithPrefix(strings.ToUpper(backendType.String()), "TOKEN", ""), 0)
 		return nil
 	}
 
 	dmetrics.VaultError.WithLabelValues(client.Address()).Set(0)
 
-	go tokenRenewer(client)
+	go tokenRenewer(context.Background(), token)
 
 	return nil
 }
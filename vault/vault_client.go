@@ -2,7 +2,6 @@ package vault
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 
@@ -27,36 +26,63 @@ func NewVaultClient() (SecretsClient, error) {
 		return nil, fmt.Errorf("VAULT_ADDR is not set")
 	}
 
-	skipVerify := getEnvWithPrefix("VAULT", "SKIP_VERIFY", "false") == "true"
+	tlsCfg, err := tlsConfig("VAULT")
+	if err != nil {
+		return nil, err
+	}
 
+	c, err := newVaultClient(ClientConfig{
+		Address:   vaultAddr,
+		Namespace: getEnvWithPrefix("VAULT", "NAMESPACE", ""),
+		TLS:       tlsCfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token if available
+	token := getEnvWithPrefix("VAULT", "TOKEN", "")
+	if token != "" {
+		c.client.SetToken(token)
+	}
+	c.authMode = detectAuthMode("VAULT")
+
+	return c, nil
+}
+
+// newVaultClient creates an unauthenticated client from the given configuration
+func newVaultClient(cfg ClientConfig) (*VaultClient, error) {
 	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipVerify},
+		TLSClientConfig: cfg.TLS,
 	}
 
 	httpClient := &http.Client{Transport: tr}
 	client, err := api.NewClient(&api.Config{
-		Address:    vaultAddr,
+		Address:    cfg.Address,
 		HttpClient: httpClient,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault client: %w", err)
 	}
 
-	// Set token if available
-	token := getEnvWithPrefix("VAULT", "TOKEN", "")
-	if token != "" {
-		client.SetToken(token)
+	// the library picks up the token and namespace from the environment
+	client.ClearToken()
+	client.ClearNamespace()
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
 	}
 
 	return &VaultClient{
-		client:   client,
-		backend:  BackendVault,
-		address:  vaultAddr,
-		authMode: detectAuthMode("VAULT"),
+		client:  client,
+		backend: BackendVault,
+		address: cfg.Address,
 	}, nil
 }
 
 func (v *VaultClient) Login(ctx context.Context) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
 	var secret *api.Secret
 	var err error
 
@@ -67,6 +93,10 @@ func (v *VaultClient) Login(ctx context.Context) (*SecretResponse, error) {
 		secret, err = v.loginAppRole(ctx)
 	case AuthModeUserPass:
 		secret, err = v.loginUserPass(ctx)
+	case AuthModeJWT:
+		secret, err = v.loginJWT(ctx)
+	case AuthModeCert:
+		secret, err = v.loginCert(ctx)
 	case AuthModeToken:
 		// Token auth doesn't require login
 		return &SecretResponse{
@@ -92,8 +122,21 @@ func (v *VaultClient) loginKubernetes(ctx context.Context) (*api.Secret, error)
 		return nil, fmt.Errorf("VAULT_ROLE_ID is not defined")
 	}
 
-	kubeAuth, err := vaultKube.NewKubernetesAuth(roleID,
-		vaultKube.WithMountPath(getEnvWithPrefix("VAULT", "KUBERNETES_MOUNT_POINT", kubernetesMountPath)))
+	opts := []vaultKube.LoginOption{
+		vaultKube.WithMountPath(getEnvWithPrefix("VAULT", "KUBERNETES_MOUNT_POINT", kubernetesMountPath)),
+	}
+	// a new token is read or requested on every login
+	jwt, err := kubernetesToken(ctx, "VAULT")
+	if err != nil {
+		return nil, err
+	}
+	if jwt != "" {
+		opts = append(opts, vaultKube.WithServiceAccountToken(jwt))
+	} else if tokenPath := getEnvWithPrefix("VAULT", "KUBERNETES_TOKEN_PATH", ""); tokenPath != "" {
+		opts = append(opts, vaultKube.WithServiceAccountTokenPath(tokenPath))
+	}
+
+	kubeAuth, err := vaultKube.NewKubernetesAuth(roleID, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +194,63 @@ func (v *VaultClient) loginUserPass(ctx context.Context) (*api.Secret, error) {
 	return authInfo, nil
 }
 
+func (v *VaultClient) loginJWT(ctx context.Context) (*api.Secret, error) {
+	path, data, err := jwtLogin("VAULT")
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := v.client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to jwt auth method: %w", err)
+	}
+	if authInfo == nil || authInfo.Auth == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return authInfo, nil
+}
+
+func (v *VaultClient) loginCert(ctx context.Context) (*api.Secret, error) {
+	path, data, err := certLogin("VAULT")
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := v.client.Logical().WriteWithContext(ctx, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to cert auth method: %w", err)
+	}
+	if authInfo == nil || authInfo.Auth == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return authInfo, nil
+}
+
+// LoginKubernetes logs in to the Kubernetes auth method with the given ServiceAccount token
+func (v *VaultClient) LoginKubernetes(ctx context.Context, role, mount, jwt string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	kubeAuth, err := vaultKube.NewKubernetesAuth(role,
+		vaultKube.WithMountPath(mount),
+		vaultKube.WithServiceAccountToken(jwt))
+	if err != nil {
+		return nil, err
+	}
+
+	authInfo, err := v.client.Auth().Login(ctx, kubeAuth)
+	if err != nil {
+		return nil, fmt.Errorf("unable to login to kubernetes auth method: %w", err)
+	}
+	if authInfo == nil {
+		return nil, fmt.Errorf("no auth info was returned after login")
+	}
+
+	return convertVaultSecret(authInfo), nil
+}
+
 func (v *VaultClient) SetToken(token string) {
 	v.client.SetToken(token)
 }
@@ -165,39 +265,69 @@ func (v *VaultClient) NewLifetimeWatcher(input *LifetimeWatcherInput) (LifetimeW
 		return nil, err
 	}
 
-	return &VaultLifetimeWatcher{watcher: watcher}, nil
+	return &VaultLifetimeWatcher{watcher: watcher, renewals: newRenewalForwarder()}, nil
+}
+
+func (v *VaultClient) Read(ctx context.Context, path string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return convertVaultSecret(secret), nil
+}
+
+func (v *VaultClient) ReadWithData(ctx context.Context, path string, data map[string][]string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Logical().ReadWithDataWithContext(ctx, path, data)
+	if err != nil {
+		return nil, err
+	}
+	return convertVaultSecret(secret), nil
 }
 
-func (v *VaultClient) Read(path string) (*SecretResponse, error) {
-	secret, err := v.client.Logical().Read(path)
+func (v *VaultClient) Write(ctx context.Context, path string, data map[string]interface{}) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Logical().WriteWithContext(ctx, path, data)
 	if err != nil {
 		return nil, err
 	}
 	return convertVaultSecret(secret), nil
 }
 
-func (v *VaultClient) Write(path string, data map[string]interface{}) (*SecretResponse, error) {
-	secret, err := v.client.Logical().Write(path, data)
+func (v *VaultClient) List(ctx context.Context, path string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Logical().ListWithContext(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 	return convertVaultSecret(secret), nil
 }
 
-func (v *VaultClient) Renew(leaseID string, increment int) (*SecretResponse, error) {
-	secret, err := v.client.Sys().Renew(leaseID, increment)
+func (v *VaultClient) Renew(ctx context.Context, leaseID string, increment int) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Sys().RenewWithContext(ctx, leaseID, increment)
 	if err != nil {
 		return nil, err
 	}
 	return convertVaultSecret(secret), nil
 }
 
-func (v *VaultClient) Revoke(leaseID string) error {
-	return v.client.Sys().Revoke(leaseID)
+func (v *VaultClient) Revoke(ctx context.Context, leaseID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return v.client.Sys().RevokeWithContext(ctx, leaseID)
 }
 
-func (v *VaultClient) Lookup(leaseID string) (*SecretResponse, error) {
-	secret, err := v.client.Sys().Lookup(leaseID)
+func (v *VaultClient) Lookup(ctx context.Context, leaseID string) (*SecretResponse, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	secret, err := v.client.Sys().LookupWithContext(ctx, leaseID)
 	if err != nil {
 		return nil, err
 	}
@@ -208,13 +338,24 @@ func (v *VaultClient) Backend() BackendType {
 	return v.backend
 }
 
+// WithNamespace returns a copy of the client for the given namespace
+func (v *VaultClient) WithNamespace(namespace string) SecretsClient {
+	if namespace == "" {
+		return v
+	}
+	c := *v
+	c.client = v.client.WithNamespace(namespace)
+	return &c
+}
+
 func (v *VaultClient) Address() string {
 	return v.address
 }
 
 // VaultLifetimeWatcher wraps api.LifetimeWatcher
 type VaultLifetimeWatcher struct {
-	watcher *api.LifetimeWatcher
+	watcher  *api.LifetimeWatcher
+	renewals renewalForwarder
 }
 
 func (w *VaultLifetimeWatcher) Start() {
@@ -223,6 +364,7 @@ func (w *VaultLifetimeWatcher) Start() {
 
 func (w *VaultLifetimeWatcher) Stop() {
 	w.watcher.Stop()
+	w.renewals.stop()
 }
 
 func (w *VaultLifetimeWatcher) DoneCh() <-chan error {
@@ -230,16 +372,9 @@ func (w *VaultLifetimeWatcher) DoneCh() <-chan error {
 }
 
 func (w *VaultLifetimeWatcher) RenewCh() <-chan *RenewalInfo {
-	ch := make(chan *RenewalInfo)
-	go func() {
-		for renewal := range w.watcher.RenewCh() {
-			ch <- &RenewalInfo{
-				Secret: convertVaultSecret(renewal.Secret),
-			}
-		}
-		close(ch)
-	}()
-	return ch
+	return forward(&w.renewals, w.watcher.RenewCh(), func(renewal *api.RenewOutput) *RenewalInfo {
+		return &RenewalInfo{Secret: convertVaultSecret(renewal.Secret)}
+	})
 }
 
 // Helper function to convert Vault secret to unified SecretResponse
@@ -257,8 +392,9 @@ func convertVaultSecret(s *api.Secret) *SecretResponse {
 
 	if s.Auth != nil {
 		resp.Auth = &AuthInfo{
-			ClientToken: s.Auth.ClientToken,
-			Renewable:   s.Auth.Renewable,
+			ClientToken:   s.Auth.ClientToken,
+			Renewable:     s.Auth.Renewable,
+			LeaseDuration: s.Auth.LeaseDuration,
 		}
 	}
 
@@ -280,8 +416,9 @@ func convertToVaultSecret(s *SecretResponse) *api.Secret {
 
 	if s.Auth != nil {
 		secret.Auth = &api.SecretAuth{
-			ClientToken: s.Auth.ClientToken,
-			Renewable:   s.Auth.Renewable,
+			ClientToken:   s.Auth.ClientToken,
+			Renewable:     s.Auth.Renewable,
+			LeaseDuration: s.Auth.LeaseDuration,
 		}
 	}
 